@@ -0,0 +1,107 @@
+package chat
+
+import (
+	"strings"
+	"unicode"
+)
+
+// DefaultStems are masked wherever they appear in a word. DefaultRoots only
+// at the start of a word or right after one of RootPrefixes, because they
+// also hide inside harmless words ("колебался", "застрахуешь"). DefaultWords
+// only as whole words, because they are also parts of harmless ones.
+var (
+	DefaultStems = []string{
+		"fuck", "shit", "cunt", "bitch", "asshole", "bastard", "motherf",
+		"пизд", "бляд", "блят", "мудак", "мудил", "гандон", "залуп",
+	}
+	DefaultRoots = []string{
+		"хуй", "хуе", "хуя", "ебат", "ебан", "ебал", "ебут",
+	}
+	RootPrefixes = []string{
+		"в", "въ", "вы", "до", "за", "из", "изъ", "на", "недо", "о", "об", "объ", "от", "отъ",
+		"пере", "по", "под", "подъ", "при", "раз", "рас", "разъ", "с", "съ", "у",
+	}
+	DefaultWords = []string{
+		"ass", "dick", "cock", "prick", "twat", "wanker", "whore", "slut", "fag",
+		"бля", "сука", "суки", "суке", "сукой", "хер", "херня", "пидор", "пидар", "шлюха",
+	}
+)
+
+// Filter masks profanity in chat messages
+type Filter struct {
+	stems []string
+	roots []string
+	words map[string]struct{}
+}
+
+// NewFilter returns a filter masking words that contain one of stems, start
+// with one of roots, bare or after one of RootPrefixes, or are one of words,
+// compared in lower case with ё read as е
+func NewFilter(stems []string, roots []string, words []string) *Filter {
+	f := &Filter{words: make(map[string]struct{}, len(words))}
+	for _, stem := range stems {
+		f.stems = append(f.stems, normalize(stem))
+	}
+	for _, root := range roots {
+		f.roots = append(f.roots, normalize(root))
+		for _, prefix := range RootPrefixes {
+			f.roots = append(f.roots, normalize(prefix+root))
+		}
+	}
+	for _, word := range words {
+		f.words[normalize(word)] = struct{}{}
+	}
+	return f
+}
+
+// Clean returns text with every offending word replaced by as many asterisks
+// as it has letters. Everything else, spacing and punctuation included, is
+// left as it was.
+func (f *Filter) Clean(text string) string {
+	runes := []rune(text)
+	for start := 0; start < len(runes); {
+		if !isWordRune(runes[start]) {
+			start++
+			continue
+		}
+		end := start
+		for end < len(runes) && isWordRune(runes[end]) {
+			end++
+		}
+		if f.offends(string(runes[start:end])) {
+			for i := start; i < end; i++ {
+				runes[i] = '*'
+			}
+		}
+		start = end
+	}
+	return string(runes)
+}
+
+func (f *Filter) offends(word string) bool {
+	word = normalize(word)
+	if _, ok := f.words[word]; ok {
+		return true
+	}
+	for _, stem := range f.stems {
+		if strings.Contains(word, stem) {
+			return true
+		}
+	}
+	for _, root := range f.roots {
+		if strings.HasPrefix(word, root) {
+			return true
+		}
+	}
+	return false
+}
+
+func normalize(word string) string {
+	return strings.ReplaceAll(strings.ToLower(word), "ё", "е")
+}
+
+// isWordRune tells the runes words are made of; digits count so that
+// "sh1t" stays one word and is not split around the digit
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
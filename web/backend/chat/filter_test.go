@@ -0,0 +1,43 @@
+package chat
+
+import "testing"
+
+func TestFilterClean(t *testing.T) {
+	f := NewFilter(DefaultStems, DefaultRoots, DefaultWords)
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"clean text", "Good game, well played!", "Good game, well played!"},
+		{"stem inside a word", "what the fucking hell", "what the ******* hell"},
+		{"digits stay in the word", "sh1t happens, shit happens", "sh1t happens, **** happens"},
+		{"whole word", "you ass", "you ***"},
+		{"word inside a harmless one", "pass the class", "pass the class"},
+		{"case and ё", "Ёбаный СУКА", "****** ****"},
+		{"punctuation kept", "сука!!! ну и ну", "****!!! ну и ну"},
+		{"root at the start", "хуйня какая-то", "***** какая-то"},
+		{"root after a prefix", "заебал, охуеть, нахуй", "******, ******, *****"},
+		{"root after a hard sign prefix", "отъебать", "********"},
+		{"stem with a prefix", "распиздяй", "*********"},
+
+		// Корни внутри обычных слов не трогаем
+		{"колебался", "он колебался", "он колебался"},
+		{"колебаться", "не стоит колебаться", "не стоит колебаться"},
+		{"застрахуешь", "машину застрахуешь?", "машину застрахуешь?"},
+		{"страхуем", "страхуем друг друга", "страхуем друг друга"},
+		{"страхуй", "страхуй меня", "страхуй меня"},
+		{"страхуя", "страхуя напарника", "страхуя напарника"},
+		{"хлебала", "хлебала щи", "хлебала щи"},
+		{"бляха", "потерял бляху", "потерял бляху"},
+		{"сукно", "зелёное сукно", "зелёное сукно"},
+		{"herring", "red herring", "red herring"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := f.Clean(tt.text); got != tt.want {
+				t.Fatalf("Clean(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
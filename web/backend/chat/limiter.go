@@ -0,0 +1,61 @@
+package chat
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultLimit lets a user send 5 messages in any 10 seconds
+var DefaultLimit = Limit{Messages: 5, Per: 10 * time.Second}
+
+// Limit is how many messages a user may send in a sliding window
+type Limit struct {
+	Messages int
+	Per      time.Duration
+}
+
+// Limiter enforces a Limit per user across all of their games
+type Limiter struct {
+	limit Limit
+
+	mu        sync.Mutex
+	sent      map[int][]time.Time // the user's messages within the window, oldest first
+	lastSweep time.Time
+}
+
+// NewLimiter returns a limiter enforcing limit
+func NewLimiter(limit Limit) *Limiter {
+	if limit.Messages <= 0 || limit.Per <= 0 {
+		limit = DefaultLimit
+	}
+	return &Limiter{limit: limit, sent: make(map[int][]time.Time)}
+}
+
+// Allow records a message of userID sent at now and reports whether it is
+// within the limit. Refused messages are not counted.
+func (l *Limiter) Allow(userID int, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	since := now.Add(-l.limit.Per)
+	if l.lastSweep.Before(since) {
+		// Раз в окно забываем тех, кто давно молчит
+		for id, sent := range l.sent {
+			if len(sent) == 0 || !sent[len(sent)-1].After(since) {
+				delete(l.sent, id)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	sent := l.sent[userID]
+	for len(sent) > 0 && !sent[0].After(since) {
+		sent = sent[1:]
+	}
+	if len(sent) >= l.limit.Messages {
+		l.sent[userID] = sent
+		return false
+	}
+	l.sent[userID] = append(sent, now)
+	return true
+}
@@ -1,7 +1,9 @@
 package data
 
 import (
+    "crypto/rand"
     "errors"
+    "math/big"
     "time"
 
     "github.com/golang-jwt/jwt/v4"
@@ -62,3 +64,41 @@ func (u *User) HashPassword(password string) error {
 func (u *User) CheckPassword(password string) error {
     return bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(password))
 }
+
+// SetPassword protects a private game with a password
+func (g *Game) SetPassword(password string) error {
+    hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+    if err != nil {
+        return err
+    }
+    g.PasswordHash = string(hashedPassword)
+    g.HasPassword = true
+    return nil
+}
+
+// CheckPassword checks the password of a game; games without one accept any
+func (g *Game) CheckPassword(password string) error {
+    if g.PasswordHash == "" {
+        return nil
+    }
+    return bcrypt.CompareHashAndPassword([]byte(g.PasswordHash), []byte(password))
+}
+
+// inviteAlphabet leaves out characters that are easy to confuse (0/O, 1/I/L)
+const inviteAlphabet = "ABCDEFGHJKMNPQRSTUVWXYZ23456789"
+
+// InviteCodeLength is the length of a game invite code
+const InviteCodeLength = 8
+
+// GenerateInviteCode returns a random code to share a private game with
+func GenerateInviteCode() (string, error) {
+    code := make([]byte, InviteCodeLength)
+    for i := range code {
+        n, err := rand.Int(rand.Reader, big.NewInt(int64(len(inviteAlphabet))))
+        if err != nil {
+            return "", err
+        }
+        code[i] = inviteAlphabet[n.Int64()]
+    }
+    return string(code), nil
+}
@@ -0,0 +1,224 @@
+package data
+
+// Official base-game catalog. The seeding step upserts these rows by name,
+// so editing an entry here and re-running the seed keeps the database in sync.
+
+// Role names used by the game rules
+const (
+	RoleSheriff  = "Sheriff"
+	RoleDeputy   = "Deputy"
+	RoleOutlaw   = "Outlaw"
+	RoleRenegade = "Renegade"
+)
+
+// Player counts the role distribution supports
+const (
+	MinPlayers = 4
+	MaxPlayers = 7
+)
+
+// Expansions lists the expansions a game can be created with
+var Expansions = []string{"dodge_city", "high_noon", "fistful_of_cards", "wild_west_show", "gold_rush", "valley_of_shadows"}
+
+// IsExpansion reports whether name is one of Expansions
+func IsExpansion(name string) bool {
+	for _, expansion := range Expansions {
+		if expansion == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Card types: brown cards are played and discarded, blue cards stay on the board
+const (
+	CardTypeBrown = "brown"
+	CardTypeBlue  = "blue"
+)
+
+// BaseRoles lists the four roles of the base game
+var BaseRoles = []Role{
+	{Name: RoleSheriff, Definition: "Kill all the Outlaws and the Renegade. Plays first, is revealed to everyone and gets one extra life point."},
+	{Name: RoleDeputy, Definition: "Help the Sheriff and kill all the Outlaws and the Renegade."},
+	{Name: RoleOutlaw, Definition: "Kill the Sheriff. Whoever kills an Outlaw draws 3 cards as a reward."},
+	{Name: RoleRenegade, Definition: "Be the last character left in play: eliminate everyone else, Sheriff last."},
+}
+
+// RoleDistribution returns the role names dealt for the given number of players
+func RoleDistribution(numPlayers int) []string {
+	switch numPlayers {
+	case 4:
+		return []string{RoleSheriff, RoleRenegade, RoleOutlaw, RoleOutlaw}
+	case 5:
+		return []string{RoleSheriff, RoleRenegade, RoleOutlaw, RoleOutlaw, RoleDeputy}
+	case 6:
+		return []string{RoleSheriff, RoleRenegade, RoleOutlaw, RoleOutlaw, RoleOutlaw, RoleDeputy}
+	case 7:
+		return []string{RoleSheriff, RoleRenegade, RoleOutlaw, RoleOutlaw, RoleOutlaw, RoleDeputy, RoleDeputy}
+	default:
+		return nil
+	}
+}
+
+// BaseCharacters lists the sixteen characters of the base game
+var BaseCharacters = []Character{
+	{Name: "Bart Cassidy", Health: 4, Definition: "Each time he loses a life point, he immediately draws a card from the deck."},
+	{Name: "Black Jack", Health: 4, Definition: "Shows the second card he draws; on Hearts or Diamonds he draws one more card."},
+	{Name: "Calamity Janet", Health: 4, Definition: "Can use Bang! cards as Missed! cards and vice versa."},
+	{Name: "El Gringo", Health: 3, Definition: "Each time he loses a life point due to a player, he draws a card from that player's hand."},
+	{Name: "Jesse Jones", Health: 4, Definition: "May draw his first card from the hand of another player."},
+	{Name: "Jourdonnais", Health: 4, Definition: "Is considered to have a Barrel in play at all times."},
+	{Name: "Kit Carlson", Health: 4, Definition: "Looks at the top three cards of the deck and chooses the two to draw."},
+	{Name: "Lucky Duke", Health: 4, Definition: "Each time he draws!, he flips the top two cards and chooses the result."},
+	{Name: "Paul Regret", Health: 3, Definition: "Is considered to have a Mustang in play at all times."},
+	{Name: "Pedro Ramirez", Health: 4, Definition: "May draw his first card from the top of the discard pile."},
+	{Name: "Rose Doolan", Health: 4, Definition: "Is considered to have a Scope in play at all times."},
+	{Name: "Sid Ketchum", Health: 4, Definition: "May discard 2 cards at any time to regain one life point."},
+	{Name: "Slab the Killer", Health: 4, Definition: "Players trying to cancel his Bang! cards need to play 2 Missed!."},
+	{Name: "Suzy Lafayette", Health: 4, Definition: "As soon as she has no cards in her hand, she draws a card from the deck."},
+	{Name: "Vulture Sam", Health: 4, Definition: "Whenever a character is eliminated, he takes all the cards that player had in hand and in play."},
+	{Name: "Willy the Kid", Health: 4, Definition: "Can play any number of Bang! cards during his turn."},
+}
+
+// BaseCards lists the eighty cards of the base game. Suits and Ranks hold one
+// entry per copy, so Copies always equals len(Suits).
+var BaseCards = []Card{
+	{
+		Name: "Bang!", Type: CardTypeBrown, Copies: 25,
+		Description: "Shoot a player within reach: they lose a life point unless they play a Missed!.",
+		Suits: []string{"spades", "hearts", "hearts", "hearts",
+			"diamonds", "diamonds", "diamonds", "diamonds", "diamonds", "diamonds", "diamonds",
+			"diamonds", "diamonds", "diamonds", "diamonds", "diamonds", "diamonds",
+			"clubs", "clubs", "clubs", "clubs", "clubs", "clubs", "clubs", "clubs"},
+		Ranks: []string{"A", "A", "Q", "K",
+			"2", "3", "4", "5", "6", "7", "8", "9", "10", "J", "Q", "K", "A",
+			"2", "3", "4", "5", "6", "7", "8", "9"},
+	},
+	{
+		Name: "Missed!", Type: CardTypeBrown, Copies: 12,
+		Description: "Cancel a shot aimed at you.",
+		Suits: []string{"clubs", "clubs", "clubs", "clubs", "clubs",
+			"spades", "spades", "spades", "spades", "spades", "spades", "spades"},
+		Ranks: []string{"10", "J", "Q", "K", "A", "2", "3", "4", "5", "6", "7", "8"},
+	},
+	{
+		Name: "Beer", Type: CardTypeBrown, Copies: 6,
+		Description: "Regain one life point. Has no effect when only two players are left.",
+		Suits:       []string{"hearts", "hearts", "hearts", "hearts", "hearts", "hearts"},
+		Ranks:       []string{"6", "7", "8", "9", "10", "J"},
+	},
+	{
+		Name: "Panic!", Type: CardTypeBrown, Copies: 4,
+		Description: "Draw a card from a player at distance 1.",
+		Suits:       []string{"hearts", "hearts", "hearts", "diamonds"},
+		Ranks:       []string{"J", "Q", "A", "8"},
+	},
+	{
+		Name: "Cat Balou", Type: CardTypeBrown, Copies: 4,
+		Description: "Force any player to discard a card, regardless of distance.",
+		Suits:       []string{"hearts", "diamonds", "diamonds", "diamonds"},
+		Ranks:       []string{"K", "9", "10", "J"},
+	},
+	{
+		Name: "Stagecoach", Type: CardTypeBrown, Copies: 2,
+		Description: "Draw two cards from the deck.",
+		Suits:       []string{"spades", "spades"},
+		Ranks:       []string{"9", "9"},
+	},
+	{
+		Name: "Wells Fargo", Type: CardTypeBrown, Copies: 1,
+		Description: "Draw three cards from the deck.",
+		Suits:       []string{"hearts"},
+		Ranks:       []string{"3"},
+	},
+	{
+		Name: "Gatling", Type: CardTypeBrown, Copies: 1,
+		Description: "Shoot a Bang! at every other player.",
+		Suits:       []string{"hearts"},
+		Ranks:       []string{"10"},
+	},
+	{
+		Name: "Duel", Type: CardTypeBrown, Copies: 3,
+		Description: "Challenge a player: alternately discard Bang! cards, the first who cannot loses a life point.",
+		Suits:       []string{"diamonds", "spades", "clubs"},
+		Ranks:       []string{"Q", "J", "8"},
+	},
+	{
+		Name: "Indians!", Type: CardTypeBrown, Copies: 2,
+		Description: "Every other player discards a Bang! or loses a life point.",
+		Suits:       []string{"diamonds", "diamonds"},
+		Ranks:       []string{"K", "A"},
+	},
+	{
+		Name: "General Store", Type: CardTypeBrown, Copies: 2,
+		Description: "Reveal one card per player; starting with you, each player takes one.",
+		Suits:       []string{"clubs", "spades"},
+		Ranks:       []string{"9", "Q"},
+	},
+	{
+		Name: "Saloon", Type: CardTypeBrown, Copies: 1,
+		Description: "All players regain one life point.",
+		Suits:       []string{"hearts"},
+		Ranks:       []string{"5"},
+	},
+	{
+		Name: "Barrel", Type: CardTypeBlue, Copies: 2,
+		Description: "When shot, draw!: on a Heart the shot is missed.",
+		Suits:       []string{"spades", "spades"},
+		Ranks:       []string{"Q", "K"},
+	},
+	{
+		Name: "Scope", Type: CardTypeBlue, Copies: 1,
+		Description: "You see all other players at distance -1.",
+		Suits:       []string{"spades"},
+		Ranks:       []string{"A"},
+	},
+	{
+		Name: "Mustang", Type: CardTypeBlue, Copies: 2,
+		Description: "Other players see you at distance +1.",
+		Suits:       []string{"hearts", "hearts"},
+		Ranks:       []string{"8", "9"},
+	},
+	{
+		Name: "Jail", Type: CardTypeBlue, Copies: 3,
+		Description: "Play on another player (not the Sheriff). They draw! at the start of their turn and skip it unless they draw a Heart.",
+		Suits:       []string{"spades", "spades", "hearts"},
+		Ranks:       []string{"J", "10", "4"},
+	},
+	{
+		Name: "Dynamite", Type: CardTypeBlue, Copies: 1,
+		Description: "At the start of your turn draw!: on 2-9 of Spades it explodes for 3 life points, otherwise pass it to the left.",
+		Suits:       []string{"hearts"},
+		Ranks:       []string{"2"},
+	},
+	{
+		Name: "Volcanic", Type: CardTypeBlue, Copies: 2,
+		Description: "Weapon, reach 1. You can play any number of Bang! cards during your turn.",
+		Suits:       []string{"spades", "clubs"},
+		Ranks:       []string{"10", "10"},
+	},
+	{
+		Name: "Schofield", Type: CardTypeBlue, Copies: 3,
+		Description: "Weapon, reach 2.",
+		Suits:       []string{"clubs", "clubs", "spades"},
+		Ranks:       []string{"J", "Q", "K"},
+	},
+	{
+		Name: "Remington", Type: CardTypeBlue, Copies: 1,
+		Description: "Weapon, reach 3.",
+		Suits:       []string{"clubs"},
+		Ranks:       []string{"K"},
+	},
+	{
+		Name: "Rev. Carabine", Type: CardTypeBlue, Copies: 1,
+		Description: "Weapon, reach 4.",
+		Suits:       []string{"clubs"},
+		Ranks:       []string{"A"},
+	},
+	{
+		Name: "Winchester", Type: CardTypeBlue, Copies: 1,
+		Description: "Weapon, reach 5.",
+		Suits:       []string{"spades"},
+		Ranks:       []string{"8"},
+	},
+}
@@ -11,17 +11,189 @@ type User struct {
     Email     string    `json:"email"`
     Password  string    `json:"-"`
     CreatedAt time.Time `json:"created_at"`
+    Rating    int       `json:"rating"` // matchmaking puts players of close ratings together
+}
+
+// DefaultRating is the rating every new user starts with
+const DefaultRating = 1000
+
+// UserSummary is what anyone may see of another user
+type UserSummary struct {
+    ID       int    `json:"id"`
+    Username string `json:"username"`
+    Relation string `json:"relation,omitempty"` // the viewer's relation to them, see the Relation constants
+}
+
+// UserSearch finds users by part of their username on behalf of ViewerID
+type UserSearch struct {
+    ViewerID int
+    Query    string
+    Limit    int
+}
+
+// Relations of one user to another. Each user holds their own side: a
+// friendship is a friend row both ways, a request a pending row of the
+// requester, a block a blocked row of the user blocking.
+const (
+    RelationPending  = "pending"
+    RelationFriend   = "friend"
+    RelationBlocked  = "blocked"
+    RelationIncoming = "incoming" // not stored: the other user sent a pending request
+)
+
+// Friend is another user one has a relation with
+type Friend struct {
+    UserID   int       `json:"user_id"`
+    Username string    `json:"username"`
+    Status   string    `json:"status"`
+    Since    time.Time `json:"since"`
 }
 
 // Game represents a game session
 type Game struct {
-    ID        int       `json:"id"`
-    GameName  string    `json:"game_name"`
-    CreatorID int       `json:"creator_id"`
-    Status    string    `json:"status"` // waiting, in_progress, finished
-    CreatedAt time.Time `json:"created_at"`
+    ID           int       `json:"id"`
+    GameName     string    `json:"game_name"`
+    CreatorID    int       `json:"creator_id"`
+    Status       string    `json:"status"` // waiting, in_progress, finished
+    CreatedAt    time.Time `json:"created_at"`
+    MaxSeats     int       `json:"max_seats"` // between MinPlayers and MaxPlayers
+    Rules        GameRules `json:"rules"`
+    Visibility   string    `json:"visibility"`            // public, unlisted or private
+    InviteCode   string    `json:"invite_code,omitempty"` // private games only, shown to their players
+    PasswordHash string    `json:"-"`
+    HasPassword  bool      `json:"has_password"`
+    Expansions   []string  `json:"expansions"` // names from Expansions
+    // LastActivityAt moves with every change to the lobby, the start and every
+    // move a player makes (not the turn timer's); the janitor expires lobbies
+    // and aborts games that stay idle too long
+    LastActivityAt time.Time `json:"last_activity_at"`
+    RematchOf      int       `json:"rematch_of,omitempty"` // the finished game this one is a rematch of
+}
+
+// Game statuses
+const (
+    StatusWaiting    = "waiting"     // lobby: players join and get ready
+    StatusInProgress = "in_progress" // started by the host
+    StatusFinished   = "finished"
+    StatusAborted    = "aborted" // abandoned by its players and ended by the janitor, nobody won
+)
+
+// Game visibilities: public games are listed to everyone, unlisted ones can be
+// joined by anyone who knows the ID, private ones only with the invite code
+const (
+    VisibilityPublic   = "public"
+    VisibilityUnlisted = "unlisted"
+    VisibilityPrivate  = "private"
+)
+
+// GameInvite asks a user to take a seat in a game waiting for players
+type GameInvite struct {
+    GameID      int       `json:"game_id"`
+    GameName    string    `json:"game_name"`
+    UserID      int       `json:"user_id"`
+    InviterID   int       `json:"inviter_id"`
+    InviterName string    `json:"inviter_name"`
+    Status      string    `json:"status"`
+    CreatedAt   time.Time `json:"created_at"`
+}
+
+// Invite statuses
+const (
+    InvitePending  = "pending"
+    InviteAccepted = "accepted" // the user took their seat
+    InviteDeclined = "declined"
+)
+
+// ChatMessage is a message posted to one of a game's chat channels
+type ChatMessage struct {
+    ID       int64     `json:"id"`
+    GameID   int       `json:"game_id"`
+    Channel  string    `json:"channel"`
+    UserID   int       `json:"user_id"`
+    Username string    `json:"username"`
+    Text     string    `json:"text"`
+    SentAt   time.Time `json:"sent_at"`
+}
+
+// Chat channels of a game
+const (
+    ChatLobby      = "lobby"      // the players while the game waits for them
+    ChatTable      = "table"      // the living players of the running game, read by everyone
+    ChatSpectators = "spectators" // the spectators, never shown to players
+    ChatDead       = "dead"       // the eliminated players
+)
+
+// ChatChannels lists every chat channel
+var ChatChannels = []string{ChatLobby, ChatTable, ChatSpectators, ChatDead}
+
+// ChatQuery pages the history of a chat channel, newest first
+type ChatQuery struct {
+    GameID     int
+    Channel    string
+    BeforeID   int64     // the page starts before this message, 0 for the newest
+    SentBefore time.Time // messages sent from then on are left out; zero leaves none out
+    Limit      int
+}
+
+// GameSummary is one entry of the game list
+type GameSummary struct {
+    ID          int       `json:"id"`
+    GameName    string    `json:"game_name"`
+    CreatorID   int       `json:"creator_id"`
+    CreatorName string    `json:"creator_name"`
+    Status      string    `json:"status"`
+    Visibility  string    `json:"visibility"`
+    Players     int       `json:"players"`
+    MaxSeats    int       `json:"max_seats"`
+    Expansions  []string  `json:"expansions"`
+    CreatedAt   time.Time `json:"created_at"`
+}
+
+// Orders of the game list; every one ends with the game ID so it is total
+const (
+    GameSortNewest = "newest" // created_at descending, the default
+    GameSortOldest = "oldest" // created_at ascending
+    GameSortName   = "name"   // game_name ascending
+)
+
+// GameListQuery filters, sorts and pages the game list. Zero fields do not filter.
+type GameListQuery struct {
+    ViewerID    int    // non-public games are listed only to their players
+    Status      string
+    HasOpenSeat bool
+    Creator     string // username of the creator, case-insensitive
+    Search      string // part of the game name, case-insensitive
+    Expansion   string
+    Sort        string
+    After       *GameCursor // the page starts after this game
+    Limit       int
+}
+
+// GameCursor is a position in the game list: the sort key and ID of a game
+type GameCursor struct {
+    Key string `json:"k"`
+    ID  int    `json:"id"`
+}
+
+// SortKey returns the value the game list orders g by under sort, as stored
+// in a GameCursor
+func (g *GameSummary) SortKey(sort string) string {
+    if sort == GameSortName {
+        return g.GameName
+    }
+    return g.CreatedAt.Format(time.RFC3339Nano)
 }
 
+// GameRules are the settings a game is created with
+type GameRules struct {
+    TurnSeconds           int `json:"turn_seconds"`            // time for a whole turn, 0 for no limit
+    ResponseSeconds       int `json:"response_seconds"`        // time to answer a Bang!, 0 for no limit
+    SpectatorDelaySeconds int `json:"spectator_delay_seconds"` // how far behind spectators watch, 0 for live
+}
+
+// DefaultGameRules apply when a game is created without rules
+var DefaultGameRules = GameRules{TurnSeconds: 90, ResponseSeconds: 30}
+
 // Player represents a player in the specific game
 type Player struct {
     ID         int        `json:"id"`
@@ -30,6 +202,7 @@ type Player struct {
     Role       string        `json:"role_"`
     Health     int        `json:"health"`
     Character  string        `json:"character"`
+    Ready      bool       `json:"ready"` // toggled in the lobby, the host starts once everyone is
 }
 
 // Role represents a role in the game
@@ -52,6 +225,8 @@ type Card struct {
     Type string `json:"type"`
     Description string `json:"description"`
     Copies int `json:"copies"`
+    Suits []string `json:"suits,omitempty"`
+    Ranks []string `json:"ranks,omitempty"`
 }
 
 // GameState
@@ -59,4 +234,27 @@ type GameState struct {
     ID int `json:"id"`
     CurrentTurn int `json:"current_turn"`
     CurrentPhase string `json:"current_phase"`
-}
\ No newline at end of file
+    // While a Bang! waits for the target's answer the phase is "respond"
+    PendingFrom int `json:"pending_from,omitempty"`
+    PendingTarget int `json:"pending_target,omitempty"`
+    // When the current turn and the pending response run out; nil means no limit
+    TurnDeadline *time.Time `json:"turn_deadline,omitempty"`
+    ResponseDeadline *time.Time `json:"response_deadline,omitempty"`
+    Version int64 `json:"version"` // bumped by every committed move
+}
+
+// Deadline returns when the current phase runs out and who has to act before
+// then: the target while a Bang! is pending, the current player otherwise
+func (s *GameState) Deadline() (*time.Time, int) {
+    if s.CurrentPhase == "respond" {
+        return s.ResponseDeadline, s.PendingTarget
+    }
+    return s.TurnDeadline, s.CurrentTurn
+}
+
+// IdempotentResponse is the stored reply to a request sent with an Idempotency-Key
+type IdempotentResponse struct {
+    Status  int               `json:"status"`
+    Headers map[string]string `json:"headers"`
+    Body    []byte            `json:"body"`
+}
@@ -0,0 +1,59 @@
+package db
+
+import (
+	"backend/data"
+	"fmt"
+)
+
+// SaveChatMessage stores a message and fills in its ID and sending time
+func (s *PostgresStore) SaveChatMessage(message *data.ChatMessage) error {
+	query := `
+		INSERT INTO chat_messages (game_id, channel, user_id, text) VALUES ($1, $2, $3, $4)
+		RETURNING id, sent_at`
+	err := s.q.QueryRow(query, message.GameID, message.Channel, message.UserID, message.Text).
+		Scan(&message.ID, &message.SentAt)
+	if err != nil {
+		return fmt.Errorf("could not insert chat message: %v", err)
+	}
+	return nil
+}
+
+// GetChatMessages returns one page of a channel's history, newest first
+func (s *PostgresStore) GetChatMessages(query data.ChatQuery) ([]data.ChatMessage, error) {
+	var args []interface{}
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	sql := `
+		SELECT m.id, m.game_id, m.channel, m.user_id, u.username, m.text, m.sent_at
+		FROM chat_messages m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.game_id = ` + arg(query.GameID) + ` AND m.channel = ` + arg(query.Channel)
+	if query.BeforeID > 0 {
+		sql += ` AND m.id < ` + arg(query.BeforeID)
+	}
+	if !query.SentBefore.IsZero() {
+		sql += ` AND m.sent_at < ` + arg(query.SentBefore)
+	}
+	sql += ` ORDER BY m.id DESC LIMIT ` + arg(query.Limit)
+
+	rows, err := s.q.Query(sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("could not query chat messages: %v", err)
+	}
+	defer rows.Close()
+
+	messages := []data.ChatMessage{}
+	for rows.Next() {
+		var message data.ChatMessage
+		err := rows.Scan(&message.ID, &message.GameID, &message.Channel, &message.UserID,
+			&message.Username, &message.Text, &message.SentAt)
+		if err != nil {
+			return nil, fmt.Errorf("could not scan chat message: %v", err)
+		}
+		messages = append(messages, message)
+	}
+	return messages, rows.Err()
+}
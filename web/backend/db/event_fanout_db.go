@@ -0,0 +1,56 @@
+package db
+
+import (
+	"backend/events"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// EventChannel is the NOTIFY channel game events are fanned out on
+const EventChannel = "game_events"
+
+// maxNotifyPayload keeps clear of PostgreSQL's 8000 byte NOTIFY payload limit
+const maxNotifyPayload = 7900
+
+// ErrEventTooLarge is returned for an event that does not fit in a NOTIFY
+var ErrEventTooLarge = errors.New("event is too large for NOTIFY")
+
+// NotifyGameEvent numbers event within its game and sends it to every
+// instance listening on EventChannel, this one included. The seq comes from
+// game_event_seq, whose row stays locked until the NOTIFY commits, so all
+// instances receive a game's events in seq order.
+func (s *PostgresStore) NotifyGameEvent(event events.Event) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("could not begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO game_event_seq (game_id, seq) VALUES ($1, 1)
+		ON CONFLICT (game_id) DO UPDATE SET seq = game_event_seq.seq + 1
+		RETURNING seq`
+	err = tx.QueryRow(query, event.GameID).Scan(&event.Seq)
+	if err != nil {
+		return fmt.Errorf("could not allocate event seq: %v", err)
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("could not encode event: %v", err)
+	}
+	if len(payload) > maxNotifyPayload {
+		return ErrEventTooLarge
+	}
+
+	_, err = tx.Exec(`SELECT pg_notify($1, $2)`, EventChannel, string(payload))
+	if err != nil {
+		return fmt.Errorf("could not notify event: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("could not commit transaction: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+package db
+
+import (
+	"backend/data"
+	"database/sql"
+	"fmt"
+)
+
+// SearchUsers finds users whose name contains query.Query, exact matches
+// first, with the viewer's relation to each. Users who blocked the viewer
+// are left out.
+func (s *PostgresStore) SearchUsers(query data.UserSearch) ([]data.UserSummary, error) {
+	search := `
+		SELECT u.id, u.username,
+		       COALESCE(mine.status, CASE WHEN theirs.status = 'pending' THEN 'incoming' END, '')
+		FROM users u
+		LEFT JOIN user_relations mine ON mine.user_id = $1 AND mine.other_id = u.id
+		LEFT JOIN user_relations theirs ON theirs.user_id = u.id AND theirs.other_id = $1
+		WHERE u.id <> $1
+		  AND u.username ILIKE $2
+		  AND theirs.status IS DISTINCT FROM 'blocked'
+		ORDER BY lower(u.username) = lower($3) DESC, lower(u.username), u.id
+		LIMIT $4`
+	rows, err := s.q.Query(search, query.ViewerID, "%"+escapeLike(query.Query)+"%", query.Query, query.Limit)
+	if err != nil {
+		return nil, fmt.Errorf("could not search users: %v", err)
+	}
+	defer rows.Close()
+
+	users := []data.UserSummary{}
+	for rows.Next() {
+		var user data.UserSummary
+		if err := rows.Scan(&user.ID, &user.Username, &user.Relation); err != nil {
+			return nil, fmt.Errorf("could not scan user: %v", err)
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+// GetRelation returns userID's side of their relation to otherID, "" for none
+func (s *PostgresStore) GetRelation(userID int, otherID int) (string, error) {
+	var status string
+	err := s.q.QueryRow(`SELECT status FROM user_relations WHERE user_id = $1 AND other_id = $2`, userID, otherID).Scan(&status)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("could not query relation: %v", err)
+	}
+	return status, nil
+}
+
+// CreateFriendRequest records a pending request of userID to otherID
+func (s *PostgresStore) CreateFriendRequest(userID int, otherID int) error {
+	query := `
+		INSERT INTO user_relations (user_id, other_id, status) VALUES ($1, $2, 'pending')
+		ON CONFLICT (user_id, other_id) DO NOTHING`
+	if _, err := s.q.Exec(query, userID, otherID); err != nil {
+		return fmt.Errorf("could not insert friend request: %v", err)
+	}
+	return nil
+}
+
+// AcceptFriendRequest turns the pending request of requesterID into a
+// friendship both ways, in one statement
+func (s *PostgresStore) AcceptFriendRequest(userID int, requesterID int) (bool, error) {
+	query := `
+		WITH request AS (
+			UPDATE user_relations SET status = 'friend', created_at = NOW()
+			WHERE user_id = $2 AND other_id = $1 AND status = 'pending'
+			RETURNING user_id
+		)
+		INSERT INTO user_relations (user_id, other_id, status)
+		SELECT $1, $2, 'friend' FROM request
+		ON CONFLICT (user_id, other_id) DO UPDATE SET status = 'friend', created_at = NOW()`
+	result, err := s.q.Exec(query, userID, requesterID)
+	if err != nil {
+		return false, fmt.Errorf("could not accept friend request: %v", err)
+	}
+	accepted, err := result.RowsAffected()
+	return accepted > 0, err
+}
+
+// RemoveFriend ends a friendship both ways
+func (s *PostgresStore) RemoveFriend(userID int, otherID int) (bool, error) {
+	query := `
+		DELETE FROM user_relations
+		WHERE status = 'friend'
+		  AND ((user_id = $1 AND other_id = $2) OR (user_id = $2 AND other_id = $1))`
+	result, err := s.q.Exec(query, userID, otherID)
+	if err != nil {
+		return false, fmt.Errorf("could not remove friend: %v", err)
+	}
+	removed, err := result.RowsAffected()
+	return removed > 0, err
+}
+
+// BlockUser records that userID blocks otherID. Their friendship or
+// requests end; a block of otherID's own stays.
+func (s *PostgresStore) BlockUser(userID int, otherID int) error {
+	query := `
+		WITH dropped AS (
+			DELETE FROM user_relations WHERE user_id = $2 AND other_id = $1 AND status <> 'blocked'
+		)
+		INSERT INTO user_relations (user_id, other_id, status) VALUES ($1, $2, 'blocked')
+		ON CONFLICT (user_id, other_id) DO UPDATE SET status = 'blocked', created_at = NOW()`
+	if _, err := s.q.Exec(query, userID, otherID); err != nil {
+		return fmt.Errorf("could not block user: %v", err)
+	}
+	return nil
+}
+
+// DeleteRelation drops userID's side toward otherID if it has status
+func (s *PostgresStore) DeleteRelation(userID int, otherID int, status string) (bool, error) {
+	result, err := s.q.Exec(`DELETE FROM user_relations WHERE user_id = $1 AND other_id = $2 AND status = $3`,
+		userID, otherID, status)
+	if err != nil {
+		return false, fmt.Errorf("could not delete relation: %v", err)
+	}
+	deleted, err := result.RowsAffected()
+	return deleted > 0, err
+}
+
+// ListRelations lists the users userID has a relation in status to, by name
+func (s *PostgresStore) ListRelations(userID int, status string) ([]data.Friend, error) {
+	return s.queryFriends(`
+		SELECT u.id, u.username, r.status, r.created_at
+		FROM user_relations r
+		JOIN users u ON u.id = r.other_id
+		WHERE r.user_id = $1 AND r.status = $2
+		ORDER BY lower(u.username), u.id`, userID, status)
+}
+
+// ListFriendRequests lists the users with a pending request to userID, oldest first
+func (s *PostgresStore) ListFriendRequests(userID int) ([]data.Friend, error) {
+	return s.queryFriends(`
+		SELECT u.id, u.username, r.status, r.created_at
+		FROM user_relations r
+		JOIN users u ON u.id = r.user_id
+		WHERE r.other_id = $1 AND r.status = 'pending'
+		ORDER BY r.created_at, u.id`, userID)
+}
+
+func (s *PostgresStore) queryFriends(query string, args ...interface{}) ([]data.Friend, error) {
+	rows, err := s.q.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("could not query relations: %v", err)
+	}
+	defer rows.Close()
+
+	friends := []data.Friend{}
+	for rows.Next() {
+		var friend data.Friend
+		if err := rows.Scan(&friend.UserID, &friend.Username, &friend.Status, &friend.Since); err != nil {
+			return nil, fmt.Errorf("could not scan relation: %v", err)
+		}
+		friends = append(friends, friend)
+	}
+	return friends, rows.Err()
+}
@@ -3,63 +3,174 @@ package db
 import (
 	"backend/data"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
+	"strings"
 	"time"
+
+	"github.com/lib/pq"
 )
 
+// ErrNoGame is returned by InLobbyTx when the game does not exist
+var ErrNoGame = errors.New("game not found")
+
+// InLobbyTx runs fn in a single transaction that holds a row lock on the game
+// (SELECT ... FOR UPDATE), so joins, ready toggles and the start of one game
+// see each other's changes and never interleave. Every store call made through
+// tx joins the transaction, and any error returned by fn rolls all of them back.
+func (s *PostgresStore) InLobbyTx(gameID int, fn func(tx GameStore, game *data.Game) error) error {
+    tx, err := s.db.Begin()
+    if err != nil {
+        return fmt.Errorf("could not begin transaction: %v", err)
+    }
+    defer tx.Rollback()
+
+    txStore := &PostgresStore{db: s.db, q: tx}
+    game, err := txStore.getGame(gameID, true)
+    if err != nil {
+        return err
+    }
+    if game == nil {
+        return ErrNoGame
+    }
+
+    if err := fn(txStore, game); err != nil {
+        return err
+    }
+
+    if err := tx.Commit(); err != nil {
+        return fmt.Errorf("could not commit transaction: %v", err)
+    }
+    return nil
+}
+
 // CreateGame adds a new game to the database
-func CreateGame(game *data.Game) error {
-    query := `INSERT INTO games (game_name, creator_id, status) VALUES ($1, $2, $3) RETURNING id`
-    err := DB.QueryRow(query, game.GameName, game.CreatorID, game.Status).Scan(&game.ID)
+func (s *PostgresStore) CreateGame(game *data.Game) error {
+    query := `
+        INSERT INTO games (game_name, creator_id, status, max_seats, turn_seconds, response_seconds,
+                           visibility, invite_code, password_hash, expansions, rematch_of, spectator_delay_seconds)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, ''), $9, $10, NULLIF($11, 0), $12) RETURNING id`
+    err := s.q.QueryRow(query, game.GameName, game.CreatorID, game.Status, game.MaxSeats,
+        game.Rules.TurnSeconds, game.Rules.ResponseSeconds,
+        game.Visibility, game.InviteCode, game.PasswordHash, pq.Array(game.Expansions), game.RematchOf,
+        game.Rules.SpectatorDelaySeconds).Scan(&game.ID)
     if err != nil {
         return fmt.Errorf("could not insert game: %v", err)
     }
     return nil
 }
 
-// GetAllGames retrieves all games along with their creators
-func GetAllGames() ([]map[string]interface{}, error) {
-    query := `
-        SELECT g.id, g.game_name, g.creator_id, g.status, g.created_at, u.username 
+// ListGames returns one page of the games query.ViewerID may see, filtered and
+// ordered as asked, with the number of games matching across all pages
+func (s *PostgresStore) ListGames(query data.GameListQuery) ([]data.GameSummary, int, error) {
+    var args []interface{}
+    arg := func(value interface{}) string {
+        args = append(args, value)
+        return fmt.Sprintf("$%d", len(args))
+    }
+
+    where := []string{`(g.visibility = 'public'
+        OR EXISTS (SELECT 1 FROM players p WHERE p.game_id = g.id AND p.user_id = ` + arg(query.ViewerID) + `))`}
+    if query.Status != "" {
+        where = append(where, `g.status = `+arg(query.Status))
+    }
+    if query.HasOpenSeat {
+        where = append(where, `(SELECT COUNT(*) FROM players p WHERE p.game_id = g.id) < g.max_seats`)
+    }
+    if query.Creator != "" {
+        where = append(where, `lower(u.username) = lower(`+arg(query.Creator)+`)`)
+    }
+    if query.Search != "" {
+        where = append(where, `g.game_name ILIKE `+arg("%"+escapeLike(query.Search)+"%"))
+    }
+    if query.Expansion != "" {
+        where = append(where, arg(query.Expansion)+` = ANY(g.expansions)`)
+    }
+    from := `
         FROM games g
         JOIN users u ON g.creator_id = u.id
-    `
-    rows, err := DB.Query(query)
+        WHERE ` + strings.Join(where, " AND ")
+
+    var total int
+    err := s.q.QueryRow(`SELECT COUNT(*)`+from, args...).Scan(&total)
     if err != nil {
-        return nil, err
+        return nil, 0, fmt.Errorf("could not count games: %v", err)
+    }
+
+    // Курсор — ключ сортировки и id последней игры предыдущей страницы
+    var order, after string
+    switch query.Sort {
+    case data.GameSortOldest:
+        order, after = `g.created_at ASC, g.id ASC`, `(g.created_at, g.id) > (%s::timestamptz, %s)`
+    case data.GameSortName:
+        order, after = `g.game_name ASC, g.id ASC`, `(g.game_name, g.id) > (%s, %s)`
+    default:
+        order, after = `g.created_at DESC, g.id DESC`, `(g.created_at, g.id) < (%s::timestamptz, %s)`
+    }
+    if query.After != nil {
+        from += ` AND ` + fmt.Sprintf(after, arg(query.After.Key), arg(query.After.ID))
+    }
+
+    rows, err := s.q.Query(`
+        SELECT g.id, g.game_name, g.creator_id, u.username, g.status, g.visibility,
+               (SELECT COUNT(*) FROM players p WHERE p.game_id = g.id), g.max_seats, g.expansions, g.created_at`+
+        from+` ORDER BY `+order+` LIMIT `+arg(query.Limit), args...)
+    if err != nil {
+        return nil, 0, fmt.Errorf("could not query games: %v", err)
     }
     defer rows.Close()
 
-    var games []map[string]interface{}
+    games := []data.GameSummary{}
     for rows.Next() {
-        var gameID int
-        var gameName, status, creatorName string
-        var creatorID int
-        var createdAt time.Time
-
-        err := rows.Scan(&gameID, &gameName, &creatorID, &status, &createdAt, &creatorName)
+        var game data.GameSummary
+        err := rows.Scan(&game.ID, &game.GameName, &game.CreatorID, &game.CreatorName, &game.Status, &game.Visibility,
+            &game.Players, &game.MaxSeats, pq.Array(&game.Expansions), &game.CreatedAt)
         if err != nil {
-            return nil, err
-        }
-
-        game := map[string]interface{}{
-            "id":           gameID,
-            "game_name":    gameName,
-            "creator_id":   creatorID,
-            "creator_name": creatorName,
-            "status":       status,
-            "created_at":   createdAt,
+            return nil, 0, fmt.Errorf("could not scan game: %v", err)
         }
         games = append(games, game)
     }
-    return games, nil
+    return games, total, rows.Err()
 }
+
+// escapeLike escapes the wildcards of a LIKE pattern
+func escapeLike(s string) string {
+    return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
 // GetGameByID retrieves a game by its ID
-func GetGameByID(gameID int) (*data.Game, error) {
-    query := `SELECT id, game_name, creator_id, status, created_at FROM games WHERE id = $1`
-    game := &data.Game{}
-    err := DB.QueryRow(query, gameID).Scan(&game.ID, &game.GameName, &game.CreatorID, &game.Status, &game.CreatedAt)
+func (s *PostgresStore) GetGameByID(gameID int) (*data.Game, error) {
+    return s.getGame(gameID, false)
+}
+
+// GetGameByInviteCode retrieves the private game an invite code belongs to
+func (s *PostgresStore) GetGameByInviteCode(code string) (*data.Game, error) {
+    return s.queryGame(`WHERE invite_code = $1`, code)
+}
+
+// GetRematchOf retrieves the rematch created for a finished game
+func (s *PostgresStore) GetRematchOf(gameID int) (*data.Game, error) {
+    return s.queryGame(`WHERE rematch_of = $1`, gameID)
+}
+
+// getGame reads a game, locking its row until the transaction ends when lock is set
+func (s *PostgresStore) getGame(gameID int, lock bool) (*data.Game, error) {
+    where := `WHERE id = $1`
+    if lock {
+        where += ` FOR UPDATE`
+    }
+    return s.queryGame(where, gameID)
+}
+
+// gameColumns are the columns of games that scanGame reads, in order
+const gameColumns = `id, game_name, creator_id, status, created_at, max_seats, turn_seconds, response_seconds,
+               visibility, COALESCE(invite_code, ''), password_hash, expansions, last_activity_at,
+               COALESCE(rematch_of, 0), spectator_delay_seconds`
+
+// queryGame reads the one game matching where
+func (s *PostgresStore) queryGame(where string, args ...interface{}) (*data.Game, error) {
+    game, err := scanGame(s.q.QueryRow(`SELECT `+gameColumns+` FROM games `+where, args...))
     if err != nil {
         if err == sql.ErrNoRows {
             return nil, nil
@@ -69,31 +180,95 @@ func GetGameByID(gameID int) (*data.Game, error) {
     return game, nil
 }
 
+// scanGame reads one row of gameColumns
+func scanGame(row interface{ Scan(dest ...interface{}) error }) (*data.Game, error) {
+    game := &data.Game{}
+    err := row.Scan(&game.ID, &game.GameName, &game.CreatorID, &game.Status, &game.CreatedAt,
+        &game.MaxSeats, &game.Rules.TurnSeconds, &game.Rules.ResponseSeconds,
+        &game.Visibility, &game.InviteCode, &game.PasswordHash, pq.Array(&game.Expansions), &game.LastActivityAt,
+        &game.RematchOf, &game.Rules.SpectatorDelaySeconds)
+    if err != nil {
+        return nil, err
+    }
+    game.HasPassword = game.PasswordHash != ""
+    return game, nil
+}
+
+// ListIdleGames returns the games in status whose last activity was before idleSince, oldest first
+func (s *PostgresStore) ListIdleGames(status string, idleSince time.Time) ([]*data.Game, error) {
+    rows, err := s.q.Query(`SELECT `+gameColumns+` FROM games
+        WHERE status = $1 AND last_activity_at < $2 ORDER BY last_activity_at, id`, status, idleSince)
+    if err != nil {
+        return nil, fmt.Errorf("could not query idle games: %v", err)
+    }
+    defer rows.Close()
+
+    var games []*data.Game
+    for rows.Next() {
+        game, err := scanGame(rows)
+        if err != nil {
+            return nil, fmt.Errorf("could not scan game: %v", err)
+        }
+        games = append(games, game)
+    }
+    return games, rows.Err()
+}
+
+// TouchGame records activity in a game, which keeps the janitor away from it
+func (s *PostgresStore) TouchGame(gameID int) error {
+    _, err := s.q.Exec(`UPDATE games SET last_activity_at = NOW() WHERE id = $1`, gameID)
+    if err != nil {
+        return fmt.Errorf("could not touch game: %v", err)
+    }
+    return nil
+}
+
 // DeleteGame removes a game and its associated players from the database
-func DeleteGame(gameID int) error {
+func (s *PostgresStore) DeleteGame(gameID int) error {
     query := `DELETE FROM games WHERE id = $1`
-    _, err := DB.Exec(query, gameID)
+    _, err := s.q.Exec(query, gameID)
     if err != nil {
         return fmt.Errorf("could not delete game: %v", err)
     }
     return nil
 }
 
+// UpdateGameCreator hands the game over to another host
+func (s *PostgresStore) UpdateGameCreator(gameID int, userID int) error {
+    query := `UPDATE games SET creator_id = $1, last_activity_at = NOW() WHERE id = $2`
+    _, err := s.q.Exec(query, userID, gameID)
+    if err != nil {
+        return fmt.Errorf("could not update game creator: %v", err)
+    }
+    return nil
+}
+
+// UpdateGameStatus moves a game to status: waiting, in_progress, finished or aborted
+func (s *PostgresStore) UpdateGameStatus(gameID int, status string) error {
+    query := `UPDATE games SET status = $1, last_activity_at = NOW() WHERE id = $2`
+    _, err := s.q.Exec(query, status, gameID)
+    if err != nil {
+        return fmt.Errorf("could not update game status: %v", err)
+    }
+    return nil
+}
+
 
 
 // AddPlayerToGame adds a player to the players table
-func AddPlayerToGame(gameID int, userID int) error {
+func (s *PostgresStore) AddPlayerToGame(gameID int, userID int) error {
     // Проверяем, существует ли игрок в игре
     playerExistsQuery := `SELECT 1 FROM players WHERE game_id = $1 AND user_id = $2`
     var exists bool
-    err := DB.QueryRow(playerExistsQuery, gameID, userID).Scan(&exists)
+    err := s.q.QueryRow(playerExistsQuery, gameID, userID).Scan(&exists)
     if err == sql.ErrNoRows {
         // Если игрок не существует, добавляем его
         insertPlayerQuery := `INSERT INTO players (game_id, user_id, health) VALUES ($1, $2, 4)`
-        _, err = DB.Exec(insertPlayerQuery, gameID, userID)
+        _, err = s.q.Exec(insertPlayerQuery, gameID, userID)
         if err != nil {
             return fmt.Errorf("could not insert player: %v", err)
         }
+        return s.TouchGame(gameID)
     } else if err != nil {
         return fmt.Errorf("could not check player existence: %v", err)
     }
@@ -101,11 +276,21 @@ func AddPlayerToGame(gameID int, userID int) error {
     return nil
 }
 
+// RemovePlayerFromGame removes a player who left the lobby or was kicked
+func (s *PostgresStore) RemovePlayerFromGame(gameID int, userID int) error {
+    query := `DELETE FROM players WHERE game_id = $1 AND user_id = $2`
+    _, err := s.q.Exec(query, gameID, userID)
+    if err != nil {
+        return fmt.Errorf("could not remove player: %v", err)
+    }
+    return s.TouchGame(gameID)
+}
+
 // Getting players who joined the game
 // GetPlayersInGame retrieves players in a game with their usernames
-func GetPlayersInGame(gameID int) ([]map[string]interface{}, error) {
+func (s *PostgresStore) GetPlayersInGame(gameID int) ([]map[string]interface{}, error) {
     query := `
-        SELECT p.id, p.user_id, p.game_id, u.username, p.health,
+        SELECT p.id, p.user_id, p.game_id, u.username, p.health, p.ready,
                COALESCE(r.name, 'No Role') AS role, 
                COALESCE(c.name, 'No Character') AS character
         FROM players p
@@ -113,9 +298,10 @@ func GetPlayersInGame(gameID int) ([]map[string]interface{}, error) {
         LEFT JOIN roles r ON p.role = r.name
         LEFT JOIN characters c ON p.character = c.name
         WHERE p.game_id = $1
+        ORDER BY p.id
     `
 
-    rows, err := DB.Query(query, gameID)
+    rows, err := s.q.Query(query, gameID)
     if err != nil {
         return nil, fmt.Errorf("could not query players: %v", err)
     }
@@ -124,9 +310,10 @@ func GetPlayersInGame(gameID int) ([]map[string]interface{}, error) {
     var players []map[string]interface{}
     for rows.Next() {
         var id, userID, gameID, health int
+        var ready bool
         var username, role, character string
 
-        err := rows.Scan(&id, &userID, &gameID, &username, &health, &role, &character)
+        err := rows.Scan(&id, &userID, &gameID, &username, &health, &ready, &role, &character)
         if err != nil {
             return nil, fmt.Errorf("could not scan player: %v", err)
         }
@@ -137,6 +324,7 @@ func GetPlayersInGame(gameID int) ([]map[string]interface{}, error) {
             "game_id":   gameID,
             "username":  username,
             "health":    health,
+            "ready":     ready,
             "role":      role,
             "character": character,
         }
@@ -148,10 +336,20 @@ func GetPlayersInGame(gameID int) ([]map[string]interface{}, error) {
 }
 
 
+// SetPlayerReady sets the lobby ready flag of a player
+func (s *PostgresStore) SetPlayerReady(gameID int, userID int, ready bool) error {
+    query := `UPDATE players SET ready = $1 WHERE game_id = $2 AND user_id = $3`
+    _, err := s.q.Exec(query, ready, gameID, userID)
+    if err != nil {
+        return fmt.Errorf("could not update player ready: %v", err)
+    }
+    return s.TouchGame(gameID)
+}
+
 // UpdatePlayerRoleAndCharacter updates the role and character of a player
-func UpdatePlayerRoleAndCharacter(playerID int, role string, character string, health int) error {
+func (s *PostgresStore) UpdatePlayerRoleAndCharacter(playerID int, role string, character string, health int) error {
     query := `UPDATE players SET role = $1, character = $2, health = $3 WHERE id = $4`
-    _, err := DB.Exec(query, role, character, health, playerID)
+    _, err := s.q.Exec(query, role, character, health, playerID)
     if err != nil {
         log.Println("Error when UpdatePlayerRoleAndCharacter")
         return fmt.Errorf("could not update player role and character: %v", err)
@@ -159,17 +357,23 @@ func UpdatePlayerRoleAndCharacter(playerID int, role string, character string, h
     return nil
 }
 
-// Dividing Roles
-func GetRolesByPlayerCount(numPlayers int) ([]data.Role, error) {
-    query := `SELECT name, definition FROM roles LIMIT $1`
-    rows, err := DB.Query(query, numPlayers)
+// GetRolesByPlayerCount returns the roles dealt for numPlayers, following the
+// official distribution (Sheriff, Renegade, Outlaws and Deputies)
+func (s *PostgresStore) GetRolesByPlayerCount(numPlayers int) ([]data.Role, error) {
+    distribution := data.RoleDistribution(numPlayers)
+    if distribution == nil {
+        return nil, fmt.Errorf("no role distribution for %d players", numPlayers)
+    }
+
+    query := `SELECT name, definition FROM roles`
+    rows, err := s.q.Query(query)
     if err != nil {
         log.Println("query error in roles")
         return nil, fmt.Errorf("could not query roles: %v", err)
     }
     defer rows.Close()
 
-    var roles []data.Role
+    byName := make(map[string]data.Role)
     for rows.Next() {
         var role data.Role
         err := rows.Scan(&role.Name, &role.Definition)
@@ -177,24 +381,29 @@ func GetRolesByPlayerCount(numPlayers int) ([]data.Role, error) {
             log.Println("Error scanning role")
             return nil, fmt.Errorf("could not scan role: %v", err)
         }
-        roles = append(roles, role)
+        byName[role.Name] = role
     }
 
-    if len(roles) < numPlayers {
-        return nil, fmt.Errorf("not enough roles for %d players", numPlayers)
+    roles := make([]data.Role, 0, numPlayers)
+    for _, name := range distribution {
+        role, ok := byName[name]
+        if !ok {
+            return nil, fmt.Errorf("role %s is not seeded", name)
+        }
+        roles = append(roles, role)
     }
 
     return roles, nil
 }
 
-func GetAvailableCharacters(gameID int, numPlayers int) ([]data.Character, error) {
+func (s *PostgresStore) GetAvailableCharacters(gameID int, numPlayers int) ([]data.Character, error) {
     query := `SELECT c.name, c.definition, c.health 
               FROM characters c
               WHERE NOT EXISTS (
                   SELECT 1 FROM players p
                   WHERE p.character = c.name AND p.game_id = $1
               )`
-    rows, err := DB.Query(query, gameID)
+    rows, err := s.q.Query(query, gameID)
     if err != nil {
         log.Println("Error querying characters")
         return nil, fmt.Errorf("could not query characters: %v", err)
@@ -226,10 +435,10 @@ func GetAvailableCharacters(gameID int, numPlayers int) ([]data.Character, error
 
 
 // CheckPlayerExists проверяет, существует ли игрок в игре
-func CheckPlayerExists(gameID int, userID int) (bool, error) {
+func (s *PostgresStore) CheckPlayerExists(gameID int, userID int) (bool, error) {
     var exists bool
     query := `SELECT 1 FROM players WHERE game_id = $1 AND user_id = $2`
-    err := DB.QueryRow(query, gameID, userID).Scan(&exists)
+    err := s.q.QueryRow(query, gameID, userID).Scan(&exists)
     if err == sql.ErrNoRows {
         return false, nil
     }
@@ -3,32 +3,119 @@ package db
 import (
 	"backend/data"
 	"database/sql"
+	"errors"
 	"fmt"
+	"math/rand"
+	"time"
 )
 
+// ErrNoGameState is returned by InGameTx when the game has no game_state row
+var ErrNoGameState = errors.New("game state not found")
+
+// InGameTx runs fn in a single transaction that holds a row lock on the game's
+// game_state (SELECT ... FOR UPDATE). Every store call made through tx joins
+// the transaction, and any error returned by fn rolls all of them back.
+// A successful transaction bumps the state version, and state is refreshed
+// with the committed row once InGameTx returns. Moves a player makes touch the
+// game's last_activity_at themselves; the turn timer's moves do not.
+func (s *PostgresStore) InGameTx(gameID int, fn func(tx GameProcessStore, state *data.GameState) error) error {
+	// Already inside a transaction: lock the row in it instead of opening a second one
+	if _, nested := s.q.(*sql.Tx); nested {
+		state, err := s.lockGameState(gameID)
+		if err != nil {
+			return err
+		}
+		return fn(s, state)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("could not begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	txStore := &PostgresStore{db: s.db, q: tx}
+	state, err := txStore.lockGameState(gameID)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(txStore, state); err != nil {
+		return err
+	}
+
+	var committed data.GameState
+	err = scanGameState(tx.QueryRow(`
+		UPDATE game_state SET version = version + 1 WHERE game_id = $1
+		RETURNING `+gameStateColumns, gameID), &committed)
+	if err != nil {
+		return fmt.Errorf("could not bump game state version: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("could not commit transaction: %v", err)
+	}
+	*state = committed
+	return nil
+}
+
+// lockGameState reads the game state and locks its row until the transaction ends
+func (s *PostgresStore) lockGameState(gameID int) (*data.GameState, error) {
+	query := `SELECT ` + gameStateColumns + ` FROM game_state WHERE game_id = $1 FOR UPDATE`
+	state := &data.GameState{}
+	err := scanGameState(s.q.QueryRow(query, gameID), state)
+	if err == sql.ErrNoRows {
+		return nil, ErrNoGameState
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not lock game state: %v", err)
+	}
+	return state, nil
+}
+
+// gameStateColumns are selected by every query that returns a data.GameState
+const gameStateColumns = `game_id, current_turn, current_phase, pending_from, pending_target,
+	turn_deadline, response_deadline, version`
+
+// rowScanner is a *sql.Row or *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanGameState reads a row of gameStateColumns into state
+func scanGameState(row rowScanner, state *data.GameState) error {
+	return row.Scan(&state.ID, &state.CurrentTurn, &state.CurrentPhase, &state.PendingFrom, &state.PendingTarget,
+		&state.TurnDeadline, &state.ResponseDeadline, &state.Version)
+}
 
-// GenerateDeck fills the deck for a new game based on card copies
-func GenerateDeck(gameID int) error {
+// GenerateDeck fills the deck for a new game based on card copies, in random order
+func (s *PostgresStore) GenerateDeck(gameID int) error {
 	query := `SELECT id, copies FROM cards`
-	rows, err := DB.Query(query)
+	rows, err := s.q.Query(query)
 	if err != nil {
 		return fmt.Errorf("could not query cards: %v", err)
 	}
 	defer rows.Close()
 
-	var position int
+	var cardIDs []int
 	for rows.Next() {
 		var cardID, copies int
 		if err := rows.Scan(&cardID, &copies); err != nil {
 			return fmt.Errorf("could not scan card: %v", err)
 		}
-
 		for i := 0; i < copies; i++ {
-			position++
-			_, err := DB.Exec(`INSERT INTO deck (game_id, card_id, position) VALUES ($1, $2, $3)`, gameID, cardID, position)
-			if err != nil {
-				return fmt.Errorf("could not insert card into deck: %v", err)
-			}
+			cardIDs = append(cardIDs, cardID)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("could not query cards: %v", err)
+	}
+
+	rand.Shuffle(len(cardIDs), func(i, j int) { cardIDs[i], cardIDs[j] = cardIDs[j], cardIDs[i] })
+	for i, cardID := range cardIDs {
+		_, err := s.q.Exec(`INSERT INTO deck (game_id, card_id, position) VALUES ($1, $2, $3)`, gameID, cardID, i+1)
+		if err != nil {
+			return fmt.Errorf("could not insert card into deck: %v", err)
 		}
 	}
 
@@ -36,34 +123,38 @@ func GenerateDeck(gameID int) error {
 }
 
 // DrawCard draws a card from the deck for a specific game
-func DrawCard(gameID int) (*data.Card, error) {
+func (s *PostgresStore) DrawCard(gameID int) (*data.Card, error) {
+	// Remove only the top row; other copies of the same card stay in the deck
 	query := `
-		SELECT d.card_id, c.name, c.type, c.description 
-		FROM deck d
-		JOIN cards c ON d.card_id = c.id
-		WHERE d.game_id = $1
-		ORDER BY d.position ASC
-		LIMIT 1`
+		DELETE FROM deck
+		WHERE ctid = (
+			SELECT ctid FROM deck
+			WHERE game_id = $1
+			ORDER BY position ASC
+			LIMIT 1
+		)
+		RETURNING card_id`
 
-	var card data.Card
-	err := DB.QueryRow(query, gameID).Scan(&card.ID, &card.Name, &card.Type, &card.Description)
+	var cardID int
+	err := s.q.QueryRow(query, gameID).Scan(&cardID)
 	if err != nil {
 		return nil, fmt.Errorf("could not draw card: %v", err)
 	}
 
-	// Remove the drawn card from the deck
-	_, err = DB.Exec(`DELETE FROM deck WHERE game_id = $1 AND card_id = $2`, gameID, card.ID)
+	var card data.Card
+	err = s.q.QueryRow(`SELECT id, name, type, description FROM cards WHERE id = $1`, cardID).
+		Scan(&card.ID, &card.Name, &card.Type, &card.Description)
 	if err != nil {
-		return nil, fmt.Errorf("could not remove card from deck: %v", err)
+		return nil, fmt.Errorf("could not read drawn card: %v", err)
 	}
 
 	return &card, nil
 }
 
 // DiscardCard adds a card to the discard pile
-func DiscardCard(gameID int, cardID int) error {
+func (s *PostgresStore) DiscardCard(gameID int, cardID int) error {
 	query := `INSERT INTO discard_pile (game_id, card_id) VALUES ($1, $2)`
-	_, err := DB.Exec(query, gameID, cardID)
+	_, err := s.q.Exec(query, gameID, cardID)
 	if err != nil {
 		return fmt.Errorf("could not discard card: %v", err)
 	}
@@ -71,9 +162,9 @@ func DiscardCard(gameID int, cardID int) error {
 }
 
 // ShuffleDiscardIntoDeck moves the discard pile back into the deck and shuffles it
-func ShuffleDiscardIntoDeck(gameID int) error {
+func (s *PostgresStore) ShuffleDiscardIntoDeck(gameID int) error {
 	query := `SELECT card_id FROM discard_pile WHERE game_id = $1`
-	rows, err := DB.Query(query, gameID)
+	rows, err := s.q.Query(query, gameID)
 	if err != nil {
 		return fmt.Errorf("could not query discard pile: %v", err)
 	}
@@ -87,14 +178,14 @@ func ShuffleDiscardIntoDeck(gameID int) error {
 		}
 
 		position++
-		_, err := DB.Exec(`INSERT INTO deck (game_id, card_id, position) VALUES ($1, $2, $3)`, gameID, cardID, position)
+		_, err := s.q.Exec(`INSERT INTO deck (game_id, card_id, position) VALUES ($1, $2, $3)`, gameID, cardID, position)
 		if err != nil {
 			return fmt.Errorf("could not insert card into deck: %v", err)
 		}
 	}
 
 	// Clear the discard pile
-	_, err = DB.Exec(`DELETE FROM discard_pile WHERE game_id = $1`, gameID)
+	_, err = s.q.Exec(`DELETE FROM discard_pile WHERE game_id = $1`, gameID)
 	if err != nil {
 		return fmt.Errorf("could not clear discard pile: %v", err)
 	}
@@ -102,11 +193,23 @@ func ShuffleDiscardIntoDeck(gameID int) error {
 	return nil
 }
 
+// CreateGameState inserts the game_state row of a game that is starting
+func (s *PostgresStore) CreateGameState(state *data.GameState) error {
+	query := `
+		INSERT INTO game_state (game_id, current_turn, current_phase, turn_deadline)
+		VALUES ($1, $2, $3, $4)
+		RETURNING ` + gameStateColumns
+	if err := scanGameState(s.q.QueryRow(query, state.ID, state.CurrentTurn, state.CurrentPhase, state.TurnDeadline), state); err != nil {
+		return fmt.Errorf("could not create game state: %v", err)
+	}
+	return nil
+}
+
 // GetGameState retrieves the current game state for a specific game
-func GetGameState(gameID int) (*data.GameState, error) {
-	query := `SELECT current_turn, current_phase FROM game_state WHERE game_id = $1`
+func (s *PostgresStore) GetGameState(gameID int) (*data.GameState, error) {
+	query := `SELECT ` + gameStateColumns + ` FROM game_state WHERE game_id = $1`
 	gameState := &data.GameState{}
-	err := DB.QueryRow(query, gameID).Scan(&gameState.CurrentTurn, &gameState.CurrentPhase)
+	err := scanGameState(s.q.QueryRow(query, gameID), gameState)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
@@ -116,10 +219,35 @@ func GetGameState(gameID int) (*data.GameState, error) {
 	return gameState, nil
 }
 
+// GetPlayerHand lists the cards in a player's hand
+func (s *PostgresStore) GetPlayerHand(userID int, gameID int) ([]data.Card, error) {
+	query := `
+		SELECT c.id, c.name, c.type, c.description
+		FROM player_hand ph
+		JOIN cards c ON ph.card_id = c.id
+		WHERE ph.user_id = $1 AND ph.game_id = $2
+		ORDER BY c.id`
+	rows, err := s.q.Query(query, userID, gameID)
+	if err != nil {
+		return nil, fmt.Errorf("could not query player hand: %v", err)
+	}
+	defer rows.Close()
+
+	var hand []data.Card
+	for rows.Next() {
+		var card data.Card
+		if err := rows.Scan(&card.ID, &card.Name, &card.Type, &card.Description); err != nil {
+			return nil, fmt.Errorf("could not scan hand card: %v", err)
+		}
+		hand = append(hand, card)
+	}
+	return hand, rows.Err()
+}
+
 // AddCardToPlayerHand adds a card to the player's hand
-func AddCardToPlayerHand(userID int, gameID int, cardID int) error {
+func (s *PostgresStore) AddCardToPlayerHand(userID int, gameID int, cardID int) error {
 	query := `INSERT INTO player_hand (user_id, game_id, card_id) VALUES ($1, $2, $3)`
-	_, err := DB.Exec(query, userID, gameID, cardID)
+	_, err := s.q.Exec(query, userID, gameID, cardID)
 	if err != nil {
 		return fmt.Errorf("could not add card to player hand: %v", err)
 	}
@@ -127,9 +255,9 @@ func AddCardToPlayerHand(userID int, gameID int, cardID int) error {
 }
 
 // UpdateGameStatePhase updates the current phase of the game
-func UpdateGameStatePhase(gameID int, phase string) error {
+func (s *PostgresStore) UpdateGameStatePhase(gameID int, phase string) error {
 	query := `UPDATE game_state SET current_phase = $1 WHERE game_id = $2`
-	_, err := DB.Exec(query, phase, gameID)
+	_, err := s.q.Exec(query, phase, gameID)
 	if err != nil {
 		return fmt.Errorf("could not update game phase: %v", err)
 	}
@@ -137,9 +265,16 @@ func UpdateGameStatePhase(gameID int, phase string) error {
 }
 
 // RemoveCardFromPlayerHand removes a card from a player's hand
-func RemoveCardFromPlayerHand(userID int, gameID int, cardID int) error {
-	query := `DELETE FROM player_hand WHERE user_id = $1 AND game_id = $2 AND card_id = $3`
-	_, err := DB.Exec(query, userID, gameID, cardID)
+func (s *PostgresStore) RemoveCardFromPlayerHand(userID int, gameID int, cardID int) error {
+	// Remove a single copy even when the hand holds several of the same card
+	query := `
+		DELETE FROM player_hand
+		WHERE ctid = (
+			SELECT ctid FROM player_hand
+			WHERE user_id = $1 AND game_id = $2 AND card_id = $3
+			LIMIT 1
+		)`
+	_, err := s.q.Exec(query, userID, gameID, cardID)
 	if err != nil {
 		return fmt.Errorf("could not remove card from player hand: %v", err)
 	}
@@ -147,10 +282,10 @@ func RemoveCardFromPlayerHand(userID int, gameID int, cardID int) error {
 }
 
 // GetCardByID retrieves a card by its ID
-func GetCardByID(cardID int) (*data.Card, error) {
+func (s *PostgresStore) GetCardByID(cardID int) (*data.Card, error) {
 	query := `SELECT id, name, type, description FROM cards WHERE id = $1`
 	card := &data.Card{}
-	err := DB.QueryRow(query, cardID).Scan(&card.ID, &card.Name, &card.Type, &card.Description)
+	err := s.q.QueryRow(query, cardID).Scan(&card.ID, &card.Name, &card.Type, &card.Description)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
@@ -161,14 +296,15 @@ func GetCardByID(cardID int) (*data.Card, error) {
 }
 
 // GetNextPlayerID retrieves the next player's ID in the turn order
-func GetNextPlayerID(gameID int, currentPlayerID int) (int, error) {
-	query := `SELECT user_id FROM players WHERE game_id = $1 AND user_id > $2 ORDER BY user_id ASC LIMIT 1`
+func (s *PostgresStore) GetNextPlayerID(gameID int, currentPlayerID int) (int, error) {
+	// Выбывшие игроки (health = 0) пропускают ход
+	query := `SELECT user_id FROM players WHERE game_id = $1 AND user_id > $2 AND health > 0 ORDER BY user_id ASC LIMIT 1`
 	var nextPlayerID int
-	err := DB.QueryRow(query, gameID, currentPlayerID).Scan(&nextPlayerID)
+	err := s.q.QueryRow(query, gameID, currentPlayerID).Scan(&nextPlayerID)
 	if err == sql.ErrNoRows {
 		// If we've reached the end, return the first player
-		query = `SELECT user_id FROM players WHERE game_id = $1 ORDER BY user_id ASC LIMIT 1`
-		err = DB.QueryRow(query, gameID).Scan(&nextPlayerID)
+		query = `SELECT user_id FROM players WHERE game_id = $1 AND health > 0 ORDER BY user_id ASC LIMIT 1`
+		err = s.q.QueryRow(query, gameID).Scan(&nextPlayerID)
 	}
 	if err != nil {
 		return 0, fmt.Errorf("could not get next player: %v", err)
@@ -177,19 +313,150 @@ func GetNextPlayerID(gameID int, currentPlayerID int) (int, error) {
 }
 
 // UpdateGameStateTurn updates the current turn in the game state
-func UpdateGameStateTurn(gameID int, nextPlayerID int) error {
+func (s *PostgresStore) UpdateGameStateTurn(gameID int, nextPlayerID int) error {
 	query := `UPDATE game_state SET current_turn = $1 WHERE game_id = $2`
-	_, err := DB.Exec(query, nextPlayerID, gameID)
+	_, err := s.q.Exec(query, nextPlayerID, gameID)
 	if err != nil {
 		return fmt.Errorf("could not update game turn: %v", err)
 	}
 	return nil
 }
 
+// UpdateGameStatePending records the Bang! targetID has to answer; a zero
+// targetID clears it
+func (s *PostgresStore) UpdateGameStatePending(gameID int, fromID int, targetID int) error {
+	query := `UPDATE game_state SET pending_from = $1, pending_target = $2 WHERE game_id = $3`
+	_, err := s.q.Exec(query, fromID, targetID, gameID)
+	if err != nil {
+		return fmt.Errorf("could not update pending attack: %v", err)
+	}
+	return nil
+}
+
+// UpdateGameStateTurnDeadline sets when the current turn runs out; nil for never
+func (s *PostgresStore) UpdateGameStateTurnDeadline(gameID int, deadline *time.Time) error {
+	query := `UPDATE game_state SET turn_deadline = $1 WHERE game_id = $2`
+	_, err := s.q.Exec(query, deadline, gameID)
+	if err != nil {
+		return fmt.Errorf("could not update turn deadline: %v", err)
+	}
+	return nil
+}
+
+// UpdateGameStateResponseDeadline sets when the pending response runs out; nil for never
+func (s *PostgresStore) UpdateGameStateResponseDeadline(gameID int, deadline *time.Time) error {
+	query := `UPDATE game_state SET response_deadline = $1 WHERE game_id = $2`
+	_, err := s.q.Exec(query, deadline, gameID)
+	if err != nil {
+		return fmt.Errorf("could not update response deadline: %v", err)
+	}
+	return nil
+}
+
+// GetGameStatesWithDeadlines lists the state of every game with a running
+// timer, so timers can be rescheduled after a restart
+func (s *PostgresStore) GetGameStatesWithDeadlines() ([]data.GameState, error) {
+	query := `SELECT ` + gameStateColumns + ` FROM game_state
+		WHERE turn_deadline IS NOT NULL OR response_deadline IS NOT NULL`
+	rows, err := s.q.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("could not query game deadlines: %v", err)
+	}
+	defer rows.Close()
+
+	var states []data.GameState
+	for rows.Next() {
+		var state data.GameState
+		if err := scanGameState(rows, &state); err != nil {
+			return nil, fmt.Errorf("could not scan game state: %v", err)
+		}
+		states = append(states, state)
+	}
+	return states, rows.Err()
+}
+
+// GetGamePlayers lists the players of a game with their roles and health, in
+// the order they joined
+func (s *PostgresStore) GetGamePlayers(gameID int) ([]data.Player, error) {
+	query := `
+		SELECT id, game_id, user_id, COALESCE(role, ''), health, COALESCE(character, ''), ready
+		FROM players WHERE game_id = $1 ORDER BY id`
+	rows, err := s.q.Query(query, gameID)
+	if err != nil {
+		return nil, fmt.Errorf("could not query players: %v", err)
+	}
+	defer rows.Close()
+
+	var players []data.Player
+	for rows.Next() {
+		var p data.Player
+		err := rows.Scan(&p.ID, &p.GameID, &p.UserID, &p.Role, &p.Health, &p.Character, &p.Ready)
+		if err != nil {
+			return nil, fmt.Errorf("could not scan player: %v", err)
+		}
+		players = append(players, p)
+	}
+	return players, rows.Err()
+}
+
+// SetPlayerHealth sets the player's health; 0 means eliminated
+func (s *PostgresStore) SetPlayerHealth(gameID int, userID int, health int) error {
+	query := `UPDATE players SET health = $1 WHERE game_id = $2 AND user_id = $3`
+	_, err := s.q.Exec(query, health, gameID, userID)
+	if err != nil {
+		return fmt.Errorf("could not set player's health: %v", err)
+	}
+	return nil
+}
+
+// DiscardPlayerCards moves every card in the player's hand and on their board
+// to the discard pile
+func (s *PostgresStore) DiscardPlayerCards(userID int, gameID int) error {
+	queries := []string{
+		`INSERT INTO discard_pile (game_id, card_id)
+			SELECT game_id, card_id FROM player_hand WHERE user_id = $1 AND game_id = $2
+			UNION ALL
+			SELECT game_id, card_id FROM player_board WHERE user_id = $1 AND game_id = $2`,
+		`DELETE FROM player_hand WHERE user_id = $1 AND game_id = $2`,
+		`DELETE FROM player_board WHERE user_id = $1 AND game_id = $2`,
+	}
+	for _, query := range queries {
+		if _, err := s.q.Exec(query, userID, gameID); err != nil {
+			return fmt.Errorf("could not discard player's cards: %v", err)
+		}
+	}
+	return nil
+}
+
+// ArchiveGameCards moves the deck, discard pile, hands and boards of a game
+// into the archive tables and returns how many cards were moved
+func (s *PostgresStore) ArchiveGameCards(gameID int) (int64, error) {
+	queries := []string{
+		`WITH moved AS (DELETE FROM deck WHERE game_id = $1 RETURNING game_id, card_id, position)
+			INSERT INTO archived_deck (game_id, card_id, position) SELECT * FROM moved`,
+		`WITH moved AS (DELETE FROM discard_pile WHERE game_id = $1 RETURNING game_id, card_id)
+			INSERT INTO archived_discard_pile (game_id, card_id) SELECT * FROM moved`,
+		`WITH moved AS (DELETE FROM player_hand WHERE game_id = $1 RETURNING user_id, game_id, card_id)
+			INSERT INTO archived_player_hand (user_id, game_id, card_id) SELECT * FROM moved`,
+		`WITH moved AS (DELETE FROM player_board WHERE game_id = $1 RETURNING user_id, game_id, card_id)
+			INSERT INTO archived_player_board (user_id, game_id, card_id) SELECT * FROM moved`,
+	}
+	var archived int64
+	for _, query := range queries {
+		result, err := s.q.Exec(query, gameID)
+		if err != nil {
+			return archived, fmt.Errorf("could not archive cards: %v", err)
+		}
+		n, _ := result.RowsAffected()
+		archived += n
+	}
+	return archived, nil
+}
+
 // DecreasePlayerHealth decreases the player's health by 1
-func DecreasePlayerHealth(userID int) error {
-	query := `UPDATE players SET health = health - 1 WHERE user_id = $1 AND health > 0`
-	_, err := DB.Exec(query, userID)
+func (s *PostgresStore) DecreasePlayerHealth(gameID int, userID int) error {
+	query := `UPDATE players SET health = health - 1 WHERE game_id = $1 AND user_id = $2 AND health > 0`
+	_, err := s.q.Exec(query, gameID, userID)
 	if err != nil {
 		return fmt.Errorf("could not decrease player's health: %v", err)
 	}
@@ -197,9 +464,9 @@ func DecreasePlayerHealth(userID int) error {
 }
 
 // IncreasePlayerHealth increases the player's health by 1
-func IncreasePlayerHealth(userID int) error {
-	query := `UPDATE players SET health = health + 1 WHERE user_id = $1`
-	_, err := DB.Exec(query, userID)
+func (s *PostgresStore) IncreasePlayerHealth(gameID int, userID int) error {
+	query := `UPDATE players SET health = health + 1 WHERE game_id = $1 AND user_id = $2`
+	_, err := s.q.Exec(query, gameID, userID)
 	if err != nil {
 		return fmt.Errorf("could not increase player's health: %v", err)
 	}
@@ -207,7 +474,7 @@ func IncreasePlayerHealth(userID int) error {
 }
 
 // CheckPlayerHasCard checks if a player has a specific card
-func CheckPlayerHasCard(userID int, gameID int, cardName string) (bool, error) {
+func (s *PostgresStore) CheckPlayerHasCard(userID int, gameID int, cardName string) (bool, error) {
 	query := `
 		SELECT 1
 		FROM player_hand ph
@@ -215,7 +482,7 @@ func CheckPlayerHasCard(userID int, gameID int, cardName string) (bool, error) {
 		WHERE ph.user_id = $1 AND ph.game_id = $2 AND c.name = $3`
 
 	var exists bool
-	err := DB.QueryRow(query, userID, gameID, cardName).Scan(&exists)
+	err := s.q.QueryRow(query, userID, gameID, cardName).Scan(&exists)
 	if err == sql.ErrNoRows {
 		return false, nil
 	}
@@ -227,10 +494,10 @@ func CheckPlayerHasCard(userID int, gameID int, cardName string) (bool, error) {
 }
 
 // GetCardIDByName retrieves the card ID by its name
-func GetCardIDByName(cardName string) (int, error) {
+func (s *PostgresStore) GetCardIDByName(cardName string) (int, error) {
 	query := `SELECT id FROM cards WHERE name = $1`
 	var cardID int
-	err := DB.QueryRow(query, cardName).Scan(&cardID)
+	err := s.q.QueryRow(query, cardName).Scan(&cardID)
 	if err != nil {
 		return 0, fmt.Errorf("could not retrieve card ID: %v", err)
 	}
@@ -238,9 +505,9 @@ func GetCardIDByName(cardName string) (int, error) {
 }
 
 // AddCardToPlayerBoard adds a card to the player's board
-func AddCardToPlayerBoard(userID int, gameID int, cardID int) error {
+func (s *PostgresStore) AddCardToPlayerBoard(userID int, gameID int, cardID int) error {
 	query := `INSERT INTO player_board (user_id, game_id, card_id) VALUES ($1, $2, $3)`
-	_, err := DB.Exec(query, userID, gameID, cardID)
+	_, err := s.q.Exec(query, userID, gameID, cardID)
 	if err != nil {
 		return fmt.Errorf("could not add card to player board: %v", err)
 	}
@@ -248,7 +515,7 @@ func AddCardToPlayerBoard(userID int, gameID int, cardID int) error {
 }
 
 // CheckPlayerHasCardByName checks if a player has a specific card by its name
-func CheckPlayerHasCardByName(userID int, gameID int, cardName string) (bool, int, error) {
+func (s *PostgresStore) CheckPlayerHasCardByName(userID int, gameID int, cardName string) (bool, int, error) {
 	query := `
 		SELECT ph.card_id
 		FROM player_hand ph
@@ -256,7 +523,7 @@ func CheckPlayerHasCardByName(userID int, gameID int, cardName string) (bool, in
 		WHERE ph.user_id = $1 AND ph.game_id = $2 AND c.name = $3`
 
 	var cardID int
-	err := DB.QueryRow(query, userID, gameID, cardName).Scan(&cardID)
+	err := s.q.QueryRow(query, userID, gameID, cardName).Scan(&cardID)
 	if err == sql.ErrNoRows {
 		return false, 0, nil
 	}
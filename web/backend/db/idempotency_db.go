@@ -0,0 +1,90 @@
+package db
+
+import (
+	"backend/data"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrIdempotencyInProgress means the first request with this key has not finished yet
+	ErrIdempotencyInProgress = errors.New("a request with this idempotency key is in progress")
+	// ErrIdempotencyKeyReused means the key was already used for a different request
+	ErrIdempotencyKeyReused = errors.New("idempotency key was used for a different request")
+)
+
+// ReserveIdempotencyKey claims a key for the user, replacing it if it expired
+func (s *PostgresStore) ReserveIdempotencyKey(userID int, key string, fingerprint string, expiredBefore time.Time) (*data.IdempotentResponse, error) {
+	query := `
+		INSERT INTO idempotency_keys (user_id, key, fingerprint) VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, key) DO UPDATE
+			SET fingerprint = EXCLUDED.fingerprint, status = NULL, headers = '{}', body = NULL, created_at = NOW()
+			WHERE idempotency_keys.created_at < $4
+		RETURNING user_id`
+	var reserved int
+	err := s.q.QueryRow(query, userID, key, fingerprint, expiredBefore).Scan(&reserved)
+	if err == nil {
+		return nil, nil
+	}
+	if err != sql.ErrNoRows {
+		return nil, fmt.Errorf("could not reserve idempotency key: %v", err)
+	}
+
+	// The key is live: replay it, or report why it cannot be used
+	var storedFingerprint string
+	var status sql.NullInt64
+	var headers []byte
+	var body []byte
+	query = `SELECT fingerprint, status, headers, body FROM idempotency_keys WHERE user_id = $1 AND key = $2`
+	err = s.q.QueryRow(query, userID, key).Scan(&storedFingerprint, &status, &headers, &body)
+	if err != nil {
+		return nil, fmt.Errorf("could not read idempotency key: %v", err)
+	}
+	if storedFingerprint != fingerprint {
+		return nil, ErrIdempotencyKeyReused
+	}
+	if !status.Valid {
+		return nil, ErrIdempotencyInProgress
+	}
+
+	response := &data.IdempotentResponse{Status: int(status.Int64), Body: body}
+	if err := json.Unmarshal(headers, &response.Headers); err != nil {
+		return nil, fmt.Errorf("could not decode stored headers: %v", err)
+	}
+	return response, nil
+}
+
+// CompleteIdempotencyKey stores the response of the request that reserved the key
+func (s *PostgresStore) CompleteIdempotencyKey(userID int, key string, response *data.IdempotentResponse) error {
+	headers, err := json.Marshal(response.Headers)
+	if err != nil {
+		return fmt.Errorf("could not encode headers: %v", err)
+	}
+	query := `UPDATE idempotency_keys SET status = $1, headers = $2, body = $3 WHERE user_id = $4 AND key = $5`
+	_, err = s.q.Exec(query, response.Status, headers, response.Body, userID, key)
+	if err != nil {
+		return fmt.Errorf("could not store idempotent response: %v", err)
+	}
+	return nil
+}
+
+// ReleaseIdempotencyKey forgets a reservation so the request can be retried
+func (s *PostgresStore) ReleaseIdempotencyKey(userID int, key string) error {
+	_, err := s.q.Exec(`DELETE FROM idempotency_keys WHERE user_id = $1 AND key = $2`, userID, key)
+	if err != nil {
+		return fmt.Errorf("could not release idempotency key: %v", err)
+	}
+	return nil
+}
+
+// DeleteExpiredIdempotencyKeys removes keys older than the retention window
+func (s *PostgresStore) DeleteExpiredIdempotencyKeys(expiredBefore time.Time) (int64, error) {
+	result, err := s.q.Exec(`DELETE FROM idempotency_keys WHERE created_at < $1`, expiredBefore)
+	if err != nil {
+		return 0, fmt.Errorf("could not delete expired idempotency keys: %v", err)
+	}
+	return result.RowsAffected()
+}
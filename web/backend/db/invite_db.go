@@ -0,0 +1,77 @@
+package db
+
+import (
+	"backend/data"
+	"fmt"
+)
+
+// inviteQuery selects invites with the names of their game and inviter
+const inviteQuery = `
+	SELECT i.game_id, g.game_name, i.user_id, i.inviter_id, u.username, i.status, i.created_at
+	FROM game_invites i
+	JOIN games g ON g.id = i.game_id
+	JOIN users u ON u.id = i.inviter_id`
+
+// CreateInvite invites a user to a game. Inviting them again renews a
+// declined invite as pending.
+func (s *PostgresStore) CreateInvite(invite *data.GameInvite) error {
+	query := `
+		INSERT INTO game_invites (game_id, user_id, inviter_id, status) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (game_id, user_id) DO UPDATE
+			SET inviter_id = EXCLUDED.inviter_id, status = EXCLUDED.status, created_at = NOW()
+		RETURNING created_at`
+	invite.Status = data.InvitePending
+	err := s.q.QueryRow(query, invite.GameID, invite.UserID, invite.InviterID, invite.Status).Scan(&invite.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("could not insert invite: %v", err)
+	}
+	return nil
+}
+
+// GetInvite retrieves the invite of a user to a game
+func (s *PostgresStore) GetInvite(gameID int, userID int) (*data.GameInvite, error) {
+	invites, err := s.queryInvites(inviteQuery+` WHERE i.game_id = $1 AND i.user_id = $2`, gameID, userID)
+	if err != nil || len(invites) == 0 {
+		return nil, err
+	}
+	return &invites[0], nil
+}
+
+// GetGameInvites lists every invite to a game, oldest first
+func (s *PostgresStore) GetGameInvites(gameID int) ([]data.GameInvite, error) {
+	return s.queryInvites(inviteQuery+` WHERE i.game_id = $1 ORDER BY i.created_at, i.user_id`, gameID)
+}
+
+// GetUserInvites lists the invites of a user in status, newest first
+func (s *PostgresStore) GetUserInvites(userID int, status string) ([]data.GameInvite, error) {
+	return s.queryInvites(inviteQuery+` WHERE i.user_id = $1 AND i.status = $2 ORDER BY i.created_at DESC`, userID, status)
+}
+
+// SetInviteStatus records the user's answer to an invite
+func (s *PostgresStore) SetInviteStatus(gameID int, userID int, status string) error {
+	query := `UPDATE game_invites SET status = $1 WHERE game_id = $2 AND user_id = $3`
+	if _, err := s.q.Exec(query, status, gameID, userID); err != nil {
+		return fmt.Errorf("could not update invite: %v", err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) queryInvites(query string, args ...interface{}) ([]data.GameInvite, error) {
+	rows, err := s.q.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("could not query invites: %v", err)
+	}
+	defer rows.Close()
+
+	invites := []data.GameInvite{}
+	for rows.Next() {
+		var invite data.GameInvite
+		err := rows.Scan(&invite.GameID, &invite.GameName, &invite.UserID, &invite.InviterID,
+			&invite.InviterName, &invite.Status, &invite.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("could not scan invite: %v", err)
+		}
+		invites = append(invites, invite)
+	}
+	return invites, rows.Err()
+}
@@ -0,0 +1,1456 @@
+package db
+
+import (
+	"backend/data"
+	"cmp"
+	"fmt"
+	"math/rand"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryStore is an in-process Store used for tests and for running the API
+// without PostgreSQL. It mirrors the behaviour of PostgresStore, including
+// returning nil, nil for rows that do not exist.
+type MemoryStore struct {
+	mu sync.Mutex
+
+	users      map[int]*data.User
+	games      map[int]*data.Game
+	players    map[int]*data.Player
+	roles      []data.Role
+	characters []data.Character
+	cards      []data.Card
+	states     map[int]*data.GameState
+	decks      map[int][]deckEntry
+	discards   map[int][]int
+	hands      []cardEntry
+	boards     []cardEntry
+	archive    map[int]*archivedCards
+	invites    map[inviteKey]*data.GameInvite
+	chat       []data.ChatMessage // oldest first
+	relations  map[relationKey]*relation
+
+	nextUserID   int
+	nextGameID   int
+	nextPlayerID int
+	nextChatID   int64
+
+	// gameLocks serialise InGameTx calls per game, like the row lock in Postgres
+	gameLocks map[int]*sync.Mutex
+	// lobbyLocks do the same for InLobbyTx and the games row
+	lobbyLocks map[int]*sync.Mutex
+
+	idempotency map[idempotencyKey]*idempotencyEntry
+}
+
+type relationKey struct {
+	userID  int
+	otherID int
+}
+
+type relation struct {
+	status    string
+	createdAt time.Time
+}
+
+type inviteKey struct {
+	gameID int
+	userID int
+}
+
+type idempotencyKey struct {
+	userID int
+	key    string
+}
+
+type idempotencyEntry struct {
+	fingerprint string
+	response    *data.IdempotentResponse // nil while the request is running
+	createdAt   time.Time
+}
+
+type deckEntry struct {
+	cardID   int
+	position int
+}
+
+type cardEntry struct {
+	userID int
+	gameID int
+	cardID int
+}
+
+// archivedCards are the cards of a game the janitor ended
+type archivedCards struct {
+	deck    []deckEntry
+	discard []int
+	hands   []cardEntry
+	boards  []cardEntry
+}
+
+// NewMemoryStore returns an empty store preloaded with the base-game catalog
+func NewMemoryStore() *MemoryStore {
+	s := &MemoryStore{
+		users:     make(map[int]*data.User),
+		games:     make(map[int]*data.Game),
+		players:   make(map[int]*data.Player),
+		states:    make(map[int]*data.GameState),
+		decks:     make(map[int][]deckEntry),
+		discards:  make(map[int][]int),
+		archive:   make(map[int]*archivedCards),
+		invites:   make(map[inviteKey]*data.GameInvite),
+		relations: make(map[relationKey]*relation),
+		gameLocks: make(map[int]*sync.Mutex),
+
+		lobbyLocks: make(map[int]*sync.Mutex),
+
+		idempotency: make(map[idempotencyKey]*idempotencyEntry),
+	}
+	s.roles = append(s.roles, data.BaseRoles...)
+	s.characters = append(s.characters, data.BaseCharacters...)
+	for i, card := range data.BaseCards {
+		card.ID = i + 1
+		s.cards = append(s.cards, card)
+	}
+	return s
+}
+
+// SetGameState creates or replaces the game_state row of a game
+func (s *MemoryStore) SetGameState(gameID int, state data.GameState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state.ID = gameID
+	s.states[gameID] = &state
+}
+
+// InGameTx serialises fn against other transactions on the same game and
+// restores every row of the game if fn returns an error. On success it bumps
+// the state version like PostgresStore does.
+func (s *MemoryStore) InGameTx(gameID int, fn func(tx GameProcessStore, state *data.GameState) error) error {
+	lock := s.gameLock(gameID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	s.mu.Lock()
+	current, ok := s.states[gameID]
+	if !ok {
+		s.mu.Unlock()
+		return ErrNoGameState
+	}
+	state := *current
+	snapshot := s.snapshotGame(gameID)
+	s.mu.Unlock()
+
+	if err := fn(memoryTx{MemoryStore: s, gameID: gameID}, &state); err != nil {
+		s.mu.Lock()
+		s.restoreGame(gameID, snapshot)
+		s.mu.Unlock()
+		return err
+	}
+
+	s.mu.Lock()
+	if current, ok := s.states[gameID]; ok {
+		current.Version++
+		state = *current
+	}
+	s.mu.Unlock()
+	return nil
+}
+
+// InLobbyTx serialises fn against other lobby transactions on the same game
+// and restores every row of the game if fn returns an error
+func (s *MemoryStore) InLobbyTx(gameID int, fn func(tx GameStore, game *data.Game) error) error {
+	lock := lockFor(&s.mu, s.lobbyLocks, gameID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	s.mu.Lock()
+	current, ok := s.games[gameID]
+	if !ok {
+		s.mu.Unlock()
+		return ErrNoGame
+	}
+	game := *current
+	snapshot := s.snapshotGame(gameID)
+	s.mu.Unlock()
+
+	if err := fn(s, &game); err != nil {
+		s.mu.Lock()
+		s.restoreGame(gameID, snapshot)
+		s.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// memoryTx is the store handed to an InGameTx callback. Nested calls for the
+// same game run inline instead of waiting on the lock the caller already holds.
+type memoryTx struct {
+	*MemoryStore
+	gameID int
+}
+
+func (t memoryTx) InGameTx(gameID int, fn func(tx GameProcessStore, state *data.GameState) error) error {
+	if gameID != t.gameID {
+		return t.MemoryStore.InGameTx(gameID, fn)
+	}
+	state, err := t.GetGameState(gameID)
+	if err != nil {
+		return err
+	}
+	if state == nil {
+		return ErrNoGameState
+	}
+	return fn(t, state)
+}
+
+// gameSnapshot holds copies of every row belonging to one game
+type gameSnapshot struct {
+	game    *data.Game
+	state   *data.GameState
+	players []data.Player
+	deck    []deckEntry
+	discard []int
+	hands   []cardEntry
+	boards  []cardEntry
+	archive *archivedCards
+	invites []data.GameInvite
+}
+
+func (s *MemoryStore) gameLock(gameID int) *sync.Mutex {
+	return lockFor(&s.mu, s.gameLocks, gameID)
+}
+
+// lockFor returns the lock of gameID in locks, creating it under mu
+func lockFor(mu *sync.Mutex, locks map[int]*sync.Mutex, gameID int) *sync.Mutex {
+	mu.Lock()
+	defer mu.Unlock()
+	lock, ok := locks[gameID]
+	if !ok {
+		lock = &sync.Mutex{}
+		locks[gameID] = lock
+	}
+	return lock
+}
+
+func (s *MemoryStore) snapshotGame(gameID int) gameSnapshot {
+	snap := gameSnapshot{
+		deck:    append([]deckEntry(nil), s.decks[gameID]...),
+		discard: append([]int(nil), s.discards[gameID]...),
+	}
+	if g, ok := s.games[gameID]; ok {
+		game := *g
+		snap.game = &game
+	}
+	if st, ok := s.states[gameID]; ok {
+		state := *st
+		snap.state = &state
+	}
+	if a, ok := s.archive[gameID]; ok {
+		archived := *a
+		snap.archive = &archived
+	}
+	for key, invite := range s.invites {
+		if key.gameID == gameID {
+			snap.invites = append(snap.invites, *invite)
+		}
+	}
+	for _, p := range s.players {
+		if p.GameID == gameID {
+			snap.players = append(snap.players, *p)
+		}
+	}
+	for _, entry := range s.hands {
+		if entry.gameID == gameID {
+			snap.hands = append(snap.hands, entry)
+		}
+	}
+	for _, entry := range s.boards {
+		if entry.gameID == gameID {
+			snap.boards = append(snap.boards, entry)
+		}
+	}
+	return snap
+}
+
+func (s *MemoryStore) restoreGame(gameID int, snap gameSnapshot) {
+	delete(s.games, gameID)
+	if snap.game != nil {
+		s.games[gameID] = snap.game
+	}
+	delete(s.states, gameID)
+	if snap.state != nil {
+		s.states[gameID] = snap.state
+	}
+	delete(s.archive, gameID)
+	if snap.archive != nil {
+		s.archive[gameID] = snap.archive
+	}
+	for key := range s.invites {
+		if key.gameID == gameID {
+			delete(s.invites, key)
+		}
+	}
+	for i := range snap.invites {
+		s.invites[inviteKey{gameID, snap.invites[i].UserID}] = &snap.invites[i]
+	}
+	for id, p := range s.players {
+		if p.GameID == gameID {
+			delete(s.players, id)
+		}
+	}
+	for i := range snap.players {
+		s.players[snap.players[i].ID] = &snap.players[i]
+	}
+	s.decks[gameID] = snap.deck
+	s.discards[gameID] = snap.discard
+	s.hands = append(withoutGame(s.hands, gameID), snap.hands...)
+	s.boards = append(withoutGame(s.boards, gameID), snap.boards...)
+}
+
+// CreateUser adds a new user to the store
+func (s *MemoryStore) CreateUser(user *data.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, u := range s.users {
+		if u.Username == user.Username {
+			return fmt.Errorf("could not insert user: username %q already exists", user.Username)
+		}
+	}
+	s.nextUserID++
+	user.ID = s.nextUserID
+	if user.CreatedAt.IsZero() {
+		user.CreatedAt = time.Now()
+	}
+	if user.Rating == 0 {
+		user.Rating = data.DefaultRating
+	}
+	stored := *user
+	s.users[user.ID] = &stored
+	return nil
+}
+
+// GetUserByUsername retrieves a user by their username
+func (s *MemoryStore) GetUserByUsername(username string) (*data.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, u := range s.users {
+		if u.Username == username {
+			user := *u
+			return &user, nil
+		}
+	}
+	return nil, nil
+}
+
+// GetUserByID retrieves a user by ID without the password hash
+func (s *MemoryStore) GetUserByID(userID int) (*data.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[userID]
+	if !ok {
+		return nil, nil
+	}
+	user := *u
+	user.Password = ""
+	return &user, nil
+}
+
+// SearchUsers finds users whose name contains query.Query, exact matches
+// first, leaving out those who blocked the viewer
+func (s *MemoryStore) SearchUsers(query data.UserSearch) ([]data.UserSummary, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	needle := strings.ToLower(query.Query)
+	users := []data.UserSummary{}
+	for _, u := range s.users {
+		if u.ID == query.ViewerID || !strings.Contains(strings.ToLower(u.Username), needle) {
+			continue
+		}
+		theirs := s.relations[relationKey{u.ID, query.ViewerID}]
+		if theirs != nil && theirs.status == data.RelationBlocked {
+			continue
+		}
+		user := data.UserSummary{ID: u.ID, Username: u.Username}
+		if mine := s.relations[relationKey{query.ViewerID, u.ID}]; mine != nil {
+			user.Relation = mine.status
+		} else if theirs != nil && theirs.status == data.RelationPending {
+			user.Relation = data.RelationIncoming
+		}
+		users = append(users, user)
+	}
+	slices.SortFunc(users, func(a, b data.UserSummary) int {
+		aExact, bExact := strings.ToLower(a.Username) == needle, strings.ToLower(b.Username) == needle
+		if aExact != bExact {
+			if aExact {
+				return -1
+			}
+			return 1
+		}
+		return cmp.Or(cmp.Compare(strings.ToLower(a.Username), strings.ToLower(b.Username)), cmp.Compare(a.ID, b.ID))
+	})
+	if len(users) > query.Limit {
+		users = users[:query.Limit]
+	}
+	return users, nil
+}
+
+// CreateGame adds a new game to the store
+func (s *MemoryStore) CreateGame(game *data.Game) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextGameID++
+	game.ID = s.nextGameID
+	if game.CreatedAt.IsZero() {
+		game.CreatedAt = time.Now()
+	}
+	game.LastActivityAt = game.CreatedAt
+	stored := *game
+	s.games[game.ID] = &stored
+	return nil
+}
+
+// ListGames returns one page of the games query.ViewerID may see, filtered and
+// ordered as asked, with the number of games matching across all pages
+func (s *MemoryStore) ListGames(query data.GameListQuery) ([]data.GameSummary, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var matching []data.GameSummary
+	for _, id := range sortedKeys(s.games) {
+		g := s.games[id]
+		if g.Visibility != data.VisibilityPublic && s.findPlayer(g.ID, query.ViewerID) == nil {
+			continue
+		}
+		creator, ok := s.users[g.CreatorID]
+		if !ok {
+			continue
+		}
+		players := 0
+		for _, p := range s.players {
+			if p.GameID == g.ID {
+				players++
+			}
+		}
+
+		switch {
+		case query.Status != "" && g.Status != query.Status,
+			query.HasOpenSeat && players >= g.MaxSeats,
+			query.Creator != "" && !strings.EqualFold(creator.Username, query.Creator),
+			query.Search != "" && !strings.Contains(strings.ToLower(g.GameName), strings.ToLower(query.Search)),
+			query.Expansion != "" && !slices.Contains(g.Expansions, query.Expansion):
+			continue
+		}
+
+		matching = append(matching, data.GameSummary{
+			ID:          g.ID,
+			GameName:    g.GameName,
+			CreatorID:   g.CreatorID,
+			CreatorName: creator.Username,
+			Status:      g.Status,
+			Visibility:  g.Visibility,
+			Players:     players,
+			MaxSeats:    g.MaxSeats,
+			Expansions:  append([]string{}, g.Expansions...),
+			CreatedAt:   g.CreatedAt,
+		})
+	}
+
+	// compare orders a before b the way the list is sorted
+	compare := func(a, b data.GameSummary) int {
+		var c int
+		switch query.Sort {
+		case data.GameSortName:
+			c = strings.Compare(a.GameName, b.GameName)
+		default:
+			c = a.CreatedAt.Compare(b.CreatedAt)
+		}
+		if c == 0 {
+			c = cmp.Compare(a.ID, b.ID)
+		}
+		if query.Sort != data.GameSortName && query.Sort != data.GameSortOldest {
+			c = -c
+		}
+		return c
+	}
+	slices.SortFunc(matching, compare)
+
+	games := []data.GameSummary{}
+	for _, game := range matching {
+		if query.After != nil {
+			cursor := data.GameSummary{ID: query.After.ID, GameName: query.After.Key}
+			if query.Sort != data.GameSortName {
+				createdAt, err := time.Parse(time.RFC3339Nano, query.After.Key)
+				if err != nil {
+					return nil, 0, fmt.Errorf("could not parse cursor: %v", err)
+				}
+				cursor.CreatedAt = createdAt
+			}
+			if compare(game, cursor) <= 0 {
+				continue
+			}
+		}
+		if len(games) == query.Limit {
+			break
+		}
+		games = append(games, game)
+	}
+	return games, len(matching), nil
+}
+
+// GetGameByID retrieves a game by its ID
+func (s *MemoryStore) GetGameByID(gameID int) (*data.Game, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g, ok := s.games[gameID]
+	if !ok {
+		return nil, nil
+	}
+	game := *g
+	return &game, nil
+}
+
+// GetGameByInviteCode retrieves the private game an invite code belongs to
+func (s *MemoryStore) GetGameByInviteCode(code string) (*data.Game, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range sortedKeys(s.games) {
+		if g := s.games[id]; g.InviteCode != "" && g.InviteCode == code {
+			game := *g
+			return &game, nil
+		}
+	}
+	return nil, nil
+}
+
+// DeleteGame removes a game together with everything that references it
+func (s *MemoryStore) DeleteGame(gameID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.games, gameID)
+	delete(s.states, gameID)
+	delete(s.decks, gameID)
+	delete(s.discards, gameID)
+	for id, p := range s.players {
+		if p.GameID == gameID {
+			delete(s.players, id)
+		}
+	}
+	s.hands = withoutGame(s.hands, gameID)
+	s.boards = withoutGame(s.boards, gameID)
+	s.chat = slices.DeleteFunc(s.chat, func(m data.ChatMessage) bool { return m.GameID == gameID })
+	for key := range s.invites {
+		if key.gameID == gameID {
+			delete(s.invites, key)
+		}
+	}
+	for _, g := range s.games {
+		if g.RematchOf == gameID {
+			g.RematchOf = 0
+		}
+	}
+	return nil
+}
+
+// UpdateGameCreator hands the game over to another host
+func (s *MemoryStore) UpdateGameCreator(gameID int, userID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if g, ok := s.games[gameID]; ok {
+		g.CreatorID = userID
+		g.LastActivityAt = time.Now()
+	}
+	return nil
+}
+
+// UpdateGameStatus moves a game to status: waiting, in_progress or finished
+func (s *MemoryStore) UpdateGameStatus(gameID int, status string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if g, ok := s.games[gameID]; ok {
+		g.Status = status
+		g.LastActivityAt = time.Now()
+	}
+	return nil
+}
+
+// AddPlayerToGame adds a player unless they already joined
+func (s *MemoryStore) AddPlayerToGame(gameID int, userID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.findPlayer(gameID, userID) != nil {
+		return nil
+	}
+	s.nextPlayerID++
+	s.players[s.nextPlayerID] = &data.Player{ID: s.nextPlayerID, GameID: gameID, UserID: userID, Health: 4}
+	s.touchGame(gameID)
+	return nil
+}
+
+// RemovePlayerFromGame removes a player who left the lobby or was kicked
+func (s *MemoryStore) RemovePlayerFromGame(gameID int, userID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if p := s.findPlayer(gameID, userID); p != nil {
+		delete(s.players, p.ID)
+		s.touchGame(gameID)
+	}
+	return nil
+}
+
+// GetPlayersInGame retrieves players in a game with their usernames
+func (s *MemoryStore) GetPlayersInGame(gameID int) ([]map[string]interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var players []map[string]interface{}
+	for _, id := range sortedKeys(s.players) {
+		p := s.players[id]
+		if p.GameID != gameID {
+			continue
+		}
+		user, ok := s.users[p.UserID]
+		if !ok {
+			continue
+		}
+		role := "No Role"
+		if s.hasRole(p.Role) {
+			role = p.Role
+		}
+		character := "No Character"
+		if s.hasCharacter(p.Character) {
+			character = p.Character
+		}
+		players = append(players, map[string]interface{}{
+			"id":        p.ID,
+			"user_id":   p.UserID,
+			"game_id":   p.GameID,
+			"username":  user.Username,
+			"health":    p.Health,
+			"ready":     p.Ready,
+			"role":      role,
+			"character": character,
+		})
+	}
+	return players, nil
+}
+
+// CheckPlayerExists reports whether the user joined the game
+func (s *MemoryStore) CheckPlayerExists(gameID int, userID int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.findPlayer(gameID, userID) != nil, nil
+}
+
+// SetPlayerReady sets the lobby ready flag of a player
+func (s *MemoryStore) SetPlayerReady(gameID int, userID int, ready bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if p := s.findPlayer(gameID, userID); p != nil {
+		p.Ready = ready
+		s.touchGame(gameID)
+	}
+	return nil
+}
+
+// TouchGame records activity in a game, which keeps the janitor away from it
+func (s *MemoryStore) TouchGame(gameID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.touchGame(gameID)
+	return nil
+}
+
+// touchGame records activity in a game; s.mu must be held
+func (s *MemoryStore) touchGame(gameID int) {
+	if g, ok := s.games[gameID]; ok {
+		g.LastActivityAt = time.Now()
+	}
+}
+
+// GetRematchOf retrieves the rematch created for a finished game
+func (s *MemoryStore) GetRematchOf(gameID int) (*data.Game, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range sortedKeys(s.games) {
+		if g := s.games[id]; g.RematchOf == gameID {
+			game := *g
+			return &game, nil
+		}
+	}
+	return nil, nil
+}
+
+// CreateInvite invites a user to a game. Inviting them again renews a
+// declined invite as pending.
+func (s *MemoryStore) CreateInvite(invite *data.GameInvite) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	invite.Status = data.InvitePending
+	invite.CreatedAt = time.Now()
+	stored := *invite
+	s.invites[inviteKey{invite.GameID, invite.UserID}] = &stored
+	return nil
+}
+
+// GetInvite retrieves the invite of a user to a game
+func (s *MemoryStore) GetInvite(gameID int, userID int) (*data.GameInvite, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	invite, ok := s.invites[inviteKey{gameID, userID}]
+	if !ok {
+		return nil, nil
+	}
+	named := s.namedInvite(invite)
+	return &named, nil
+}
+
+// GetGameInvites lists every invite to a game, oldest first
+func (s *MemoryStore) GetGameInvites(gameID int) ([]data.GameInvite, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	invites := []data.GameInvite{}
+	for _, invite := range s.invites {
+		if invite.GameID == gameID {
+			invites = append(invites, s.namedInvite(invite))
+		}
+	}
+	slices.SortFunc(invites, func(a, b data.GameInvite) int {
+		return cmp.Or(a.CreatedAt.Compare(b.CreatedAt), cmp.Compare(a.UserID, b.UserID))
+	})
+	return invites, nil
+}
+
+// GetUserInvites lists the invites of a user in status, newest first
+func (s *MemoryStore) GetUserInvites(userID int, status string) ([]data.GameInvite, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	invites := []data.GameInvite{}
+	for _, invite := range s.invites {
+		if invite.UserID == userID && invite.Status == status {
+			invites = append(invites, s.namedInvite(invite))
+		}
+	}
+	slices.SortFunc(invites, func(a, b data.GameInvite) int {
+		return cmp.Or(b.CreatedAt.Compare(a.CreatedAt), cmp.Compare(a.GameID, b.GameID))
+	})
+	return invites, nil
+}
+
+// SetInviteStatus records the user's answer to an invite
+func (s *MemoryStore) SetInviteStatus(gameID int, userID int, status string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if invite, ok := s.invites[inviteKey{gameID, userID}]; ok {
+		invite.Status = status
+	}
+	return nil
+}
+
+// namedInvite fills in the names of the invite's game and inviter; s.mu must be held
+func (s *MemoryStore) namedInvite(invite *data.GameInvite) data.GameInvite {
+	named := *invite
+	if g, ok := s.games[invite.GameID]; ok {
+		named.GameName = g.GameName
+	}
+	if u, ok := s.users[invite.InviterID]; ok {
+		named.InviterName = u.Username
+	}
+	return named
+}
+
+// ListIdleGames returns the games in status whose last activity was before idleSince, oldest first
+func (s *MemoryStore) ListIdleGames(status string, idleSince time.Time) ([]*data.Game, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var games []*data.Game
+	for _, id := range sortedKeys(s.games) {
+		if g := s.games[id]; g.Status == status && g.LastActivityAt.Before(idleSince) {
+			game := *g
+			games = append(games, &game)
+		}
+	}
+	sort.SliceStable(games, func(i, j int) bool {
+		return games[i].LastActivityAt.Before(games[j].LastActivityAt)
+	})
+	return games, nil
+}
+
+// ArchiveGameCards moves the deck, discard pile, hands and boards of a game
+// into the archive and returns how many cards were moved
+func (s *MemoryStore) ArchiveGameCards(gameID int) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	archived, ok := s.archive[gameID]
+	if !ok {
+		archived = &archivedCards{}
+		s.archive[gameID] = archived
+	}
+	before := len(archived.deck) + len(archived.discard) + len(archived.hands) + len(archived.boards)
+
+	archived.deck = append(archived.deck, s.decks[gameID]...)
+	archived.discard = append(archived.discard, s.discards[gameID]...)
+	delete(s.decks, gameID)
+	delete(s.discards, gameID)
+	for _, entry := range s.hands {
+		if entry.gameID == gameID {
+			archived.hands = append(archived.hands, entry)
+		}
+	}
+	for _, entry := range s.boards {
+		if entry.gameID == gameID {
+			archived.boards = append(archived.boards, entry)
+		}
+	}
+	s.hands = withoutGame(s.hands, gameID)
+	s.boards = withoutGame(s.boards, gameID)
+
+	after := len(archived.deck) + len(archived.discard) + len(archived.hands) + len(archived.boards)
+	return int64(after - before), nil
+}
+
+// UpdatePlayerRoleAndCharacter updates the role and character of a player
+func (s *MemoryStore) UpdatePlayerRoleAndCharacter(playerID int, role string, character string, health int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if p, ok := s.players[playerID]; ok {
+		p.Role = role
+		p.Character = character
+		p.Health = health
+	}
+	return nil
+}
+
+// GetRolesByPlayerCount returns the roles dealt for numPlayers
+func (s *MemoryStore) GetRolesByPlayerCount(numPlayers int) ([]data.Role, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	distribution := data.RoleDistribution(numPlayers)
+	if distribution == nil {
+		return nil, fmt.Errorf("no role distribution for %d players", numPlayers)
+	}
+	roles := make([]data.Role, 0, numPlayers)
+	for _, name := range distribution {
+		found := false
+		for _, role := range s.roles {
+			if role.Name == name {
+				roles = append(roles, role)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("role %s is not seeded", name)
+		}
+	}
+	return roles, nil
+}
+
+// GetAvailableCharacters returns the characters nobody in the game has yet
+func (s *MemoryStore) GetAvailableCharacters(gameID int, numPlayers int) ([]data.Character, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	taken := make(map[string]bool)
+	for _, p := range s.players {
+		if p.GameID == gameID {
+			taken[p.Character] = true
+		}
+	}
+	var characters []data.Character
+	for _, c := range s.characters {
+		if !taken[c.Name] {
+			characters = append(characters, c)
+		}
+	}
+	if len(characters) < numPlayers {
+		return nil, fmt.Errorf("not enough characters available")
+	}
+	return characters, nil
+}
+
+// GenerateDeck fills the deck for a new game based on card copies, in random order
+func (s *MemoryStore) GenerateDeck(gameID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var cardIDs []int
+	for _, card := range s.cards {
+		for i := 0; i < card.Copies; i++ {
+			cardIDs = append(cardIDs, card.ID)
+		}
+	}
+	rand.Shuffle(len(cardIDs), func(i, j int) { cardIDs[i], cardIDs[j] = cardIDs[j], cardIDs[i] })
+	for i, cardID := range cardIDs {
+		s.decks[gameID] = append(s.decks[gameID], deckEntry{cardID: cardID, position: i + 1})
+	}
+	return nil
+}
+
+// DrawCard draws the top card from the deck of a game
+func (s *MemoryStore) DrawCard(gameID int) (*data.Card, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	deck := s.decks[gameID]
+	if len(deck) == 0 {
+		return nil, fmt.Errorf("could not draw card: deck is empty")
+	}
+	top := 0
+	for i, entry := range deck {
+		if entry.position < deck[top].position {
+			top = i
+		}
+	}
+	entry := deck[top]
+	s.decks[gameID] = append(deck[:top:top], deck[top+1:]...)
+	card := s.cardByID(entry.cardID)
+	if card == nil {
+		return nil, fmt.Errorf("could not draw card: unknown card %d", entry.cardID)
+	}
+	return &data.Card{ID: card.ID, Name: card.Name, Type: card.Type, Description: card.Description}, nil
+}
+
+// DiscardCard adds a card to the discard pile
+func (s *MemoryStore) DiscardCard(gameID int, cardID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.discards[gameID] = append(s.discards[gameID], cardID)
+	return nil
+}
+
+// ShuffleDiscardIntoDeck moves the discard pile back into the deck
+func (s *MemoryStore) ShuffleDiscardIntoDeck(gameID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, cardID := range s.discards[gameID] {
+		s.decks[gameID] = append(s.decks[gameID], deckEntry{cardID: cardID, position: i + 1})
+	}
+	delete(s.discards, gameID)
+	return nil
+}
+
+// CreateGameState inserts the game_state row of a game that is starting
+func (s *MemoryStore) CreateGameState(state *data.GameState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.states[state.ID]; ok {
+		return fmt.Errorf("could not create game state: game %d already has one", state.ID)
+	}
+	state.PendingFrom, state.PendingTarget, state.ResponseDeadline, state.Version = 0, 0, nil, 0
+	created := *state
+	s.states[state.ID] = &created
+	return nil
+}
+
+// GetGameState retrieves the current game state for a specific game
+func (s *MemoryStore) GetGameState(gameID int) (*data.GameState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state, ok := s.states[gameID]
+	if !ok {
+		return nil, nil
+	}
+	copied := *state
+	return &copied, nil
+}
+
+// UpdateGameStatePhase updates the current phase of the game
+func (s *MemoryStore) UpdateGameStatePhase(gameID int, phase string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if state, ok := s.states[gameID]; ok {
+		state.CurrentPhase = phase
+	}
+	return nil
+}
+
+// UpdateGameStateTurn updates the current turn in the game state
+func (s *MemoryStore) UpdateGameStateTurn(gameID int, nextPlayerID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if state, ok := s.states[gameID]; ok {
+		state.CurrentTurn = nextPlayerID
+	}
+	return nil
+}
+
+// UpdateGameStatePending records the Bang! targetID has to answer; a zero
+// targetID clears it
+func (s *MemoryStore) UpdateGameStatePending(gameID int, fromID int, targetID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if state, ok := s.states[gameID]; ok {
+		state.PendingFrom = fromID
+		state.PendingTarget = targetID
+	}
+	return nil
+}
+
+// UpdateGameStateTurnDeadline sets when the current turn runs out; nil for never
+func (s *MemoryStore) UpdateGameStateTurnDeadline(gameID int, deadline *time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if state, ok := s.states[gameID]; ok {
+		state.TurnDeadline = deadline
+	}
+	return nil
+}
+
+// UpdateGameStateResponseDeadline sets when the pending response runs out; nil for never
+func (s *MemoryStore) UpdateGameStateResponseDeadline(gameID int, deadline *time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if state, ok := s.states[gameID]; ok {
+		state.ResponseDeadline = deadline
+	}
+	return nil
+}
+
+// GetGameStatesWithDeadlines lists the state of every game with a running timer
+func (s *MemoryStore) GetGameStatesWithDeadlines() ([]data.GameState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var states []data.GameState
+	for _, gameID := range sortedKeys(s.states) {
+		state := s.states[gameID]
+		if state.TurnDeadline != nil || state.ResponseDeadline != nil {
+			states = append(states, *state)
+		}
+	}
+	return states, nil
+}
+
+// GetNextPlayerID retrieves the next player's user ID in the turn order
+func (s *MemoryStore) GetNextPlayerID(gameID int, currentPlayerID int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var userIDs []int
+	for _, p := range s.players {
+		// Выбывшие игроки пропускают ход
+		if p.GameID == gameID && p.Health > 0 {
+			userIDs = append(userIDs, p.UserID)
+		}
+	}
+	if len(userIDs) == 0 {
+		return 0, fmt.Errorf("could not get next player: no players in game %d", gameID)
+	}
+	sort.Ints(userIDs)
+	for _, id := range userIDs {
+		if id > currentPlayerID {
+			return id, nil
+		}
+	}
+	return userIDs[0], nil
+}
+
+// GetGamePlayers lists the players of a game in the order they joined
+func (s *MemoryStore) GetGamePlayers(gameID int) ([]data.Player, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var players []data.Player
+	for _, id := range sortedKeys(s.players) {
+		if p := s.players[id]; p.GameID == gameID {
+			players = append(players, *p)
+		}
+	}
+	return players, nil
+}
+
+// SetPlayerHealth sets the player's health; 0 means eliminated
+func (s *MemoryStore) SetPlayerHealth(gameID int, userID int, health int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if p := s.findPlayer(gameID, userID); p != nil {
+		p.Health = health
+	}
+	return nil
+}
+
+// DiscardPlayerCards moves every card in the player's hand and on their board
+// to the discard pile
+func (s *MemoryStore) DiscardPlayerCards(userID int, gameID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, entries := range []*[]cardEntry{&s.hands, &s.boards} {
+		kept := (*entries)[:0]
+		for _, entry := range *entries {
+			if entry.userID == userID && entry.gameID == gameID {
+				s.discards[gameID] = append(s.discards[gameID], entry.cardID)
+			} else {
+				kept = append(kept, entry)
+			}
+		}
+		*entries = kept
+	}
+	return nil
+}
+
+// GetPlayerHand lists the cards in a player's hand
+func (s *MemoryStore) GetPlayerHand(userID int, gameID int) ([]data.Card, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var hand []data.Card
+	for _, entry := range s.hands {
+		if entry.userID != userID || entry.gameID != gameID {
+			continue
+		}
+		if card := s.cardByID(entry.cardID); card != nil {
+			hand = append(hand, data.Card{ID: card.ID, Name: card.Name, Type: card.Type, Description: card.Description})
+		}
+	}
+	sort.Slice(hand, func(i, j int) bool { return hand[i].ID < hand[j].ID })
+	return hand, nil
+}
+
+// AddCardToPlayerHand adds a card to the player's hand
+func (s *MemoryStore) AddCardToPlayerHand(userID int, gameID int, cardID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hands = append(s.hands, cardEntry{userID: userID, gameID: gameID, cardID: cardID})
+	return nil
+}
+
+// RemoveCardFromPlayerHand removes a card from a player's hand
+func (s *MemoryStore) RemoveCardFromPlayerHand(userID int, gameID int, cardID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, entry := range s.hands {
+		if entry == (cardEntry{userID: userID, gameID: gameID, cardID: cardID}) {
+			s.hands = append(s.hands[:i:i], s.hands[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// AddCardToPlayerBoard adds a card to the player's board
+func (s *MemoryStore) AddCardToPlayerBoard(userID int, gameID int, cardID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.boards = append(s.boards, cardEntry{userID: userID, gameID: gameID, cardID: cardID})
+	return nil
+}
+
+// CheckPlayerHasCard checks if a player has a specific card
+func (s *MemoryStore) CheckPlayerHasCard(userID int, gameID int, cardName string) (bool, error) {
+	found, _, err := s.CheckPlayerHasCardByName(userID, gameID, cardName)
+	return found, err
+}
+
+// CheckPlayerHasCardByName checks if a player has a specific card by its name
+func (s *MemoryStore) CheckPlayerHasCardByName(userID int, gameID int, cardName string) (bool, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, entry := range s.hands {
+		if entry.userID != userID || entry.gameID != gameID {
+			continue
+		}
+		if card := s.cardByID(entry.cardID); card != nil && card.Name == cardName {
+			return true, card.ID, nil
+		}
+	}
+	return false, 0, nil
+}
+
+// GetCardByID retrieves a card by its ID
+func (s *MemoryStore) GetCardByID(cardID int) (*data.Card, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	card := s.cardByID(cardID)
+	if card == nil {
+		return nil, nil
+	}
+	return &data.Card{ID: card.ID, Name: card.Name, Type: card.Type, Description: card.Description}, nil
+}
+
+// GetCardIDByName retrieves the card ID by its name
+func (s *MemoryStore) GetCardIDByName(cardName string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, card := range s.cards {
+		if card.Name == cardName {
+			return card.ID, nil
+		}
+	}
+	return 0, fmt.Errorf("could not retrieve card ID: no card named %q", cardName)
+}
+
+// DecreasePlayerHealth decreases the player's health by 1
+func (s *MemoryStore) DecreasePlayerHealth(gameID int, userID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if p := s.findPlayer(gameID, userID); p != nil && p.Health > 0 {
+		p.Health--
+	}
+	return nil
+}
+
+// IncreasePlayerHealth increases the player's health by 1
+func (s *MemoryStore) IncreasePlayerHealth(gameID int, userID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if p := s.findPlayer(gameID, userID); p != nil {
+		p.Health++
+	}
+	return nil
+}
+
+// SaveChatMessage stores a message and fills in its ID and sending time
+func (s *MemoryStore) SaveChatMessage(message *data.ChatMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextChatID++
+	message.ID = s.nextChatID
+	message.SentAt = time.Now()
+	s.chat = append(s.chat, *message)
+	return nil
+}
+
+// GetChatMessages returns one page of a channel's history, newest first
+func (s *MemoryStore) GetChatMessages(query data.ChatQuery) ([]data.ChatMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	messages := []data.ChatMessage{}
+	for i := len(s.chat) - 1; i >= 0 && len(messages) < query.Limit; i-- {
+		m := s.chat[i]
+		if m.GameID != query.GameID || m.Channel != query.Channel {
+			continue
+		}
+		if query.BeforeID > 0 && m.ID >= query.BeforeID {
+			continue
+		}
+		if !query.SentBefore.IsZero() && !m.SentAt.Before(query.SentBefore) {
+			continue
+		}
+		if u, ok := s.users[m.UserID]; ok {
+			m.Username = u.Username
+		}
+		messages = append(messages, m)
+	}
+	return messages, nil
+}
+
+// GetRelation returns userID's side of their relation to otherID, "" for none
+func (s *MemoryStore) GetRelation(userID int, otherID int) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r, ok := s.relations[relationKey{userID, otherID}]; ok {
+		return r.status, nil
+	}
+	return "", nil
+}
+
+// CreateFriendRequest records a pending request of userID to otherID
+func (s *MemoryStore) CreateFriendRequest(userID int, otherID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := relationKey{userID, otherID}
+	if _, ok := s.relations[key]; !ok {
+		s.relations[key] = &relation{status: data.RelationPending, createdAt: time.Now()}
+	}
+	return nil
+}
+
+// AcceptFriendRequest turns the pending request of requesterID into a
+// friendship both ways
+func (s *MemoryStore) AcceptFriendRequest(userID int, requesterID int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	request, ok := s.relations[relationKey{requesterID, userID}]
+	if !ok || request.status != data.RelationPending {
+		return false, nil
+	}
+	now := time.Now()
+	s.relations[relationKey{requesterID, userID}] = &relation{status: data.RelationFriend, createdAt: now}
+	s.relations[relationKey{userID, requesterID}] = &relation{status: data.RelationFriend, createdAt: now}
+	return true, nil
+}
+
+// RemoveFriend ends a friendship both ways
+func (s *MemoryStore) RemoveFriend(userID int, otherID int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	removed := false
+	for _, key := range []relationKey{{userID, otherID}, {otherID, userID}} {
+		if r, ok := s.relations[key]; ok && r.status == data.RelationFriend {
+			delete(s.relations, key)
+			removed = true
+		}
+	}
+	return removed, nil
+}
+
+// BlockUser records that userID blocks otherID, dropping otherID's side
+// unless it is a block too
+func (s *MemoryStore) BlockUser(userID int, otherID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	theirs := relationKey{otherID, userID}
+	if r, ok := s.relations[theirs]; ok && r.status != data.RelationBlocked {
+		delete(s.relations, theirs)
+	}
+	s.relations[relationKey{userID, otherID}] = &relation{status: data.RelationBlocked, createdAt: time.Now()}
+	return nil
+}
+
+// DeleteRelation drops userID's side toward otherID if it has status
+func (s *MemoryStore) DeleteRelation(userID int, otherID int, status string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := relationKey{userID, otherID}
+	if r, ok := s.relations[key]; ok && r.status == status {
+		delete(s.relations, key)
+		return true, nil
+	}
+	return false, nil
+}
+
+// ListRelations lists the users userID has a relation in status to, by name
+func (s *MemoryStore) ListRelations(userID int, status string) ([]data.Friend, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	friends := []data.Friend{}
+	for key, r := range s.relations {
+		if key.userID == userID && r.status == status {
+			friends = append(friends, s.friend(key.otherID, r))
+		}
+	}
+	slices.SortFunc(friends, func(a, b data.Friend) int {
+		return cmp.Or(cmp.Compare(strings.ToLower(a.Username), strings.ToLower(b.Username)), cmp.Compare(a.UserID, b.UserID))
+	})
+	return friends, nil
+}
+
+// ListFriendRequests lists the users with a pending request to userID, oldest first
+func (s *MemoryStore) ListFriendRequests(userID int) ([]data.Friend, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	friends := []data.Friend{}
+	for key, r := range s.relations {
+		if key.otherID == userID && r.status == data.RelationPending {
+			friends = append(friends, s.friend(key.userID, r))
+		}
+	}
+	slices.SortFunc(friends, func(a, b data.Friend) int {
+		return cmp.Or(a.Since.Compare(b.Since), cmp.Compare(a.UserID, b.UserID))
+	})
+	return friends, nil
+}
+
+// friend describes userID as a relation; s.mu must be held
+func (s *MemoryStore) friend(userID int, r *relation) data.Friend {
+	friend := data.Friend{UserID: userID, Status: r.status, Since: r.createdAt}
+	if u, ok := s.users[userID]; ok {
+		friend.Username = u.Username
+	}
+	return friend
+}
+
+// ReserveIdempotencyKey claims a key for the user, replacing it if it expired
+func (s *MemoryStore) ReserveIdempotencyKey(userID int, key string, fingerprint string, expiredBefore time.Time) (*data.IdempotentResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k := idempotencyKey{userID: userID, key: key}
+	entry, ok := s.idempotency[k]
+	if !ok || entry.createdAt.Before(expiredBefore) {
+		s.idempotency[k] = &idempotencyEntry{fingerprint: fingerprint, createdAt: time.Now()}
+		return nil, nil
+	}
+	if entry.fingerprint != fingerprint {
+		return nil, ErrIdempotencyKeyReused
+	}
+	if entry.response == nil {
+		return nil, ErrIdempotencyInProgress
+	}
+	response := *entry.response
+	return &response, nil
+}
+
+// CompleteIdempotencyKey stores the response of the request that reserved the key
+func (s *MemoryStore) CompleteIdempotencyKey(userID int, key string, response *data.IdempotentResponse) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if entry, ok := s.idempotency[idempotencyKey{userID: userID, key: key}]; ok {
+		stored := *response
+		entry.response = &stored
+	}
+	return nil
+}
+
+// ReleaseIdempotencyKey forgets a reservation so the request can be retried
+func (s *MemoryStore) ReleaseIdempotencyKey(userID int, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.idempotency, idempotencyKey{userID: userID, key: key})
+	return nil
+}
+
+// DeleteExpiredIdempotencyKeys removes keys older than the retention window
+func (s *MemoryStore) DeleteExpiredIdempotencyKeys(expiredBefore time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var deleted int64
+	for k, entry := range s.idempotency {
+		if entry.createdAt.Before(expiredBefore) {
+			delete(s.idempotency, k)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (s *MemoryStore) findPlayer(gameID int, userID int) *data.Player {
+	for _, p := range s.players {
+		if p.GameID == gameID && p.UserID == userID {
+			return p
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) cardByID(cardID int) *data.Card {
+	for i := range s.cards {
+		if s.cards[i].ID == cardID {
+			return &s.cards[i]
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) hasRole(name string) bool {
+	for _, role := range s.roles {
+		if role.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *MemoryStore) hasCharacter(name string) bool {
+	for _, c := range s.characters {
+		if c.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func withoutGame(entries []cardEntry, gameID int) []cardEntry {
+	kept := entries[:0]
+	for _, entry := range entries {
+		if entry.gameID != gameID {
+			kept = append(kept, entry)
+		}
+	}
+	return kept
+}
+
+func sortedKeys[V any](m map[int]V) []int {
+	keys := make([]int, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	return keys
+}
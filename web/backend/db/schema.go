@@ -0,0 +1,213 @@
+package db
+
+import (
+	"fmt"
+)
+
+// migrations are idempotent DDL statements applied in order on every start.
+// New columns and tables are appended here, never edited in place.
+var migrations = []string{
+	`CREATE TABLE IF NOT EXISTS users (
+		id SERIAL PRIMARY KEY,
+		username TEXT NOT NULL UNIQUE,
+		email TEXT NOT NULL,
+		password TEXT NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`,
+	`CREATE TABLE IF NOT EXISTS roles (
+		name TEXT PRIMARY KEY,
+		definition TEXT NOT NULL DEFAULT ''
+	)`,
+	`CREATE TABLE IF NOT EXISTS characters (
+		name TEXT PRIMARY KEY,
+		definition TEXT NOT NULL DEFAULT '',
+		health INT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS cards (
+		id SERIAL PRIMARY KEY,
+		name TEXT NOT NULL,
+		type TEXT NOT NULL,
+		description TEXT NOT NULL DEFAULT '',
+		copies INT NOT NULL DEFAULT 1
+	)`,
+	`CREATE TABLE IF NOT EXISTS games (
+		id SERIAL PRIMARY KEY,
+		game_name TEXT NOT NULL,
+		creator_id INT NOT NULL REFERENCES users(id),
+		status TEXT NOT NULL DEFAULT 'waiting',
+		created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`,
+	`CREATE TABLE IF NOT EXISTS players (
+		id SERIAL PRIMARY KEY,
+		game_id INT NOT NULL REFERENCES games(id) ON DELETE CASCADE,
+		user_id INT NOT NULL REFERENCES users(id),
+		role TEXT,
+		health INT NOT NULL DEFAULT 4,
+		character TEXT
+	)`,
+	`CREATE TABLE IF NOT EXISTS game_state (
+		game_id INT PRIMARY KEY REFERENCES games(id) ON DELETE CASCADE,
+		current_turn INT NOT NULL,
+		current_phase TEXT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS deck (
+		game_id INT NOT NULL REFERENCES games(id) ON DELETE CASCADE,
+		card_id INT NOT NULL REFERENCES cards(id),
+		position INT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS discard_pile (
+		game_id INT NOT NULL REFERENCES games(id) ON DELETE CASCADE,
+		card_id INT NOT NULL REFERENCES cards(id)
+	)`,
+	`CREATE TABLE IF NOT EXISTS player_hand (
+		user_id INT NOT NULL REFERENCES users(id),
+		game_id INT NOT NULL REFERENCES games(id) ON DELETE CASCADE,
+		card_id INT NOT NULL REFERENCES cards(id)
+	)`,
+	`CREATE TABLE IF NOT EXISTS player_board (
+		user_id INT NOT NULL REFERENCES users(id),
+		game_id INT NOT NULL REFERENCES games(id) ON DELETE CASCADE,
+		card_id INT NOT NULL REFERENCES cards(id)
+	)`,
+
+	// Catalog seeding: upserts by name and per-copy suits and ranks
+	`CREATE UNIQUE INDEX IF NOT EXISTS roles_name_key ON roles (name)`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS characters_name_key ON characters (name)`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS cards_name_key ON cards (name)`,
+	`ALTER TABLE cards ADD COLUMN IF NOT EXISTS suits TEXT[] NOT NULL DEFAULT '{}'`,
+	`ALTER TABLE cards ADD COLUMN IF NOT EXISTS ranks TEXT[] NOT NULL DEFAULT '{}'`,
+
+	// Optimistic concurrency: every committed move bumps the version
+	`ALTER TABLE game_state ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 0`,
+
+	// A Bang! waiting for the target to respond; 0 when nothing is pending
+	`ALTER TABLE game_state ADD COLUMN IF NOT EXISTS pending_from INT NOT NULL DEFAULT 0`,
+	`ALTER TABLE game_state ADD COLUMN IF NOT EXISTS pending_target INT NOT NULL DEFAULT 0`,
+
+	// Idempotency keys: status stays NULL while the first request is running
+	`CREATE TABLE IF NOT EXISTS idempotency_keys (
+		user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		key TEXT NOT NULL,
+		fingerprint TEXT NOT NULL,
+		status INT,
+		headers JSONB NOT NULL DEFAULT '{}',
+		body BYTEA,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		PRIMARY KEY (user_id, key)
+	)`,
+	`CREATE INDEX IF NOT EXISTS idempotency_keys_created_at_idx ON idempotency_keys (created_at)`,
+
+	// Last event seq of every game when events are fanned out through NOTIFY.
+	// No foreign key: events may still be published for a deleted game.
+	`CREATE TABLE IF NOT EXISTS game_event_seq (
+		game_id INT PRIMARY KEY,
+		seq BIGINT NOT NULL
+	)`,
+
+	// Turn timer: per-game limits and the deadlines of the running game
+	`ALTER TABLE games ADD COLUMN IF NOT EXISTS turn_seconds INT NOT NULL DEFAULT 90`,
+	`ALTER TABLE games ADD COLUMN IF NOT EXISTS response_seconds INT NOT NULL DEFAULT 30`,
+	`ALTER TABLE game_state ADD COLUMN IF NOT EXISTS turn_deadline TIMESTAMPTZ`,
+	`ALTER TABLE game_state ADD COLUMN IF NOT EXISTS response_deadline TIMESTAMPTZ`,
+
+	// Lobby: seats of a game and the ready flag players toggle before the start
+	`ALTER TABLE games ADD COLUMN IF NOT EXISTS max_seats INT NOT NULL DEFAULT 7`,
+	`ALTER TABLE players ADD COLUMN IF NOT EXISTS ready BOOLEAN NOT NULL DEFAULT FALSE`,
+
+	// Visibility: private games are joined with an invite code and an optional password
+	`ALTER TABLE games ADD COLUMN IF NOT EXISTS visibility TEXT NOT NULL DEFAULT 'public'`,
+	`ALTER TABLE games ADD COLUMN IF NOT EXISTS invite_code TEXT`,
+	`ALTER TABLE games ADD COLUMN IF NOT EXISTS password_hash TEXT NOT NULL DEFAULT ''`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS games_invite_code_key ON games (invite_code) WHERE invite_code IS NOT NULL`,
+
+	// Game list: expansions, and indexes behind its filters, orders and player counts
+	`ALTER TABLE games ADD COLUMN IF NOT EXISTS expansions TEXT[] NOT NULL DEFAULT '{}'`,
+	`CREATE INDEX IF NOT EXISTS games_created_at_idx ON games (created_at, id)`,
+	`CREATE INDEX IF NOT EXISTS games_name_idx ON games (game_name, id)`,
+	`CREATE INDEX IF NOT EXISTS games_status_created_at_idx ON games (status, created_at, id)`,
+	`CREATE INDEX IF NOT EXISTS games_creator_id_idx ON games (creator_id)`,
+	`CREATE INDEX IF NOT EXISTS games_expansions_idx ON games USING GIN (expansions)`,
+	`CREATE INDEX IF NOT EXISTS players_game_id_idx ON players (game_id)`,
+	`CREATE INDEX IF NOT EXISTS players_user_id_idx ON players (user_id)`,
+	`CREATE INDEX IF NOT EXISTS users_username_lower_idx ON users (lower(username))`,
+
+	// Matchmaking pairs players of close ratings
+	`ALTER TABLE users ADD COLUMN IF NOT EXISTS rating INT NOT NULL DEFAULT 1000`,
+
+	// Janitor: idle games are found by their last activity, and the cards of
+	// the games it ends are kept in archive tables. No foreign keys to games:
+	// the archive outlives deleted lobbies.
+	`ALTER TABLE games ADD COLUMN IF NOT EXISTS last_activity_at TIMESTAMPTZ NOT NULL DEFAULT NOW()`,
+	`CREATE INDEX IF NOT EXISTS games_status_last_activity_idx ON games (status, last_activity_at)`,
+	`CREATE TABLE IF NOT EXISTS archived_deck (
+		game_id INT NOT NULL,
+		card_id INT NOT NULL REFERENCES cards(id),
+		position INT NOT NULL,
+		archived_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`,
+	`CREATE TABLE IF NOT EXISTS archived_discard_pile (
+		game_id INT NOT NULL,
+		card_id INT NOT NULL REFERENCES cards(id),
+		archived_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`,
+	`CREATE TABLE IF NOT EXISTS archived_player_hand (
+		user_id INT NOT NULL REFERENCES users(id),
+		game_id INT NOT NULL,
+		card_id INT NOT NULL REFERENCES cards(id),
+		archived_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`,
+	`CREATE TABLE IF NOT EXISTS archived_player_board (
+		user_id INT NOT NULL REFERENCES users(id),
+		game_id INT NOT NULL,
+		card_id INT NOT NULL REFERENCES cards(id),
+		archived_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`,
+
+	// Rematches: at most one per finished game, its players invited to it
+	`ALTER TABLE games ADD COLUMN IF NOT EXISTS rematch_of INT REFERENCES games(id) ON DELETE SET NULL`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS games_rematch_of_key ON games (rematch_of) WHERE rematch_of IS NOT NULL`,
+	`CREATE TABLE IF NOT EXISTS game_invites (
+		game_id INT NOT NULL REFERENCES games(id) ON DELETE CASCADE,
+		user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		inviter_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		status TEXT NOT NULL DEFAULT 'pending',
+		created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		PRIMARY KEY (game_id, user_id)
+	)`,
+	`CREATE INDEX IF NOT EXISTS game_invites_user_id_idx ON game_invites (user_id, status)`,
+
+	// Spectators may watch a game some seconds behind the table
+	`ALTER TABLE games ADD COLUMN IF NOT EXISTS spectator_delay_seconds INT NOT NULL DEFAULT 0`,
+
+	// Chat: the messages of every channel of a game, paged by id
+	`CREATE TABLE IF NOT EXISTS chat_messages (
+		id BIGSERIAL PRIMARY KEY,
+		game_id INT NOT NULL REFERENCES games(id) ON DELETE CASCADE,
+		channel TEXT NOT NULL,
+		user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		text TEXT NOT NULL,
+		sent_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`,
+	`CREATE INDEX IF NOT EXISTS chat_messages_game_channel_idx ON chat_messages (game_id, channel, id)`,
+
+	// Friends: every user's own side of their relation to another user
+	`CREATE TABLE IF NOT EXISTS user_relations (
+		user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		other_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		status TEXT NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		PRIMARY KEY (user_id, other_id),
+		CHECK (user_id <> other_id)
+	)`,
+	`CREATE INDEX IF NOT EXISTS user_relations_other_id_idx ON user_relations (other_id, status)`,
+}
+
+// Migrate applies the schema migrations
+func (s *PostgresStore) Migrate() error {
+	for i, stmt := range migrations {
+		if _, err := s.q.Exec(stmt); err != nil {
+			return fmt.Errorf("could not apply migration %d: %v", i, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package db
+
+import (
+	"backend/data"
+	"fmt"
+	"log"
+
+	"github.com/lib/pq"
+)
+
+// SeedCatalog upserts the base-game roles, characters and cards by name.
+// Running it again overwrites the stored definitions with data.Base*.
+func (s *PostgresStore) SeedCatalog() error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("could not begin seed transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	for _, role := range data.BaseRoles {
+		_, err := tx.Exec(`
+			INSERT INTO roles (name, definition) VALUES ($1, $2)
+			ON CONFLICT (name) DO UPDATE SET definition = EXCLUDED.definition`,
+			role.Name, role.Definition)
+		if err != nil {
+			return fmt.Errorf("could not seed role %s: %v", role.Name, err)
+		}
+	}
+
+	for _, character := range data.BaseCharacters {
+		_, err := tx.Exec(`
+			INSERT INTO characters (name, definition, health) VALUES ($1, $2, $3)
+			ON CONFLICT (name) DO UPDATE SET definition = EXCLUDED.definition, health = EXCLUDED.health`,
+			character.Name, character.Definition, character.Health)
+		if err != nil {
+			return fmt.Errorf("could not seed character %s: %v", character.Name, err)
+		}
+	}
+
+	for _, card := range data.BaseCards {
+		if len(card.Suits) != card.Copies || len(card.Ranks) != card.Copies {
+			return fmt.Errorf("card %s: %d copies but %d suits and %d ranks", card.Name, card.Copies, len(card.Suits), len(card.Ranks))
+		}
+		_, err := tx.Exec(`
+			INSERT INTO cards (name, type, description, copies, suits, ranks) VALUES ($1, $2, $3, $4, $5, $6)
+			ON CONFLICT (name) DO UPDATE SET type = EXCLUDED.type, description = EXCLUDED.description,
+				copies = EXCLUDED.copies, suits = EXCLUDED.suits, ranks = EXCLUDED.ranks`,
+			card.Name, card.Type, card.Description, card.Copies, pq.Array(card.Suits), pq.Array(card.Ranks))
+		if err != nil {
+			return fmt.Errorf("could not seed card %s: %v", card.Name, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("could not commit seed: %v", err)
+	}
+
+	log.Printf("Seeded %d roles, %d characters, %d cards", len(data.BaseRoles), len(data.BaseCharacters), len(data.BaseCards))
+	return nil
+}
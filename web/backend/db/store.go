@@ -0,0 +1,149 @@
+package db
+
+import (
+	"backend/data"
+	"time"
+)
+
+// UserStore persists registered users
+type UserStore interface {
+	CreateUser(user *data.User) error
+	GetUserByUsername(username string) (*data.User, error)
+	GetUserByID(userID int) (*data.User, error)
+	SearchUsers(query data.UserSearch) ([]data.UserSummary, error)
+}
+
+// FriendStore persists friend requests, friendships and blocks between users
+type FriendStore interface {
+	// GetRelation returns userID's side of their relation to otherID, "" for none
+	GetRelation(userID int, otherID int) (string, error)
+	CreateFriendRequest(userID int, otherID int) error
+	// AcceptFriendRequest turns the pending request of requesterID into a
+	// friendship both ways; false when there was no such request
+	AcceptFriendRequest(userID int, requesterID int) (bool, error)
+	// RemoveFriend ends a friendship both ways; false when there was none
+	RemoveFriend(userID int, otherID int) (bool, error)
+	// BlockUser records the block and drops whatever otherID had toward
+	// userID, unless it is a block too
+	BlockUser(userID int, otherID int) error
+	// DeleteRelation drops userID's side toward otherID if it has status
+	DeleteRelation(userID int, otherID int, status string) (bool, error)
+	// ListRelations lists the users userID has a relation in status to
+	ListRelations(userID int, status string) ([]data.Friend, error)
+	// ListFriendRequests lists the users with a pending request to userID
+	ListFriendRequests(userID int) ([]data.Friend, error)
+}
+
+// GameStore persists games, their players and the role/character catalog
+type GameStore interface {
+	// InLobbyTx runs fn atomically while holding the game's row lock. It
+	// returns ErrNoGame when the game does not exist.
+	InLobbyTx(gameID int, fn func(tx GameStore, game *data.Game) error) error
+
+	CreateGame(game *data.Game) error
+	ListGames(query data.GameListQuery) ([]data.GameSummary, int, error)
+	GetGameByID(gameID int) (*data.Game, error)
+	GetGameByInviteCode(code string) (*data.Game, error)
+	GetRematchOf(gameID int) (*data.Game, error)
+	ListIdleGames(status string, idleSince time.Time) ([]*data.Game, error)
+	DeleteGame(gameID int) error
+	UpdateGameStatus(gameID int, status string) error
+	UpdateGameCreator(gameID int, userID int) error
+	AddPlayerToGame(gameID int, userID int) error
+	RemovePlayerFromGame(gameID int, userID int) error
+	GetPlayersInGame(gameID int) ([]map[string]interface{}, error)
+	CheckPlayerExists(gameID int, userID int) (bool, error)
+	SetPlayerReady(gameID int, userID int, ready bool) error
+	UpdatePlayerRoleAndCharacter(playerID int, role string, character string, health int) error
+	GetRolesByPlayerCount(numPlayers int) ([]data.Role, error)
+	GetAvailableCharacters(gameID int, numPlayers int) ([]data.Character, error)
+	ArchiveGameCards(gameID int) (int64, error)
+	// CreateGameState, GenerateDeck, DrawCard and AddCardToPlayerHand are
+	// shared with GameProcessStore: starting a game deals the opening hands
+	CreateGameState(state *data.GameState) error
+	GenerateDeck(gameID int) error
+	DrawCard(gameID int) (*data.Card, error)
+	AddCardToPlayerHand(userID int, gameID int, cardID int) error
+
+	CreateInvite(invite *data.GameInvite) error
+	GetInvite(gameID int, userID int) (*data.GameInvite, error)
+	GetGameInvites(gameID int) ([]data.GameInvite, error)
+	GetUserInvites(userID int, status string) ([]data.GameInvite, error)
+	SetInviteStatus(gameID int, userID int, status string) error
+}
+
+// GameProcessStore persists the state of a running game: deck, discard pile,
+// hands, boards, health and turn order
+type GameProcessStore interface {
+	// InGameTx runs fn atomically while holding the game's state lock.
+	// It returns ErrNoGameState when the game has not been started.
+	InGameTx(gameID int, fn func(tx GameProcessStore, state *data.GameState) error) error
+
+	GenerateDeck(gameID int) error
+	DrawCard(gameID int) (*data.Card, error)
+	DiscardCard(gameID int, cardID int) error
+	ShuffleDiscardIntoDeck(gameID int) error
+	GetGameState(gameID int) (*data.GameState, error)
+	UpdateGameStatePhase(gameID int, phase string) error
+	UpdateGameStateTurn(gameID int, nextPlayerID int) error
+	UpdateGameStatePending(gameID int, fromID int, targetID int) error
+	UpdateGameStateTurnDeadline(gameID int, deadline *time.Time) error
+	UpdateGameStateResponseDeadline(gameID int, deadline *time.Time) error
+	GetGameStatesWithDeadlines() ([]data.GameState, error)
+	// UpdateGameStatus is shared with GameStore: the game finishes inside a move
+	UpdateGameStatus(gameID int, status string) error
+	GetNextPlayerID(gameID int, currentPlayerID int) (int, error)
+	GetGamePlayers(gameID int) ([]data.Player, error)
+	GetPlayerHand(userID int, gameID int) ([]data.Card, error)
+	AddCardToPlayerHand(userID int, gameID int, cardID int) error
+	RemoveCardFromPlayerHand(userID int, gameID int, cardID int) error
+	AddCardToPlayerBoard(userID int, gameID int, cardID int) error
+	CheckPlayerHasCard(userID int, gameID int, cardName string) (bool, error)
+	CheckPlayerHasCardByName(userID int, gameID int, cardName string) (bool, int, error)
+	GetCardByID(cardID int) (*data.Card, error)
+	GetCardIDByName(cardName string) (int, error)
+	DecreasePlayerHealth(gameID int, userID int) error
+	IncreasePlayerHealth(gameID int, userID int) error
+	SetPlayerHealth(gameID int, userID int, health int) error
+	DiscardPlayerCards(userID int, gameID int) error
+	// ArchiveGameCards is shared with GameStore: the janitor archives lobbies and running games alike
+	ArchiveGameCards(gameID int) (int64, error)
+	// TouchGame marks the game active. Only moves a player makes call it, so
+	// a game the turn timer alone keeps going still counts as abandoned.
+	TouchGame(gameID int) error
+}
+
+// ChatStore persists the messages of every chat channel of a game
+type ChatStore interface {
+	SaveChatMessage(message *data.ChatMessage) error
+	GetChatMessages(query data.ChatQuery) ([]data.ChatMessage, error)
+}
+
+// IdempotencyStore remembers the responses to mutating requests per user and
+// Idempotency-Key, so a retried request is answered without running again
+type IdempotencyStore interface {
+	// ReserveIdempotencyKey claims the key for a new request. It returns the
+	// stored response when the key already completed, ErrIdempotencyInProgress
+	// while the first request is still running and ErrIdempotencyKeyReused when
+	// the key was used for a different request. Keys created before
+	// expiredBefore are treated as free.
+	ReserveIdempotencyKey(userID int, key string, fingerprint string, expiredBefore time.Time) (*data.IdempotentResponse, error)
+	CompleteIdempotencyKey(userID int, key string, response *data.IdempotentResponse) error
+	ReleaseIdempotencyKey(userID int, key string) error
+	DeleteExpiredIdempotencyKeys(expiredBefore time.Time) (int64, error)
+}
+
+// Store bundles every repository; both PostgresStore and MemoryStore implement it
+type Store interface {
+	UserStore
+	GameStore
+	GameProcessStore
+	ChatStore
+	FriendStore
+	IdempotencyStore
+}
+
+var (
+	_ Store = (*PostgresStore)(nil)
+	_ Store = (*MemoryStore)(nil)
+)
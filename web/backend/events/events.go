@@ -0,0 +1,91 @@
+package events
+
+import (
+	"sync"
+)
+
+// Event is a notification about a game. An event with a Recipient is
+// private: only that player may receive it. An event for AudienceSpectators
+// only reaches the game's spectators. Seq numbers every event of a
+// game in publish order; a client only sees the seqs it may receive, so gaps
+// are normal. Build events with New so Type, Data and SchemaVersion agree.
+type Event struct {
+	GameID        int         `json:"game_id"`
+	Seq           int64       `json:"seq,omitempty"`
+	Version       int64       `json:"version,omitempty"` // game state version the event belongs to
+	Recipient     int         `json:"recipient,omitempty"`
+	Audience      string      `json:"audience,omitempty" enum:"spectators"`
+	SchemaVersion int         `json:"schema_version"`
+	Type          string      `json:"event"`
+	Data          interface{} `json:"data"` // one of the payloads in Payloads
+}
+
+// AudienceSpectators addresses an event to the spectators of its game only
+const AudienceSpectators = "spectators"
+
+// Publisher delivers events to whoever is listening. Implementations must not
+// block the caller: handlers publish while answering HTTP requests.
+type Publisher interface {
+	Publish(event Event)
+}
+
+// Batch holds events back until Flush. Game moves publish into a Batch inside
+// their transaction and flush it after commit, so a rolled back move never
+// reaches anyone.
+type Batch struct {
+	events []Event
+}
+
+// Publish queues the event
+func (b *Batch) Publish(event Event) {
+	b.events = append(b.events, event)
+}
+
+// Flush publishes the queued events to p in order, stamping them with the
+// committed state version, and empties the batch
+func (b *Batch) Flush(p Publisher, version int64) {
+	for _, event := range b.events {
+		if event.Version == 0 {
+			event.Version = version
+		}
+		p.Publish(event)
+	}
+	b.events = nil
+}
+
+// Recorder is a Publisher that keeps every event, for tests to assert on
+type Recorder struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+// Publish records the event
+func (r *Recorder) Publish(event Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+}
+
+// Events returns a copy of the recorded events
+func (r *Recorder) Events() []Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Event(nil), r.events...)
+}
+
+// Reset forgets the recorded events
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = nil
+}
+
+// Multi publishes every event to all of its publishers
+type Multi []Publisher
+
+// Publish forwards the event to each publisher
+func (m Multi) Publish(event Event) {
+	for _, p := range m {
+		p.Publish(event)
+	}
+}
@@ -0,0 +1,149 @@
+package events
+
+import (
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Schema returns a JSON Schema (draft 2020-12) for the envelope of every
+// event and, through "oneOf" on the event name, the payload of each type.
+// It is generated from the Go types, so it cannot drift from what is sent.
+func Schema() map[string]interface{} {
+	g := &schemaGenerator{defs: make(map[string]interface{})}
+
+	var names []interface{}
+	var variants []interface{}
+	for _, payload := range Payloads {
+		name := payload.EventType()
+		names = append(names, name)
+		variants = append(variants, map[string]interface{}{
+			"properties": map[string]interface{}{
+				"event": map[string]interface{}{"const": name},
+				"data":  g.schema(reflect.TypeOf(payload)),
+			},
+		})
+	}
+
+	envelope := g.object(reflect.TypeOf(Event{}))
+	properties := envelope["properties"].(map[string]interface{})
+	properties["schema_version"] = map[string]interface{}{"const": SchemaVersion}
+	properties["event"] = map[string]interface{}{"type": "string", "enum": names}
+	properties["data"] = map[string]interface{}{}
+
+	schema := map[string]interface{}{
+		"$schema":        "https://json-schema.org/draft/2020-12/schema",
+		"title":          "Game event",
+		"schema_version": SchemaVersion,
+	}
+	for key, value := range envelope {
+		schema[key] = value
+	}
+	schema["oneOf"] = variants
+	schema["$defs"] = g.defs
+	return schema
+}
+
+// schemaGenerator maps Go types to JSON Schema; every named struct becomes a
+// definition under $defs referenced by name
+type schemaGenerator struct {
+	defs map[string]interface{}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func (g *schemaGenerator) schema(t reflect.Type) map[string]interface{} {
+	if t == timeType {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return map[string]interface{}{
+			"anyOf": []interface{}{g.schema(t.Elem()), map[string]interface{}{"type": "null"}},
+		}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		// JSON object keys are strings even for map[int]...
+		return map[string]interface{}{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.object(t)
+		}
+		name := t.Name()
+		if _, ok := g.defs[name]; !ok {
+			g.defs[name] = nil // reserved, in case the type refers to itself
+			g.defs[name] = g.object(t)
+		}
+		return map[string]interface{}{"$ref": "#/$defs/" + name}
+	default:
+		// interface{}: anything
+		return map[string]interface{}{}
+	}
+}
+
+// object describes a struct by its JSON fields; fields without omitempty are
+// required
+func (g *schemaGenerator) object(t reflect.Type) map[string]interface{} {
+	properties := make(map[string]interface{})
+	required := []string{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, omitEmpty, skip := jsonField(field)
+		if skip {
+			continue
+		}
+
+		fieldType := field.Type
+		if omitEmpty && fieldType.Kind() == reflect.Ptr {
+			// An omitted pointer is absent rather than null
+			fieldType = fieldType.Elem()
+		}
+		property := g.schema(fieldType)
+		if enum := field.Tag.Get("enum"); enum != "" {
+			property["enum"] = strings.Split(enum, ",")
+		}
+		properties[name] = property
+		if !omitEmpty {
+			required = append(required, name)
+		}
+	}
+	return map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"required":             required,
+		"additionalProperties": false,
+	}
+}
+
+// jsonField reads a field's name and options from its json tag
+func jsonField(field reflect.StructField) (name string, omitEmpty bool, skip bool) {
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return "", false, true
+	}
+	parts := strings.Split(tag, ",")
+	name = parts[0]
+	if name == "" {
+		name = field.Name
+	}
+	for _, option := range parts[1:] {
+		if option == "omitempty" {
+			omitEmpty = true
+		}
+	}
+	return name, omitEmpty, false
+}
@@ -0,0 +1,331 @@
+package events
+
+import (
+	"backend/data"
+	"time"
+)
+
+// SchemaVersion versions the payloads below. Every event carries it; it is
+// bumped on any change a client could break on (a renamed or removed field,
+// a changed meaning), not on added optional fields or new event types.
+const SchemaVersion = 1
+
+// Payload is the data of one event type. Keys follow one convention:
+// player_id is the player acting, target_id the player acted upon, and every
+// other reference to a user ends in _id.
+type Payload interface {
+	EventType() string
+}
+
+// New builds a public event of gameID carrying payload
+func New(gameID int, payload Payload) Event {
+	return Event{
+		GameID:        gameID,
+		SchemaVersion: SchemaVersion,
+		Type:          payload.EventType(),
+		Data:          payload,
+	}
+}
+
+// Payloads lists one value of every payload type; the JSON Schema is built
+// from it, so a new event type must be added here
+var Payloads = []Payload{
+	PlayerJoined{},
+	ReadyChanged{},
+	GameStarted{},
+	RoleAssigned{},
+	TurnStarted{},
+	CardsDrawn{},
+	CardPlayed{},
+	CardEffect{},
+	CardDiscarded{},
+	TurnEnded{},
+	PlayerEliminated{},
+	GameEnded{},
+	GameAborted{},
+	TimerStarted{},
+	TurnTimedOut{},
+	PresenceChanged{},
+	PlayerLeft{},
+	HostChanged{},
+	MatchFound{},
+	InviteReceived{},
+	InviteDeclined{},
+	RematchCreated{},
+	FriendRequestReceived{},
+	FriendRequestAccepted{},
+	FriendPresenceChanged{},
+	ChatMessage{},
+	Snapshot{},
+}
+
+// PlayerJoined is sent to the lobby when a player takes a seat; Seats counts
+// the seats taken including theirs
+type PlayerJoined struct {
+	PlayerID int    `json:"player_id"`
+	Username string `json:"username"`
+	Seats    int    `json:"seats"`
+	MaxSeats int    `json:"max_seats"`
+}
+
+func (PlayerJoined) EventType() string { return "player_joined" }
+
+// ReadyChanged is sent to the lobby when a player toggles ready. The host can
+// start once ReadyCount equals Players and there are enough of them.
+type ReadyChanged struct {
+	PlayerID   int  `json:"player_id"`
+	Ready      bool `json:"ready"`
+	ReadyCount int  `json:"ready_count"`
+	Players    int  `json:"players"`
+}
+
+func (ReadyChanged) EventType() string { return "ready_changed" }
+
+// GameStarted is sent to everyone once roles and characters are dealt. Only
+// the sheriff's role is public.
+type GameStarted struct {
+	SheriffID  int            `json:"sheriff_id"`
+	Characters map[int]string `json:"characters"` // character by player user ID
+}
+
+func (GameStarted) EventType() string { return "game_started" }
+
+// RoleAssigned privately tells a player their role
+type RoleAssigned struct {
+	Role      string `json:"role"`
+	Character string `json:"character"`
+	Health    int    `json:"health"`
+}
+
+func (RoleAssigned) EventType() string { return "role_assigned" }
+
+// TurnStarted tells everyone a player drew their cards; the cards themselves
+// only go to that player, in CardsDrawn
+type TurnStarted struct {
+	PlayerID   int `json:"player_id"`
+	CardsDrawn int `json:"cards_drawn"`
+}
+
+func (TurnStarted) EventType() string { return "turn_started" }
+
+// CardsDrawn privately lists the cards a player just drew
+type CardsDrawn struct {
+	Cards []*data.Card `json:"cards"`
+}
+
+func (CardsDrawn) EventType() string { return "cards_drawn" }
+
+// CardPlayed is sent after a card and all its effects are applied
+type CardPlayed struct {
+	PlayerID int `json:"player_id"`
+	CardID   int `json:"card_id"`
+	TargetID int `json:"target_id,omitempty"`
+}
+
+func (CardPlayed) EventType() string { return "card_played" }
+
+// CardEffect describes one effect of a card as it resolves. Effect is the
+// card name; the other fields are set only when they apply to it.
+type CardEffect struct {
+	Effect   string `json:"effect"`
+	PlayerID int    `json:"player_id,omitempty"`
+	TargetID int    `json:"target_id,omitempty"`
+	Damage   int    `json:"damage,omitempty"`
+	Heal     int    `json:"heal,omitempty"`
+	// Success is whether a dodge (Missed!, Barrel) worked
+	Success *bool `json:"success,omitempty"`
+	// AwaitingResponse is set on a Bang! until its target responds
+	AwaitingResponse bool `json:"awaiting_response,omitempty"`
+	// Passed is set when Dynamite did not explode and moved on to TargetID
+	Passed bool `json:"passed,omitempty"`
+}
+
+func (CardEffect) EventType() string { return "card_effect" }
+
+// CardDiscarded is sent when a player discards a card without playing it
+type CardDiscarded struct {
+	PlayerID int `json:"player_id"`
+	CardID   int `json:"card_id"`
+}
+
+func (CardDiscarded) EventType() string { return "card_discarded" }
+
+// TurnEnded hands the turn from PlayerID to NextPlayerID
+type TurnEnded struct {
+	PlayerID     int `json:"player_id"`
+	NextPlayerID int `json:"next_player_id"`
+}
+
+func (TurnEnded) EventType() string { return "turn_ended" }
+
+// PlayerEliminated reveals the role of a player who died or surrendered.
+// KillerID is set when another player dealt the last point of damage; the
+// killer of an Outlaw draws RewardCards (sent to them in cards_drawn), and a
+// Sheriff who killed a Deputy discards every card.
+type PlayerEliminated struct {
+	PlayerID        int    `json:"player_id"`
+	Role            string `json:"role"`
+	KillerID        int    `json:"killer_id,omitempty"`
+	RewardCards     int    `json:"reward_cards,omitempty"`
+	KillerDiscarded bool   `json:"killer_discarded,omitempty"`
+}
+
+func (PlayerEliminated) EventType() string { return "player_eliminated" }
+
+// GameEnded is sent once a side has won; every role is revealed
+type GameEnded struct {
+	Winner string         `json:"winner" enum:"Sheriff,Outlaws,Renegade"`
+	Roles  map[int]string `json:"roles"` // role by player user ID
+}
+
+func (GameEnded) EventType() string { return "game_ended" }
+
+// GameAborted is sent when the janitor ends a game nobody won: a lobby that
+// stayed idle too long is deleted, a running game its players abandoned is
+// marked aborted
+type GameAborted struct {
+	Reason string `json:"reason" enum:"lobby_expired,abandoned"`
+}
+
+func (GameAborted) EventType() string { return "game_aborted" }
+
+// TimerStarted announces a new deadline: PlayerID has to act in the given
+// phase before Deadline, Seconds from when it was sent. Clients count down
+// locally from it.
+type TimerStarted struct {
+	PlayerID int       `json:"player_id"`
+	Phase    string    `json:"phase"`
+	Deadline time.Time `json:"deadline"`
+	Seconds  int       `json:"seconds"`
+}
+
+func (TimerStarted) EventType() string { return "timer_started" }
+
+// TurnTimedOut is sent after the server acted for a player who ran out of
+// time: "end_turn", or "take_hit" for a Bang! left unanswered. Cards
+// discarded at random to respect the hand limit arrive as card_discarded.
+type TurnTimedOut struct {
+	PlayerID int    `json:"player_id"`
+	Phase    string `json:"phase"`
+	Action   string `json:"action" enum:"end_turn,take_hit"`
+}
+
+func (TurnTimedOut) EventType() string { return "turn_timed_out" }
+
+// PresenceChanged is sent when a player connects, drops or goes offline
+type PresenceChanged struct {
+	PlayerID int    `json:"player_id"`
+	Status   string `json:"status" enum:"online,away,offline"`
+}
+
+func (PresenceChanged) EventType() string { return "presence_changed" }
+
+// PlayerLeft is sent when a player leaves the lobby, is kicked by the host or
+// surrenders a running game
+type PlayerLeft struct {
+	PlayerID int    `json:"player_id"`
+	Reason   string `json:"reason" enum:"left,kicked,surrendered"`
+}
+
+func (PlayerLeft) EventType() string { return "player_left" }
+
+// HostChanged names the new host after the previous one left
+type HostChanged struct {
+	HostID int `json:"host_id"`
+}
+
+func (HostChanged) EventType() string { return "host_changed" }
+
+// MatchFound tells a queued player the matchmaker seated them at a new game.
+// It is sent to the player's user stream, not to a game.
+type MatchFound struct {
+	GameID     int      `json:"game_id"`
+	Players    []int    `json:"players"`
+	Expansions []string `json:"expansions"`
+}
+
+func (MatchFound) EventType() string { return "match_found" }
+
+// InviteReceived asks a user to take a seat in a game. It is sent to the
+// user stream; the user answers with accept_invite or decline_invite.
+type InviteReceived struct {
+	GameID      int    `json:"game_id"`
+	GameName    string `json:"game_name"`
+	InviterID   int    `json:"inviter_id"`
+	InviterName string `json:"inviter_name"`
+	RematchOf   int    `json:"rematch_of,omitempty"` // set for a rematch invite
+}
+
+func (InviteReceived) EventType() string { return "invite_received" }
+
+// InviteDeclined tells the lobby an invited player will not come; Pending
+// counts the invites still unanswered. Accepted invites are announced as
+// player_joined.
+type InviteDeclined struct {
+	PlayerID int `json:"player_id"`
+	Pending  int `json:"pending"`
+}
+
+func (InviteDeclined) EventType() string { return "invite_declined" }
+
+// RematchCreated tells the table of a finished game where its rematch waits
+type RematchCreated struct {
+	GameID int `json:"game_id"`
+	HostID int `json:"host_id"`
+}
+
+func (RematchCreated) EventType() string { return "rematch_created" }
+
+// FriendRequestReceived tells a user, on their user stream, that someone
+// asks to be their friend
+type FriendRequestReceived struct {
+	UserID   int    `json:"user_id"`
+	Username string `json:"username"`
+}
+
+func (FriendRequestReceived) EventType() string { return "friend_request_received" }
+
+// FriendRequestAccepted tells a user, on their user stream, that their
+// friend request was accepted
+type FriendRequestAccepted struct {
+	UserID   int    `json:"user_id"`
+	Username string `json:"username"`
+}
+
+func (FriendRequestAccepted) EventType() string { return "friend_request_accepted" }
+
+// FriendPresenceChanged is sent to the user stream of every friend of a user
+// who comes online, drops or goes offline. A user is online while any of
+// their streams is open: the user stream, or a game's WebSocket or SSE one.
+type FriendPresenceChanged struct {
+	UserID int    `json:"user_id"`
+	Status string `json:"status" enum:"online,away,offline"`
+}
+
+func (FriendPresenceChanged) EventType() string { return "friend_presence_changed" }
+
+// ChatMessage is a message posted to one of the game's chat channels. It
+// only reaches those who may read the channel: table and lobby messages are
+// public, spectators ones go to the spectators' audience and dead ones to
+// each eliminated player privately.
+type ChatMessage struct {
+	ID       int64     `json:"id"`
+	Channel  string    `json:"channel" enum:"lobby,table,spectators,dead"`
+	UserID   int       `json:"user_id"`
+	Username string    `json:"username"`
+	Text     string    `json:"text"`
+	SentAt   time.Time `json:"sent_at"`
+}
+
+func (ChatMessage) EventType() string { return "chat_message" }
+
+// Snapshot privately carries the whole game to a client that could not
+// resume from its last seq. Players also get their hand.
+type Snapshot struct {
+	Game    *data.Game               `json:"game"`
+	Players []map[string]interface{} `json:"players"`
+	State   *data.GameState          `json:"state"`
+	Hand    []data.Card              `json:"hand,omitempty"`
+}
+
+func (Snapshot) EventType() string { return "snapshot" }
@@ -0,0 +1,117 @@
+package fanout
+
+import (
+	"backend/db"
+	"backend/events"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// DefaultBuffer is how many events may wait to be sent to PostgreSQL
+const DefaultBuffer = 1024
+
+// Notifier sends an event to every instance; db.PostgresStore implements it
+type Notifier interface {
+	NotifyGameEvent(event events.Event) error
+}
+
+// Receiver is where events fanned out by any instance are delivered locally;
+// hub.Hub implements it
+type Receiver interface {
+	Deliver(event events.Event)
+	Reset()
+}
+
+// Postgres is an events.Publisher that shares events between backend
+// replicas through PostgreSQL LISTEN/NOTIFY. Published events are not
+// delivered locally right away: they come back through Listen like those of
+// the other instances, so every instance sees the same events in the same
+// order with the same seqs.
+//
+// Presence is still tracked per instance; only its events are shared.
+type Postgres struct {
+	notifier Notifier
+	queue    chan events.Event
+}
+
+// NewPostgres starts a publisher sending events through notifier. Up to
+// buffer events may be queued; beyond that new events are dropped.
+func NewPostgres(notifier Notifier, buffer int) *Postgres {
+	if buffer <= 0 {
+		buffer = DefaultBuffer
+	}
+	p := &Postgres{notifier: notifier, queue: make(chan events.Event, buffer)}
+	go p.run()
+	return p
+}
+
+// Publish queues the event without blocking
+func (p *Postgres) Publish(event events.Event) {
+	select {
+	case p.queue <- event:
+	default:
+		log.Printf("Fanout: queue full, dropped %s for game %d", event.Type, event.GameID)
+	}
+}
+
+// run sends queued events one at a time, keeping their publish order
+func (p *Postgres) run() {
+	for event := range p.queue {
+		err := p.notifier.NotifyGameEvent(event)
+		if errors.Is(err, db.ErrEventTooLarge) {
+			log.Printf("Fanout: %s for game %d is too large to share, dropped", event.Type, event.GameID)
+		} else if err != nil {
+			log.Printf("Fanout: could not publish %s for game %d: %v", event.Type, event.GameID, err)
+		}
+	}
+}
+
+// Listen subscribes to db.EventChannel on its own connection and delivers
+// every event notified by any instance to receiver until the process exits.
+// Notifications sent while the connection was down are lost, so the receiver
+// is reset on reconnect.
+func Listen(dsn string, receiver Receiver) error {
+	listener := pq.NewListener(dsn, 10*time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		switch event {
+		case pq.ListenerEventDisconnected:
+			log.Printf("Fanout: listener disconnected: %v", err)
+		case pq.ListenerEventReconnected:
+			log.Println("Fanout: listener reconnected, event history reset")
+			receiver.Reset()
+		case pq.ListenerEventConnectionAttemptFailed:
+			log.Printf("Fanout: listener connection failed: %v", err)
+		}
+	})
+	if err := listener.Listen(db.EventChannel); err != nil {
+		listener.Close()
+		return err
+	}
+
+	go func() {
+		for {
+			select {
+			case notification := <-listener.Notify:
+				// nil is sent after a reconnect
+				if notification == nil {
+					continue
+				}
+				var event events.Event
+				if err := json.Unmarshal([]byte(notification.Extra), &event); err != nil {
+					log.Printf("Fanout: invalid event payload: %v", err)
+					continue
+				}
+				receiver.Deliver(event)
+			case <-time.After(90 * time.Second):
+				// Проверяем, что соединение живо, если событий давно не было
+				go listener.Ping()
+			}
+		}
+	}()
+	return nil
+}
+
+var _ events.Publisher = (*Postgres)(nil)
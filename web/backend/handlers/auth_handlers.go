@@ -2,15 +2,13 @@ package handlers
 
 import (
 	"backend/data"
-	"backend/db"
 	"encoding/json"
-	"log"
 	"net/http"
 	"time"
 )
 
 // RegisterUserHandler handles user registration
-func RegisterUserHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) RegisterUserHandler(w http.ResponseWriter, r *http.Request) {
     var userRequest struct {
         Username string `json:"username"`
         Email    string `json:"email"`
@@ -24,7 +22,7 @@ func RegisterUserHandler(w http.ResponseWriter, r *http.Request) {
     }
 
     // Check if the user already exists
-    existingUser, err := db.GetUserByUsername(userRequest.Username)
+    existingUser, err := h.Users.GetUserByUsername(userRequest.Username)
     if err != nil {
         http.Error(w, "Server error", http.StatusInternalServerError)
         return
@@ -47,7 +45,7 @@ func RegisterUserHandler(w http.ResponseWriter, r *http.Request) {
         return
     }
 
-    err = db.CreateUser(newUser)
+    err = h.Users.CreateUser(newUser)
     if err != nil {
         http.Error(w, "Error creating user", http.StatusInternalServerError)
         return
@@ -58,7 +56,7 @@ func RegisterUserHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // RegisterMultipleUsersHandler handles registration of multiple users
-func RegisterMultipleUsersHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) RegisterMultipleUsersHandler(w http.ResponseWriter, r *http.Request) {
     var userRequests []struct {
         Username string `json:"username"`
         Email    string `json:"email"`
@@ -75,7 +73,7 @@ func RegisterMultipleUsersHandler(w http.ResponseWriter, r *http.Request) {
     var createdUsers []data.User
     for _, userRequest := range userRequests {
         // Проверяем, существует ли пользователь
-        existingUser, err := db.GetUserByUsername(userRequest.Username)
+        existingUser, err := h.Users.GetUserByUsername(userRequest.Username)
         if err != nil {
             http.Error(w, "Server error", http.StatusInternalServerError)
             return
@@ -98,7 +96,7 @@ func RegisterMultipleUsersHandler(w http.ResponseWriter, r *http.Request) {
             return
         }
 
-        err = db.CreateUser(newUser)
+        err = h.Users.CreateUser(newUser)
         if err != nil {
             http.Error(w, "Error creating user "+userRequest.Username, http.StatusInternalServerError)
             return
@@ -112,7 +110,7 @@ func RegisterMultipleUsersHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // LoginHandler handles user login and JWT token generation
-func LoginHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) LoginHandler(w http.ResponseWriter, r *http.Request) {
     var credentials struct {
         Username string `json:"username"`
         Password string `json:"password"`
@@ -125,7 +123,7 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
     }
 
     // Fetch user from the database
-    user, err := db.GetUserByUsername(credentials.Username)
+    user, err := h.Users.GetUserByUsername(credentials.Username)
     if err != nil {
         http.Error(w, "Server error", http.StatusInternalServerError)
         return
@@ -163,23 +161,8 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
     json.NewEncoder(w).Encode(map[string]string{"token": token})
 }
 
-//  GetUsersHandler handles all users who's registered
-func GetUsersHandler(w http.ResponseWriter, r *http.Request) {
-    users, err := db.GetAllUsers()
-    if err != nil {
-        log.Println("GetAllUsersHandler error!")
-        http.Error(w, "Could not retrieve users", http.StatusInternalServerError)
-        return
-    }
-    if users == nil {
-        log.Println("Currently No Users!")
-    }
-    w.WriteHeader(http.StatusOK)
-    json.NewEncoder(w).Encode(users)
-}
-
 // GetCurrentUser возвращает информацию о текущем пользователе
-func GetCurrentUser(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) GetCurrentUser(w http.ResponseWriter, r *http.Request) {
 	// Получаем токен из cookie
 	cookie, err := r.Cookie("token")
 	if err != nil {
@@ -195,7 +178,7 @@ func GetCurrentUser(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Получаем пользователя из базы данных
-	user, err := db.GetUserByID(claims.UserID)
+	user, err := h.Users.GetUserByID(claims.UserID)
 	if err != nil {
 		http.Error(w, "Server error: Could not retrieve user", http.StatusInternalServerError)
 		return
@@ -0,0 +1,281 @@
+package handlers
+
+import (
+	"backend/data"
+	"backend/events"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// maxChatLength limits a single chat message
+const maxChatLength = 500
+
+// Page sizes of the chat history
+const (
+	defaultChatLimit = 50
+	maxChatLimit     = 200
+)
+
+// chatMessage is the payload of a chat command. Without a channel the message
+// goes where the sender talks by default: see defaultChannel.
+type chatMessage struct {
+	Channel string `json:"channel"`
+	Text    string `json:"text"`
+}
+
+// chatHistory is the response of GET /api/games/{id}/chat, oldest message
+// first. NextBefore is set while older messages remain; pass it back as
+// ?before= for the previous page.
+type chatHistory struct {
+	Messages   []data.ChatMessage `json:"messages"`
+	NextBefore int64              `json:"next_before,omitempty"`
+}
+
+// chatViewer is who someone is in a game, as far as its chat is concerned
+type chatViewer struct {
+	player bool
+	dead   bool // an eliminated player of the running game
+}
+
+// chatViewerOf finds userID among the players of a game
+func chatViewerOf(game *data.Game, players []map[string]interface{}, userID int) chatViewer {
+	for _, player := range players {
+		if player["user_id"] != userID {
+			continue
+		}
+		health, _ := player["health"].(int)
+		return chatViewer{player: true, dead: game.Status == data.StatusInProgress && health <= 0}
+	}
+	return chatViewer{}
+}
+
+// chatAccess says whether viewer may read and write a channel of game. Players
+// talk in the lobby before the start. At the table only living players
+// talk, and everybody listens; once the game is over every player may talk
+// there. Spectators and the dead have a channel of their own nobody else
+// reads, though the players may read the dead one after the game.
+func chatAccess(game *data.Game, channel string, viewer chatViewer) (read bool, write bool) {
+	over := game.Status == data.StatusFinished || game.Status == data.StatusAborted
+	switch channel {
+	case data.ChatLobby:
+		return true, viewer.player && game.Status == data.StatusWaiting
+	case data.ChatTable:
+		if over {
+			return true, viewer.player
+		}
+		return true, viewer.player && !viewer.dead && game.Status == data.StatusInProgress
+	case data.ChatSpectators:
+		return !viewer.player, !viewer.player
+	case data.ChatDead:
+		if over {
+			return viewer.player, false
+		}
+		return viewer.dead, viewer.dead
+	}
+	return false, false
+}
+
+// defaultChannel is where a message without a channel goes: the lobby before
+// the start, then the table, or the dead players' or spectators' channel
+func defaultChannel(game *data.Game, viewer chatViewer) string {
+	switch {
+	case !viewer.player:
+		return data.ChatSpectators
+	case game.Status == data.StatusWaiting:
+		return data.ChatLobby
+	case viewer.dead:
+		return data.ChatDead
+	default:
+		return data.ChatTable
+	}
+}
+
+// chat posts a message to a channel of the game. The text is checked,
+// rate limited and cleaned of profanity, then stored and sent to whoever
+// reads the channel.
+func (h *Handler) chat(gameID int, claims *data.Claims, message chatMessage) error {
+	text := strings.TrimSpace(message.Text)
+	if text == "" {
+		return &gameError{status: http.StatusBadRequest, message: "Message is empty"}
+	}
+	if len([]rune(text)) > maxChatLength {
+		return &gameError{status: http.StatusBadRequest, message: "Message is too long"}
+	}
+
+	game, err := h.Games.GetGameByID(gameID)
+	if err != nil {
+		return internalError("Could not retrieve game", err)
+	}
+	if game == nil {
+		return &gameError{status: http.StatusNotFound, message: "Game not found"}
+	}
+	players, err := h.Games.GetPlayersInGame(gameID)
+	if err != nil {
+		return internalError("Could not retrieve players", err)
+	}
+	viewer := chatViewerOf(game, players, claims.UserID)
+	if game.Visibility == data.VisibilityPrivate && !viewer.player {
+		return &gameError{status: http.StatusForbidden, message: "This game is private"}
+	}
+
+	channel := message.Channel
+	if channel == "" {
+		channel = defaultChannel(game, viewer)
+	}
+	if !slices.Contains(data.ChatChannels, channel) {
+		return &gameError{status: http.StatusBadRequest, message: "Unknown chat channel"}
+	}
+	if _, write := chatAccess(game, channel, viewer); !write {
+		return &gameError{status: http.StatusForbidden, message: "You cannot write to this channel"}
+	}
+	if !h.ChatLimiter.Allow(claims.UserID, time.Now()) {
+		return &gameError{status: http.StatusTooManyRequests, message: "You are sending messages too fast"}
+	}
+
+	stored := &data.ChatMessage{
+		GameID:   gameID,
+		Channel:  channel,
+		UserID:   claims.UserID,
+		Username: claims.Username,
+		Text:     h.ChatFilter.Clean(text),
+	}
+	if err := h.Chat.SaveChatMessage(stored); err != nil {
+		return internalError("Could not save message", err)
+	}
+
+	payload := events.ChatMessage{
+		ID:       stored.ID,
+		Channel:  channel,
+		UserID:   stored.UserID,
+		Username: stored.Username,
+		Text:     stored.Text,
+		SentAt:   stored.SentAt,
+	}
+	switch channel {
+	case data.ChatSpectators:
+		event := events.New(gameID, payload)
+		event.Audience = events.AudienceSpectators
+		h.Events.Publish(event)
+	case data.ChatDead:
+		// Отдельное личное событие каждому выбывшему
+		for _, player := range players {
+			userID, _ := player["user_id"].(int)
+			if chatViewerOf(game, players, userID).dead {
+				h.NotifyPlayer(gameID, userID, 0, payload)
+			}
+		}
+	default:
+		h.NotifyPlayers(gameID, 0, payload)
+	}
+	return nil
+}
+
+// ChatHistoryHandler pages back through a chat channel of a game:
+//
+//	GET /api/games/{id}/chat?channel=table&before=<next_before>&limit=1..200
+//
+// Spectators of a game with a spectator delay only get table and lobby
+// messages older than the delay.
+func (h *Handler) ChatHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	cookie, err := r.Cookie("token")
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	claims, err := data.ValidateJWT(cookie.Value)
+	if err != nil {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	gameID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid game ID", http.StatusBadRequest)
+		return
+	}
+
+	query, err := parseChatQuery(r, gameID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	game, err := h.Games.GetGameByID(gameID)
+	if err != nil {
+		http.Error(w, "Could not retrieve game", http.StatusInternalServerError)
+		return
+	}
+	if game == nil {
+		http.Error(w, "Game not found", http.StatusNotFound)
+		return
+	}
+	players, err := h.Games.GetPlayersInGame(gameID)
+	if err != nil {
+		http.Error(w, "Could not retrieve players", http.StatusInternalServerError)
+		return
+	}
+	viewer := chatViewerOf(game, players, claims.UserID)
+	if game.Visibility == data.VisibilityPrivate && !viewer.player {
+		http.Error(w, "This game is private", http.StatusForbidden)
+		return
+	}
+	if read, _ := chatAccess(game, query.Channel, viewer); !read {
+		http.Error(w, "You cannot read this channel", http.StatusForbidden)
+		return
+	}
+	if !viewer.player && query.Channel != data.ChatSpectators && game.Rules.SpectatorDelaySeconds > 0 {
+		query.SentBefore = time.Now().Add(-time.Duration(game.Rules.SpectatorDelaySeconds) * time.Second)
+	}
+
+	// Одна лишняя строка говорит, есть ли страница дальше
+	limit := query.Limit
+	query.Limit++
+	messages, err := h.Chat.GetChatMessages(query)
+	if err != nil {
+		http.Error(w, "Could not retrieve messages", http.StatusInternalServerError)
+		return
+	}
+
+	history := chatHistory{Messages: messages}
+	if len(messages) > limit {
+		history.Messages = messages[:limit]
+		history.NextBefore = history.Messages[limit-1].ID
+	}
+	slices.Reverse(history.Messages)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(history)
+}
+
+// parseChatQuery reads the channel and page of GET /api/games/{id}/chat
+func parseChatQuery(r *http.Request, gameID int) (data.ChatQuery, error) {
+	values := r.URL.Query()
+	query := data.ChatQuery{GameID: gameID, Channel: values.Get("channel"), Limit: defaultChatLimit}
+
+	if !slices.Contains(data.ChatChannels, query.Channel) {
+		return query, errors.New("channel must be lobby, table, spectators or dead")
+	}
+	if value := values.Get("before"); value != "" {
+		before, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || before <= 0 {
+			return query, errors.New("before must be a message ID")
+		}
+		query.BeforeID = before
+	}
+	if value := values.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxChatLimit {
+			return query, errors.New("limit must be between 1 and 200")
+		}
+		query.Limit = limit
+	}
+	return query, nil
+}
@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"backend/data"
+	"backend/db"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+)
+
+// gameError is a move rejected inside a game transaction, carrying the status
+// and message sent back to the player. Version conflicts also carry the
+// current state so the client can resync without another request.
+type gameError struct {
+	status  int
+	message string
+	state   *data.GameState
+}
+
+func (e *gameError) Error() string {
+	return e.message
+}
+
+// internalError logs the underlying cause and hides it behind message
+func internalError(message string, err error) error {
+	log.Printf("%s: %v", message, err)
+	return &gameError{status: http.StatusInternalServerError, message: message}
+}
+
+// writeGameError answers a failed move with the status carried by err
+func writeGameError(w http.ResponseWriter, err error) {
+	var ge *gameError
+	switch {
+	case errors.As(err, &ge) && ge.state != nil:
+		w.Header().Set("Content-Type", "application/json")
+		setVersionHeader(w, ge.state.Version)
+		w.WriteHeader(ge.status)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error": ge.message,
+			"state": ge.state,
+		})
+	case errors.As(err, &ge):
+		http.Error(w, ge.message, ge.status)
+	case errors.Is(err, db.ErrNoGameState):
+		http.Error(w, "Game state not found", http.StatusNotFound)
+	default:
+		log.Printf("Game transaction failed: %v", err)
+		http.Error(w, "Could not complete the move", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,435 @@
+package handlers
+
+import (
+	"backend/data"
+	"backend/events"
+	"backend/hub"
+	"backend/presence"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Page sizes of the user search
+const (
+	defaultUserSearchLimit = 20
+	maxUserSearchLimit     = 50
+	minUserSearchLength    = 2
+)
+
+// friendRequest is the body of the endpoints that name another user
+type friendRequest struct {
+	UserID int `json:"user_id"`
+}
+
+// friendEntry is a friend with their global presence
+type friendEntry struct {
+	data.Friend
+	Presence      presence.Status `json:"presence"`
+	PresenceSince time.Time       `json:"presence_since"`
+}
+
+// friendsList is the response of GET /api/friends
+type friendsList struct {
+	Friends  []friendEntry `json:"friends"`
+	Incoming []data.Friend `json:"incoming"` // requests waiting for the user's answer
+	Outgoing []data.Friend `json:"outgoing"` // the user's requests nobody answered yet
+	Blocked  []data.Friend `json:"blocked"`
+}
+
+// SearchUsersHandler finds users by part of their name, for adding friends:
+//
+//	GET /api/users?q=<at least 2 characters>&limit=1..50
+//
+// Only ids and usernames are returned, with the caller's relation to each.
+// Users who blocked the caller are not found.
+func (h *Handler) SearchUsersHandler(w http.ResponseWriter, r *http.Request) {
+	cookie, err := r.Cookie("token")
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	claims, err := data.ValidateJWT(cookie.Value)
+	if err != nil {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	query := data.UserSearch{
+		ViewerID: claims.UserID,
+		Query:    strings.TrimSpace(r.URL.Query().Get("q")),
+		Limit:    defaultUserSearchLimit,
+	}
+	if len([]rune(query.Query)) < minUserSearchLength {
+		http.Error(w, "q must be at least 2 characters", http.StatusBadRequest)
+		return
+	}
+	if value := r.URL.Query().Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxUserSearchLimit {
+			http.Error(w, "limit must be between 1 and 50", http.StatusBadRequest)
+			return
+		}
+		query.Limit = limit
+	}
+
+	users, err := h.Users.SearchUsers(query)
+	if err != nil {
+		log.Printf("User search failed: %v", err)
+		http.Error(w, "Could not search users", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(users)
+}
+
+// FriendsHandler lists the user's friends with their presence, the friend
+// requests both ways and the users they blocked
+func (h *Handler) FriendsHandler(w http.ResponseWriter, r *http.Request) {
+	cookie, err := r.Cookie("token")
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	claims, err := data.ValidateJWT(cookie.Value)
+	if err != nil {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	var list friendsList
+	friends, err := h.Friends.ListRelations(claims.UserID, data.RelationFriend)
+	if err == nil {
+		list.Incoming, err = h.Friends.ListFriendRequests(claims.UserID)
+	}
+	if err == nil {
+		list.Outgoing, err = h.Friends.ListRelations(claims.UserID, data.RelationPending)
+	}
+	if err == nil {
+		list.Blocked, err = h.Friends.ListRelations(claims.UserID, data.RelationBlocked)
+	}
+	if err != nil {
+		log.Printf("Could not list friends: %v", err)
+		http.Error(w, "Could not retrieve friends", http.StatusInternalServerError)
+		return
+	}
+
+	list.Friends = make([]friendEntry, len(friends))
+	for i, friend := range friends {
+		entry := h.Online.Get(hub.UserRoom, friend.UserID)
+		list.Friends[i] = friendEntry{Friend: friend, Presence: entry.Status, PresenceSince: entry.Since}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// SendFriendRequestHandler asks another user to be friends. When they had
+// already asked the user, the two simply become friends.
+func (h *Handler) SendFriendRequestHandler(w http.ResponseWriter, r *http.Request) {
+	cookie, err := r.Cookie("token")
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	claims, err := data.ValidateJWT(cookie.Value)
+	if err != nil {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	var request friendRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !h.otherUserExists(w, claims.UserID, request.UserID) {
+		return
+	}
+
+	mine, err := h.Friends.GetRelation(claims.UserID, request.UserID)
+	if err != nil {
+		http.Error(w, "Could not retrieve relation", http.StatusInternalServerError)
+		return
+	}
+	theirs, err := h.Friends.GetRelation(request.UserID, claims.UserID)
+	if err != nil {
+		http.Error(w, "Could not retrieve relation", http.StatusInternalServerError)
+		return
+	}
+
+	switch {
+	case mine == data.RelationBlocked:
+		http.Error(w, "You have blocked this user", http.StatusConflict)
+		return
+	case theirs == data.RelationBlocked:
+		// Не говорим, что пользователь нас заблокировал
+		http.Error(w, "You cannot send a friend request to this user", http.StatusForbidden)
+		return
+	case mine == data.RelationFriend:
+		http.Error(w, "You are already friends", http.StatusConflict)
+		return
+	case mine == data.RelationPending:
+		http.Error(w, "Friend request already sent", http.StatusConflict)
+		return
+	case theirs == data.RelationPending:
+		h.acceptFriendRequest(w, claims, request.UserID)
+		return
+	}
+
+	if err := h.Friends.CreateFriendRequest(claims.UserID, request.UserID); err != nil {
+		log.Printf("Could not send friend request: %v", err)
+		http.Error(w, "Could not send friend request", http.StatusInternalServerError)
+		return
+	}
+	h.NotifyUser(request.UserID, events.FriendRequestReceived{UserID: claims.UserID, Username: claims.Username})
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Friend request sent"})
+}
+
+// AcceptFriendRequestHandler accepts the friend request of user {id}
+func (h *Handler) AcceptFriendRequestHandler(w http.ResponseWriter, r *http.Request) {
+	h.friendRequestAnswerHandler(w, r, true)
+}
+
+// DeclineFriendRequestHandler turns the friend request of user {id} down.
+// The requester is not told.
+func (h *Handler) DeclineFriendRequestHandler(w http.ResponseWriter, r *http.Request) {
+	h.friendRequestAnswerHandler(w, r, false)
+}
+
+func (h *Handler) friendRequestAnswerHandler(w http.ResponseWriter, r *http.Request, accept bool) {
+	cookie, err := r.Cookie("token")
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	claims, err := data.ValidateJWT(cookie.Value)
+	if err != nil {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	requesterID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	if accept {
+		h.acceptFriendRequest(w, claims, requesterID)
+		return
+	}
+
+	declined, err := h.Friends.DeleteRelation(requesterID, claims.UserID, data.RelationPending)
+	if err != nil {
+		http.Error(w, "Could not decline friend request", http.StatusInternalServerError)
+		return
+	}
+	if !declined {
+		http.Error(w, "No pending friend request from this user", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Friend request declined"})
+}
+
+// acceptFriendRequest makes the user and requesterID friends and tells the
+// requester
+func (h *Handler) acceptFriendRequest(w http.ResponseWriter, claims *data.Claims, requesterID int) {
+	accepted, err := h.Friends.AcceptFriendRequest(claims.UserID, requesterID)
+	if err != nil {
+		log.Printf("Could not accept friend request: %v", err)
+		http.Error(w, "Could not accept friend request", http.StatusInternalServerError)
+		return
+	}
+	if !accepted {
+		http.Error(w, "No pending friend request from this user", http.StatusNotFound)
+		return
+	}
+	h.NotifyUser(requesterID, events.FriendRequestAccepted{UserID: claims.UserID, Username: claims.Username})
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Friend request accepted"})
+}
+
+// CancelFriendRequestHandler withdraws the user's request to user {id}
+func (h *Handler) CancelFriendRequestHandler(w http.ResponseWriter, r *http.Request) {
+	h.dropRelationHandler(w, r, data.RelationPending, "No pending friend request to this user", "Friend request cancelled")
+}
+
+// UnblockUserHandler lifts the user's block of user {id}
+func (h *Handler) UnblockUserHandler(w http.ResponseWriter, r *http.Request) {
+	h.dropRelationHandler(w, r, data.RelationBlocked, "You have not blocked this user", "User unblocked")
+}
+
+// RemoveFriendHandler ends the friendship with user {id}, for both of them
+func (h *Handler) RemoveFriendHandler(w http.ResponseWriter, r *http.Request) {
+	h.dropRelationHandler(w, r, data.RelationFriend, "You are not friends", "Friend removed")
+}
+
+// dropRelationHandler ends the user's relation in status to user {id}
+func (h *Handler) dropRelationHandler(w http.ResponseWriter, r *http.Request, status string, notFound string, message string) {
+	cookie, err := r.Cookie("token")
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	claims, err := data.ValidateJWT(cookie.Value)
+	if err != nil {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	otherID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	var dropped bool
+	if status == data.RelationFriend {
+		dropped, err = h.Friends.RemoveFriend(claims.UserID, otherID)
+	} else {
+		dropped, err = h.Friends.DeleteRelation(claims.UserID, otherID, status)
+	}
+	if err != nil {
+		log.Printf("Could not update relation: %v", err)
+		http.Error(w, "Could not update relation", http.StatusInternalServerError)
+		return
+	}
+	if !dropped {
+		http.Error(w, notFound, http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": message})
+}
+
+// BlockUserHandler blocks user {id}: a friendship or request between the two
+// ends, and the blocked user can neither befriend, invite nor find the user
+func (h *Handler) BlockUserHandler(w http.ResponseWriter, r *http.Request) {
+	cookie, err := r.Cookie("token")
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	claims, err := data.ValidateJWT(cookie.Value)
+	if err != nil {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	otherID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+	if !h.otherUserExists(w, claims.UserID, otherID) {
+		return
+	}
+
+	if err := h.Friends.BlockUser(claims.UserID, otherID); err != nil {
+		log.Printf("Could not block user: %v", err)
+		http.Error(w, "Could not block user", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "User blocked"})
+}
+
+// otherUserExists checks that otherID is a registered user other than userID.
+// On failure the error response is already written.
+func (h *Handler) otherUserExists(w http.ResponseWriter, userID int, otherID int) bool {
+	if otherID == userID {
+		http.Error(w, "You cannot do that to yourself", http.StatusBadRequest)
+		return false
+	}
+	other, err := h.Users.GetUserByID(otherID)
+	if err != nil {
+		http.Error(w, "Could not retrieve user", http.StatusInternalServerError)
+		return false
+	}
+	if other == nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return false
+	}
+	return true
+}
+
+// friendPresence is the publisher of Handler.Online: it passes every change
+// of a user's global presence on to their friends. The friend list comes from
+// the store and Publish must not block, so each user's changes are queued and
+// delivered in order by one worker, which exits once the queue is drained.
+type friendPresence struct {
+	h *Handler
+
+	mu sync.Mutex
+	// queued holds the statuses still to deliver per user; a user has a
+	// worker running exactly while they have an entry
+	queued map[int][]string
+}
+
+func newFriendPresence(h *Handler) *friendPresence {
+	return &friendPresence{h: h, queued: make(map[int][]string)}
+}
+
+func (p *friendPresence) Publish(event events.Event) {
+	changed, ok := event.Data.(events.PresenceChanged)
+	if !ok {
+		return
+	}
+	p.mu.Lock()
+	queue, running := p.queued[changed.PlayerID]
+	p.queued[changed.PlayerID] = append(queue, changed.Status)
+	p.mu.Unlock()
+	if !running {
+		go p.deliver(changed.PlayerID)
+	}
+}
+
+// deliver notifies the friends of userID of each queued status in turn
+func (p *friendPresence) deliver(userID int) {
+	for {
+		p.mu.Lock()
+		queue := p.queued[userID]
+		if len(queue) == 0 {
+			delete(p.queued, userID)
+			p.mu.Unlock()
+			return
+		}
+		status := queue[0]
+		p.queued[userID] = queue[1:]
+		p.mu.Unlock()
+
+		p.h.notifyFriends(userID, status)
+	}
+}
+
+// notifyFriends tells the friends of userID that their presence is now status
+func (h *Handler) notifyFriends(userID int, status string) {
+	friends, err := h.Friends.ListRelations(userID, data.RelationFriend)
+	if err != nil {
+		log.Printf("Could not notify friends of user %d: %v", userID, err)
+		return
+	}
+	for _, friend := range friends {
+		h.NotifyUser(friend.UserID, events.FriendPresenceChanged{UserID: userID, Status: status})
+	}
+}
@@ -3,12 +3,16 @@ package handlers
 import (
 	"backend/data"
 	"backend/db"
+	"backend/events"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"math/rand/v2"
 	"net/http"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
@@ -17,7 +21,7 @@ import (
 
 
 // CreateGameHandler handles the creation of a new game
-func CreateGameHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) CreateGameHandler(w http.ResponseWriter, r *http.Request) {
     cookie, err := r.Cookie("token")
     if err != nil {
         http.Error(w, "Unauthorized", http.StatusUnauthorized)
@@ -32,6 +36,11 @@ func CreateGameHandler(w http.ResponseWriter, r *http.Request) {
 
     var gameRequest struct {
         GameName string `json:"game_name"`
+        MaxSeats int    `json:"max_seats"` // optional, MaxPlayers otherwise
+        Rules    *data.GameRules `json:"rules"` // optional, DefaultGameRules otherwise
+        Visibility string `json:"visibility"` // optional, public otherwise
+        Password   string `json:"password"`   // optional, private games only
+        Expansions []string `json:"expansions"` // optional, names from data.Expansions
     }
 
     err = json.NewDecoder(r.Body).Decode(&gameRequest)
@@ -40,14 +49,73 @@ func CreateGameHandler(w http.ResponseWriter, r *http.Request) {
         return
     }
 
+    rules := data.DefaultGameRules
+    if gameRequest.Rules != nil {
+        rules = *gameRequest.Rules
+    }
+    if err := validateRules(rules); err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+
+    maxSeats := gameRequest.MaxSeats
+    if maxSeats == 0 {
+        maxSeats = data.MaxPlayers
+    }
+    if maxSeats < data.MinPlayers || maxSeats > data.MaxPlayers {
+        http.Error(w, fmt.Sprintf("max_seats must be between %d and %d", data.MinPlayers, data.MaxPlayers), http.StatusBadRequest)
+        return
+    }
+
     newGame := &data.Game{
-        GameName:  gameRequest.GameName,
-        CreatorID: claims.UserID,
-        Status:   "waiting",
-        CreatedAt: time.Now(),
+        GameName:   gameRequest.GameName,
+        CreatorID:  claims.UserID,
+        Status:     data.StatusWaiting,
+        CreatedAt:  time.Now(),
+        MaxSeats:   maxSeats,
+        Rules:      rules,
+        Visibility: gameRequest.Visibility,
+        Expansions: []string{},
+    }
+
+    for _, expansion := range gameRequest.Expansions {
+        if !data.IsExpansion(expansion) {
+            http.Error(w, "Unknown expansion: "+expansion, http.StatusBadRequest)
+            return
+        }
+        if !slices.Contains(newGame.Expansions, expansion) {
+            newGame.Expansions = append(newGame.Expansions, expansion)
+        }
     }
 
-    err = db.CreateGame(newGame)
+    switch newGame.Visibility {
+    case "":
+        newGame.Visibility = data.VisibilityPublic
+    case data.VisibilityPublic, data.VisibilityUnlisted, data.VisibilityPrivate:
+    default:
+        http.Error(w, "visibility must be public, unlisted or private", http.StatusBadRequest)
+        return
+    }
+
+    // Приватная игра получает код приглашения и, по желанию, пароль
+    if newGame.Visibility == data.VisibilityPrivate {
+        newGame.InviteCode, err = data.GenerateInviteCode()
+        if err != nil {
+            http.Error(w, "Could not generate invite code", http.StatusInternalServerError)
+            return
+        }
+        if gameRequest.Password != "" {
+            if err := newGame.SetPassword(gameRequest.Password); err != nil {
+                http.Error(w, "Could not set password", http.StatusInternalServerError)
+                return
+            }
+        }
+    } else if gameRequest.Password != "" {
+        http.Error(w, "Only private games can have a password", http.StatusBadRequest)
+        return
+    }
+
+    err = h.Games.CreateGame(newGame)
     if err != nil {
         http.Error(w, "Could not create game", http.StatusInternalServerError)
         return
@@ -55,7 +123,7 @@ func CreateGameHandler(w http.ResponseWriter, r *http.Request) {
     log.Println(newGame.GameName, "- Game Created!")
 
     // Add the creator to the game automatically
-    err = db.AddPlayerToGame(newGame.ID, claims.UserID)
+    err = h.Games.AddPlayerToGame(newGame.ID, claims.UserID)
     if err != nil {
         http.Error(w, "Could not add creator to game", http.StatusInternalServerError)
         return
@@ -66,26 +134,51 @@ func CreateGameHandler(w http.ResponseWriter, r *http.Request) {
     json.NewEncoder(w).Encode(newGame)
 }
 
-// GetAllGamesHandler возвращает список всех игр
-func GetAllGamesHandler(w http.ResponseWriter, r *http.Request) {
-    games, err := db.GetAllGames()
+// GetAllGamesHandler возвращает список игр: фильтры, сортировка и страницы
+// описаны в parseGameListQuery
+func (h *Handler) GetAllGamesHandler(w http.ResponseWriter, r *http.Request) {
+    cookie, err := r.Cookie("token")
+    if err != nil {
+        http.Error(w, "Unauthorized", http.StatusUnauthorized)
+        return
+    }
+
+    claims, err := data.ValidateJWT(cookie.Value)
     if err != nil {
-        log.Println("GetAllGamesHandler error!")
+        http.Error(w, "Invalid token", http.StatusUnauthorized)
+        return
+    }
+
+    // Непубличные игры видят только их игроки
+    query, err := parseGameListQuery(r.URL.Query(), claims.UserID)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+
+    // Берём на одну игру больше, чтобы знать, есть ли следующая страница
+    limit := query.Limit
+    query.Limit++
+    games, total, err := h.Games.ListGames(query)
+    if err != nil {
+        log.Println("GetAllGamesHandler error:", err)
         http.Error(w, "Could not retrieve games", http.StatusInternalServerError)
         return
     }
 
-    if len(games) == 0 {
-        log.Println("Currently No Games!")
+    list := gameList{Games: games, Total: total}
+    if len(games) > limit {
+        list.Games = games[:limit]
+        list.NextCursor = encodeGameCursor(query.Sort, list.Games[limit-1])
     }
 
     w.Header().Set("Content-Type", "application/json")
     w.WriteHeader(http.StatusOK)
-    json.NewEncoder(w).Encode(games)
+    json.NewEncoder(w).Encode(list)
 }
 
 // GetGameDetailsHandler returns detailed information about a specific game
-func GetGameDetailsHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) GetGameDetailsHandler(w http.ResponseWriter, r *http.Request) {
     cookie, err := r.Cookie("token")
     if err != nil {
         http.Error(w, "Unauthorized", http.StatusUnauthorized)
@@ -108,7 +201,7 @@ func GetGameDetailsHandler(w http.ResponseWriter, r *http.Request) {
         return
     }
 
-    game, err := db.GetGameByID(gameID)
+    game, err := h.Games.GetGameByID(gameID)
     if err != nil {
         http.Error(w, "Could not retrieve game", http.StatusInternalServerError)
         return
@@ -119,15 +212,45 @@ func GetGameDetailsHandler(w http.ResponseWriter, r *http.Request) {
         return
     }
 
-    players, err := db.GetPlayersInGame(gameID)
+    players, err := h.Games.GetPlayersInGame(gameID)
     if err != nil {
         http.Error(w, "Could not retrieve players", http.StatusInternalServerError)
         return
     }
 
+    isPlayer := hasPlayer(players, claims.UserID)
+    if game.Visibility == data.VisibilityPrivate && !isPlayer {
+        http.Error(w, "This game is private", http.StatusForbidden)
+        return
+    }
+
+    // Состояние есть только у запущенной игры; версия нужна клиенту для If-Match
+    gameState, err := h.Process.GetGameState(gameID)
+    if err != nil {
+        http.Error(w, "Could not retrieve game state", http.StatusInternalServerError)
+        return
+    }
+
+    // Кто из игроков сейчас подключён
+    h.withPresence(gameID, players)
+    players = publicPlayers(game, players, claims.UserID)
+
+    // Spectators of a delayed game get the state from their stream, late
+    if !isPlayer && game.Rules.SpectatorDelaySeconds > 0 && game.Status == data.StatusInProgress {
+        gameState = nil
+        for _, player := range players {
+            delete(player, "health")
+        }
+    }
+    if gameState != nil {
+        setVersionHeader(w, gameState.Version)
+    }
+
     gameDetails := map[string]interface{}{
-        "game":    game,
-        "players": players,
+        "game":       game,
+        "players":    players,
+        "state":      gameState,
+        "spectators": h.Hub.Spectators(gameID),
     }
 
     w.WriteHeader(http.StatusOK)
@@ -136,7 +259,7 @@ func GetGameDetailsHandler(w http.ResponseWriter, r *http.Request) {
 
 // JoinGameHandler handles players joining an existing game
 // JoinGameHandler handles players joining an existing game
-func JoinGameHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) JoinGameHandler(w http.ResponseWriter, r *http.Request) {
     // Получаем токен из cookie
     cookie, err := r.Cookie("token")
     if err != nil {
@@ -152,8 +275,11 @@ func JoinGameHandler(w http.ResponseWriter, r *http.Request) {
     }
 
     // Получаем данные запроса
+    // Приватная игра открывается по коду приглашения, без game_id
     var joinRequest struct {
-        GameID int `json:"game_id"`
+        GameID     int    `json:"game_id"`
+        InviteCode string `json:"invite_code"`
+        Password   string `json:"password"`
     }
 
     err = json.NewDecoder(r.Body).Decode(&joinRequest)
@@ -162,50 +288,187 @@ func JoinGameHandler(w http.ResponseWriter, r *http.Request) {
         return
     }
 
-    // Проверяем, существует ли игра
-    game, err := db.GetGameByID(joinRequest.GameID)
+    var game *data.Game
+    if joinRequest.InviteCode != "" {
+        game, err = h.Games.GetGameByInviteCode(strings.ToUpper(strings.TrimSpace(joinRequest.InviteCode)))
+    } else {
+        game, err = h.Games.GetGameByID(joinRequest.GameID)
+    }
     if err != nil {
         http.Error(w, "Could not retrieve game", http.StatusInternalServerError)
         return
     }
-
-    if game == nil {
+    if game == nil || (joinRequest.GameID != 0 && game.ID != joinRequest.GameID) {
         http.Error(w, "Game not found", http.StatusNotFound)
         return
     }
 
-    // Проверяем, что создатель игры не может присоединиться к своей игре
-    if game.CreatorID == claims.UserID {
-        http.Error(w, "Creator cannot join their own game", http.StatusForbidden)
+    if game.Visibility == data.VisibilityPrivate {
+        if joinRequest.InviteCode == "" {
+            http.Error(w, "This game is private, an invite code is required", http.StatusForbidden)
+            return
+        }
+        if err := game.CheckPassword(joinRequest.Password); err != nil {
+            http.Error(w, "Wrong password", http.StatusForbidden)
+            return
+        }
+    }
+    joinRequest.GameID = game.ID
+
+    // Места проверяются под блокировкой игры, чтобы одновременные входы не превысили лимит
+    var seats, maxSeats int
+    err = h.Games.InLobbyTx(joinRequest.GameID, func(tx db.GameStore, game *data.Game) error {
+        if game.Status != data.StatusWaiting {
+            return &gameError{status: http.StatusConflict, message: "Game has already started"}
+        }
+
+        // Проверяем, что пользователь ещё не присоединился к игре
+        alreadyJoined, err := tx.CheckPlayerExists(game.ID, claims.UserID)
+        if err != nil {
+            return internalError("Could not check player existence", err)
+        }
+        if alreadyJoined {
+            return &gameError{status: http.StatusConflict, message: "Player already joined this game"}
+        }
+
+        players, err := tx.GetPlayersInGame(game.ID)
+        if err != nil {
+            return internalError("Could not retrieve players", err)
+        }
+        if len(players) >= game.MaxSeats {
+            return &gameError{status: http.StatusConflict, message: "Game is full"}
+        }
+
+        // Добавляем игрока в игру
+        if err := tx.AddPlayerToGame(game.ID, claims.UserID); err != nil {
+            return internalError("Could not join game", err)
+        }
+        seats, maxSeats = len(players)+1, game.MaxSeats
+        return nil
+    })
+    if err != nil {
+        writeLobbyError(w, err)
         return
     }
 
-    // Проверяем, что пользователь ещё не присоединился к игре
-    alreadyJoined, err := db.CheckPlayerExists(joinRequest.GameID, claims.UserID)
+    h.NotifyPlayers(joinRequest.GameID, 0, events.PlayerJoined{
+        PlayerID: claims.UserID,
+        Username: claims.Username,
+        Seats:    seats,
+        MaxSeats: maxSeats,
+    })
+
+    w.WriteHeader(http.StatusOK)
+    json.NewEncoder(w).Encode(map[string]string{"message": "Joined game successfully"})
+}
+
+// ReadyHandler sets whether a player in the lobby is ready to start. The body
+// {"ready": true} sets the flag; without it the flag is toggled. A rematch
+// starts as soon as enough players are seated and all of them are ready.
+func (h *Handler) ReadyHandler(w http.ResponseWriter, r *http.Request) {
+    cookie, err := r.Cookie("token")
     if err != nil {
-        http.Error(w, "Could not check player existence", http.StatusInternalServerError)
+        http.Error(w, "Unauthorized", http.StatusUnauthorized)
         return
     }
 
-    if alreadyJoined {
-        http.Error(w, "Player already joined this game", http.StatusConflict)
+    claims, err := data.ValidateJWT(cookie.Value)
+    if err != nil {
+        http.Error(w, "Invalid token", http.StatusUnauthorized)
         return
     }
 
-    // Добавляем игрока в игру
-    err = db.AddPlayerToGame(joinRequest.GameID, claims.UserID)
+    gameID, err := strconv.Atoi(mux.Vars(r)["id"])
     if err != nil {
-        http.Error(w, "Could not join game", http.StatusInternalServerError)
+        http.Error(w, "Invalid game ID", http.StatusBadRequest)
         return
     }
 
-    w.WriteHeader(http.StatusOK)
-    json.NewEncoder(w).Encode(map[string]string{"message": "Joined game successfully"})
+    var readyRequest struct {
+        Ready *bool `json:"ready"`
+    }
+    if err := decodeOptionalBody(r, &readyRequest); err != nil {
+        http.Error(w, "Invalid request body", http.StatusBadRequest)
+        return
+    }
+
+    var ready bool
+    var readyCount, playerCount int
+    var started *data.GameState
+    err = h.Games.InLobbyTx(gameID, func(tx db.GameStore, game *data.Game) error {
+        if game.Status != data.StatusWaiting {
+            return &gameError{status: http.StatusConflict, message: "Game has already started"}
+        }
+
+        players, err := tx.GetPlayersInGame(gameID)
+        if err != nil {
+            return internalError("Could not retrieve players", err)
+        }
+        var player map[string]interface{}
+        for _, p := range players {
+            if p["user_id"] == claims.UserID {
+                player = p
+            }
+        }
+        if player == nil {
+            return &gameError{status: http.StatusForbidden, message: "You are not a player in this game"}
+        }
+
+        ready = !player["ready"].(bool)
+        if readyRequest.Ready != nil {
+            ready = *readyRequest.Ready
+        }
+        if err := tx.SetPlayerReady(gameID, claims.UserID, ready); err != nil {
+            return internalError("Could not update ready status", err)
+        }
+
+        player["ready"] = ready
+        for _, p := range players {
+            if p["ready"].(bool) {
+                readyCount++
+            }
+        }
+        playerCount = len(players)
+
+        // Реванш стартует сам, когда все сели и готовы
+        if game.RematchOf == 0 || !ready {
+            return nil
+        }
+        started, err = autoStart(tx, game)
+        return err
+    })
+    if err != nil {
+        writeLobbyError(w, err)
+        return
+    }
+
+    h.NotifyPlayers(gameID, 0, events.ReadyChanged{
+        PlayerID:   claims.UserID,
+        Ready:      ready,
+        ReadyCount: readyCount,
+        Players:    playerCount,
+    })
+    if started != nil {
+        h.notifyRoles(gameID)
+        h.armTimer(gameID, started)
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]bool{"ready": ready})
+}
+
+// writeLobbyError answers a failed lobby transaction
+func writeLobbyError(w http.ResponseWriter, err error) {
+    if errors.Is(err, db.ErrNoGame) {
+        http.Error(w, "Game not found", http.StatusNotFound)
+        return
+    }
+    writeGameError(w, err)
 }
 
 
 // StartGameHandler handles the logic to start a new game
-func StartGameHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) StartGameHandler(w http.ResponseWriter, r *http.Request) {
     cookie, err := r.Cookie("token")
     if err != nil {
         http.Error(w, "Unauthorized", http.StatusUnauthorized)
@@ -228,42 +491,118 @@ func StartGameHandler(w http.ResponseWriter, r *http.Request) {
         return
     }
 
-    game, err := db.GetGameByID(gameID)
+    // Проверки и раздача ролей идут под блокировкой игры: никто не войдёт и не
+    // снимет готовность между проверкой и стартом
+    var state *data.GameState
+    err = h.Games.InLobbyTx(gameID, func(tx db.GameStore, game *data.Game) error {
+        if game.CreatorID != claims.UserID {
+            return &gameError{status: http.StatusForbidden, message: "Only the creator can start the game"}
+        }
+
+        if game.Status != data.StatusWaiting {
+            return &gameError{status: http.StatusConflict, message: "Game has already started"}
+        }
+
+        players, err := tx.GetPlayersInGame(gameID)
+        if err != nil {
+            return internalError("Could not retrieve players", err)
+        }
+        state, err = startGame(tx, game, players)
+        return err
+    })
     if err != nil {
-        http.Error(w, "Could not retrieve game", http.StatusInternalServerError)
+        writeLobbyError(w, err)
         return
     }
 
-    if game == nil {
-        http.Error(w, "Game not found", http.StatusNotFound)
-        return
+    h.notifyRoles(gameID)
+    h.armTimer(gameID, state)
+
+    w.WriteHeader(http.StatusOK)
+    json.NewEncoder(w).Encode(map[string]string{"message": "Game started successfully"})
+}
+
+// startGame deals roles, characters and the opening hands and moves the lobby
+// to in_progress with the Sheriff to draw, once there are enough players and
+// all of them are ready. It must run inside InLobbyTx; the caller arms the
+// first turn's timer with the returned state after the commit.
+func startGame(tx db.GameStore, game *data.Game, players []map[string]interface{}) (*data.GameState, error) {
+    if len(players) < data.MinPlayers {
+        return nil, &gameError{status: http.StatusBadRequest, message: "Not enough players to start the game"}
     }
 
-    players, err := db.GetPlayersInGame(gameID)
+    for _, player := range players {
+        if ready, _ := player["ready"].(bool); !ready {
+            return nil, &gameError{status: http.StatusBadRequest, message: "Not all players are ready"}
+        }
+    }
+
+    if err := AssignRolesAndCharacters(tx, game.ID); err != nil {
+        return nil, internalError("Could not assign roles and characters", err)
+    }
+
+    state, err := dealOpeningHands(tx, game)
     if err != nil {
-        http.Error(w, "Could not retrieve players", http.StatusInternalServerError)
-        return
+        return nil, internalError("Could not deal cards", err)
     }
 
-    if len(players) < 4 {
-        http.Error(w, "Not enough players to start the game", http.StatusBadRequest)
-        return
+    if err := tx.UpdateGameStatus(game.ID, data.StatusInProgress); err != nil {
+        return nil, internalError("Could not start game", err)
     }
+    return state, nil
+}
 
-    err = AssignRolesAndCharacters(gameID)
+// dealOpeningHands shuffles a new deck, deals every player as many cards as
+// they have health and creates the game state with the Sheriff's first turn
+func dealOpeningHands(tx db.GameStore, game *data.Game) (*data.GameState, error) {
+    // Роли уже розданы, поэтому читаем игроков заново
+    players, err := tx.GetPlayersInGame(game.ID)
     if err != nil {
-        http.Error(w, "Could not assign roles and characters", http.StatusInternalServerError)
-        return
+        return nil, err
     }
-    
-    game.Status = "Started"
-    w.WriteHeader(http.StatusOK)
-    json.NewEncoder(w).Encode(map[string]string{"message": "Game started successfully"})
+
+    if err := tx.GenerateDeck(game.ID); err != nil {
+        return nil, err
+    }
+
+    var sheriffID int
+    for _, player := range players {
+        userID, _ := player["user_id"].(int)
+        health, _ := player["health"].(int)
+        if role, _ := player["role"].(string); role == "Sheriff" {
+            sheriffID = userID
+        }
+
+        for i := 0; i < health; i++ {
+            card, err := tx.DrawCard(game.ID)
+            if err != nil {
+                return nil, err
+            }
+            if err := tx.AddCardToPlayerHand(userID, game.ID, card.ID); err != nil {
+                return nil, err
+            }
+        }
+    }
+    if sheriffID == 0 {
+        return nil, fmt.Errorf("no Sheriff in game %d", game.ID)
+    }
+
+    state := &data.GameState{
+        ID:           game.ID,
+        CurrentTurn:  sheriffID,
+        CurrentPhase: "draw",
+        TurnDeadline: turnDeadline(game.Rules),
+    }
+    if err := tx.CreateGameState(state); err != nil {
+        return nil, err
+    }
+    return state, nil
 }
 
-func AssignRolesAndCharacters(gameID int) error {
+// AssignRolesAndCharacters deals a role and a character to every player of the game
+func AssignRolesAndCharacters(games db.GameStore, gameID int) error {
     // Получаем игроков в игре
-    players, err := db.GetPlayersInGame(gameID)
+    players, err := games.GetPlayersInGame(gameID)
     if err != nil {
         log.Println("Error in Getting Players List")
         return err
@@ -281,13 +620,13 @@ func AssignRolesAndCharacters(gameID int) error {
     }
 
     // Получаем доступные персонажи и роли
-    characters, err := db.GetAvailableCharacters(gameID, numPlayers)
+    characters, err := games.GetAvailableCharacters(gameID, numPlayers)
     if err != nil {
         log.Println("Error getting characters:", err)
         return err
     }
 
-    roles, err := db.GetRolesByPlayerCount(numPlayers)
+    roles, err := games.GetRolesByPlayerCount(numPlayers)
     if err != nil {
         log.Println("Error getting roles")
         return err
@@ -319,7 +658,7 @@ func AssignRolesAndCharacters(gameID int) error {
         }
 
         // Обновляем информацию о роли и персонаже в базе данных
-        err := db.UpdatePlayerRoleAndCharacter(playerID, role.Name, character.Name, health)
+        err := games.UpdatePlayerRoleAndCharacter(playerID, role.Name, character.Name, health)
         if err != nil {
             log.Println("Error UpdatePlayerRoleAndCharacter")
             return err
@@ -331,8 +670,35 @@ func AssignRolesAndCharacters(gameID int) error {
 
 
 
+// notifyRoles reveals the Sheriff to everyone and sends every player their
+// own role privately
+func (h *Handler) notifyRoles(gameID int) {
+    players, err := h.Games.GetPlayersInGame(gameID)
+    if err != nil {
+        log.Println("Could not load players to announce roles:", err)
+        return
+    }
+
+    started := events.GameStarted{Characters: make(map[int]string)}
+    for _, player := range players {
+        userID := player["user_id"].(int)
+        role, _ := player["role"].(string)
+        character, _ := player["character"].(string)
+        health, _ := player["health"].(int)
+
+        started.Characters[userID] = character
+        if role == data.RoleSheriff {
+            started.SheriffID = userID
+        }
+
+        h.NotifyPlayer(gameID, userID, 0, events.RoleAssigned{Role: role, Character: character, Health: health})
+    }
+
+    h.NotifyPlayers(gameID, 0, started)
+}
+
 // DeleteGameHandler handles the deletion of a game
-func DeleteGameHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) DeleteGameHandler(w http.ResponseWriter, r *http.Request) {
     cookie, err := r.Cookie("token")
     if err != nil {
         http.Error(w, "Unauthorized", http.StatusUnauthorized)
@@ -354,7 +720,7 @@ func DeleteGameHandler(w http.ResponseWriter, r *http.Request) {
         return
     }
 
-    game, err := db.GetGameByID(gameID)
+    game, err := h.Games.GetGameByID(gameID)
     if err != nil {
         http.Error(w, "Could not retrieve game", http.StatusInternalServerError)
         return
@@ -370,12 +736,30 @@ func DeleteGameHandler(w http.ResponseWriter, r *http.Request) {
         return
     }
 
-    err = db.DeleteGame(gameID)
+    err = h.Games.DeleteGame(gameID)
     if err != nil {
         http.Error(w, "Could not delete game", http.StatusInternalServerError)
         return
     }
+    h.forgetGame(gameID)
 
     w.WriteHeader(http.StatusOK)
     json.NewEncoder(w).Encode(map[string]string{"message": "Game deleted successfully"})
-}
\ No newline at end of file
+}
+
+// forgetGame drops everything kept in memory for a deleted game
+func (h *Handler) forgetGame(gameID int) {
+    h.Hub.Forget(gameID)
+    h.Presence.Forget(gameID)
+    h.Timers.Cancel(gameID)
+}
+
+// hasPlayer reports whether userID is among players
+func hasPlayer(players []map[string]interface{}, userID int) bool {
+    for _, player := range players {
+        if player["user_id"] == userID {
+            return true
+        }
+    }
+    return false
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"backend/data"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Page sizes of the game list
+const (
+	defaultGameListLimit = 20
+	maxGameListLimit     = 100
+)
+
+// gameList is the response of GET /api/games. NextCursor is set while more
+// games follow; pass it back as ?cursor= with the same filters and sort.
+type gameList struct {
+	Games      []data.GameSummary `json:"games"`
+	Total      int                `json:"total"`
+	NextCursor string             `json:"next_cursor,omitempty"`
+}
+
+// gameListCursor is what an opaque cursor encodes. The sort is kept so a
+// cursor cannot be replayed against another order.
+type gameListCursor struct {
+	Sort string `json:"s"`
+	data.GameCursor
+}
+
+// parseGameListQuery reads the filters of GET /api/games:
+//
+//	status=waiting|in_progress|finished|aborted  has_open_seat=true  creator=<username>
+//	q=<part of the name>  expansion=<name>  sort=newest|oldest|name
+//	limit=1..100  cursor=<next_cursor of the previous page>
+func parseGameListQuery(values url.Values, viewerID int) (data.GameListQuery, error) {
+	query := data.GameListQuery{
+		ViewerID:  viewerID,
+		Status:    values.Get("status"),
+		Creator:   values.Get("creator"),
+		Search:    values.Get("q"),
+		Expansion: values.Get("expansion"),
+		Sort:      values.Get("sort"),
+		Limit:     defaultGameListLimit,
+	}
+
+	switch query.Status {
+	case "", data.StatusWaiting, data.StatusInProgress, data.StatusFinished, data.StatusAborted:
+	default:
+		return query, errors.New("status must be waiting, in_progress, finished or aborted")
+	}
+
+	if value := values.Get("has_open_seat"); value != "" {
+		open, err := strconv.ParseBool(value)
+		if err != nil {
+			return query, errors.New("has_open_seat must be true or false")
+		}
+		query.HasOpenSeat = open
+	}
+
+	if query.Expansion != "" && !data.IsExpansion(query.Expansion) {
+		return query, errors.New("unknown expansion")
+	}
+
+	switch query.Sort {
+	case "":
+		query.Sort = data.GameSortNewest
+	case data.GameSortNewest, data.GameSortOldest, data.GameSortName:
+	default:
+		return query, errors.New("sort must be newest, oldest or name")
+	}
+
+	if value := values.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxGameListLimit {
+			return query, errors.New("limit must be between 1 and 100")
+		}
+		query.Limit = limit
+	}
+
+	if value := values.Get("cursor"); value != "" {
+		cursor, err := decodeGameCursor(value, query.Sort)
+		if err != nil {
+			return query, err
+		}
+		query.After = cursor
+	}
+	return query, nil
+}
+
+func encodeGameCursor(sort string, game data.GameSummary) string {
+	raw, _ := json.Marshal(gameListCursor{
+		Sort:       sort,
+		GameCursor: data.GameCursor{Key: game.SortKey(sort), ID: game.ID},
+	})
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeGameCursor(value string, sort string) (*data.GameCursor, error) {
+	invalid := errors.New("invalid cursor")
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, invalid
+	}
+	var cursor gameListCursor
+	if err := json.Unmarshal(raw, &cursor); err != nil || cursor.Sort != sort {
+		return nil, invalid
+	}
+	if sort != data.GameSortName {
+		if _, err := time.Parse(time.RFC3339Nano, cursor.Key); err != nil {
+			return nil, invalid
+		}
+	}
+	return &cursor.GameCursor, nil
+}
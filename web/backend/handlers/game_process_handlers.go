@@ -3,18 +3,47 @@ package handlers
 import (
 	"backend/data"
 	"backend/db"
+	"backend/events"
 	"backend/utils"
 	"encoding/json"
 	"fmt"
-	"log"
 	"net/http"
 	"strconv"
+	"time"
+
 	"github.com/gorilla/mux"
-	"github.com/gorilla/websocket"
 )
 
+// Move bodies are shared by the REST handlers and the WebSocket commands, so
+// both transports go through the same validation below.
+
+// turnMove is the body of draw and end_turn
+type turnMove struct {
+	ExpectedVersion *int64 `json:"expected_version"`
+}
+
+// playCardMove is the body of play_card
+type playCardMove struct {
+	CardID          int    `json:"card_id"`
+	TargetID        int    `json:"target_id"`
+	ExpectedVersion *int64 `json:"expected_version"`
+}
+
+// respondMove is the body of respond: card_id is the Missed! played
+// against a pending Bang!, 0 takes the hit
+type respondMove struct {
+	CardID          int    `json:"card_id"`
+	ExpectedVersion *int64 `json:"expected_version"`
+}
+
+// discardMove is the body of discard
+type discardMove struct {
+	CardID          int    `json:"card_id"`
+	ExpectedVersion *int64 `json:"expected_version"`
+}
+
 // StartTurnHandler starts the player's turn
-func StartTurnHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) StartTurnHandler(w http.ResponseWriter, r *http.Request) {
 	cookie, err := r.Cookie("token")
 	if err != nil {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
@@ -34,45 +63,90 @@ func StartTurnHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	gameState, err := db.GetGameState(gameID)
+	var turnRequest turnMove
+	if err := decodeOptionalBody(r, &turnRequest); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	expected, err := expectedVersion(r, turnRequest.ExpectedVersion)
 	if err != nil {
-		http.Error(w, "Could not retrieve game state", http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	if gameState.CurrentTurn != claims.UserID {
-		http.Error(w, "It's not your turn", http.StatusForbidden)
+	committed, err := h.startTurn(gameID, claims.UserID, expected)
+	if err != nil {
+		writeGameError(w, err)
 		return
 	}
+	writeMoveResult(w, committed, "Turn started. Draw phase complete.")
+}
 
-	for i := 0; i < 2; i++ {
-		card, err := db.DrawCard(gameID)
-		if err != nil {
-			http.Error(w, "Could not draw card", http.StatusInternalServerError)
-			return
+// recordActivity marks the game active for a move the player made. Moves the
+// turn timer makes for an absent player do not count, so the janitor still
+// aborts a game nobody plays.
+func recordActivity(tx db.GameProcessStore, gameID int, byTimer bool) error {
+	if byTimer {
+		return nil
+	}
+	if err := tx.TouchGame(gameID); err != nil {
+		return internalError("Could not record activity", err)
+	}
+	return nil
+}
+
+// startTurn draws two cards for the player whose turn it is
+func (h *Handler) startTurn(gameID int, userID int, expected *int64) (*data.GameState, error) {
+	// Проверка хода, добор карт и смена фазы выполняются в одной транзакции
+	var drawn []*data.Card
+	var committed *data.GameState
+	err := h.Process.InGameTx(gameID, func(tx db.GameProcessStore, gameState *data.GameState) error {
+		committed = gameState
+		if err := checkVersion(gameState, expected); err != nil {
+			return err
 		}
-		err = db.AddCardToPlayerHand(claims.UserID, gameID, card.ID)
-		if err != nil {
-			http.Error(w, "Could not add card to hand", http.StatusInternalServerError)
-			return
+		if err := recordActivity(tx, gameID, false); err != nil {
+			return err
 		}
-	}
 
-	err = db.UpdateGameStatePhase(gameID, "play")
-	if err != nil {
-		http.Error(w, "Could not update game phase", http.StatusInternalServerError)
-		return
-	}
+		if gameState.CurrentTurn != userID {
+			return &gameError{status: http.StatusForbidden, message: "It's not your turn"}
+		}
 
-	NotifyPlayers(gameID, "turn_started", map[string]interface{}{
-		"player_id": claims.UserID,
+		if gameState.CurrentPhase != "draw" {
+			return &gameError{status: http.StatusConflict, message: "You have already drawn this turn"}
+		}
+
+		for i := 0; i < 2; i++ {
+			card, err := tx.DrawCard(gameID)
+			if err != nil {
+				return internalError("Could not draw card", err)
+			}
+			err = tx.AddCardToPlayerHand(userID, gameID, card.ID)
+			if err != nil {
+				return internalError("Could not add card to hand", err)
+			}
+			drawn = append(drawn, card)
+		}
+
+		err := tx.UpdateGameStatePhase(gameID, "play")
+		if err != nil {
+			return internalError("Could not update game phase", err)
+		}
+		return nil
 	})
+	if err != nil {
+		return nil, err
+	}
 
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"message": "Turn started. Draw phase complete."})
+	// Остальные видят только количество карт, сами карты получает игрок
+	h.NotifyPlayers(gameID, committed.Version, events.TurnStarted{PlayerID: userID, CardsDrawn: len(drawn)})
+	h.NotifyPlayer(gameID, userID, committed.Version, events.CardsDrawn{Cards: drawn})
+	h.armTimer(gameID, committed)
+	return committed, nil
 }
 
-func PlayCardHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) PlayCardHandler(w http.ResponseWriter, r *http.Request) {
 	// Получаем токен и проверяем пользователя
 	cookie, err := r.Cookie("token")
 	if err != nil {
@@ -94,115 +168,365 @@ func PlayCardHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var cardRequest struct {
-		CardID   int `json:"card_id"`
-		TargetID int `json:"target_id"`
-	}
+	var cardRequest playCardMove
 	err = json.NewDecoder(r.Body).Decode(&cardRequest)
 	if err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
-	// Проверяем текущее состояние игры
-	gameState, err := db.GetGameState(gameID)
+	expected, err := expectedVersion(r, cardRequest.ExpectedVersion)
 	if err != nil {
-		http.Error(w, "Could not retrieve game state", http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	if gameState == nil {
-		http.Error(w, "Game state not found", http.StatusNotFound)
+
+	committed, err := h.playCard(gameID, claims.UserID, cardRequest, expected)
+	if err != nil {
+		writeGameError(w, err)
 		return
 	}
+	writeMoveResult(w, committed, "Card played successfully")
+}
+
+// playCard plays a card from the hand of the player whose turn it is
+func (h *Handler) playCard(gameID int, userID int, cardRequest playCardMove, expected *int64) (*data.GameState, error) {
+	// Цель должна быть другим игроком этой партии
+	if cardRequest.TargetID == userID {
+		return nil, &gameError{status: http.StatusBadRequest, message: "You cannot target yourself"}
+	}
+	if cardRequest.TargetID != 0 {
+		exists, err := h.Games.CheckPlayerExists(gameID, cardRequest.TargetID)
+		if err != nil {
+			return nil, internalError("Could not check target", err)
+		}
+		if !exists {
+			return nil, &gameError{status: http.StatusBadRequest, message: "Target is not a player in this game"}
+		}
+	}
+
+	rules, err := h.gameRules(gameID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Проверка, сброс карты и её эффект — одна транзакция с блокировкой game_state.
+	// При любой ошибке всё откатывается, и игроки ничего не получают.
+	pending := &events.Batch{}
+	effects := &utils.EffectContext{
+		GameID:          gameID,
+		Events:          pending,
+		ResponseTimeout: time.Duration(rules.ResponseSeconds) * time.Second,
+		TurnTimeout:     time.Duration(rules.TurnSeconds) * time.Second,
+	}
+	var committed *data.GameState
+	err = h.Process.InGameTx(gameID, func(tx db.GameProcessStore, gameState *data.GameState) error {
+		committed = gameState
+		if err := checkVersion(gameState, expected); err != nil {
+			return err
+		}
+		if err := recordActivity(tx, gameID, false); err != nil {
+			return err
+		}
+
+		if gameState.CurrentTurn != userID {
+			return &gameError{status: http.StatusForbidden, message: "It's not your turn"}
+		}
+
+		if gameState.CurrentPhase != "play" {
+			return &gameError{status: http.StatusForbidden, message: "You cannot play a card outside of the play phase"}
+		}
+
+		if cardRequest.TargetID != 0 {
+			players, err := tx.GetGamePlayers(gameID)
+			if err != nil {
+				return internalError("Could not check target", err)
+			}
+			for _, p := range players {
+				if p.UserID == cardRequest.TargetID && p.Health <= 0 {
+					return &gameError{status: http.StatusBadRequest, message: "Target has been eliminated"}
+				}
+			}
+		}
+
+		// Получаем название карты по ID
+		card, err := tx.GetCardByID(cardRequest.CardID)
+		if err != nil {
+			return internalError("Could not retrieve card", err)
+		}
+		if card == nil {
+			return &gameError{status: http.StatusNotFound, message: "Card not found"}
+		}
+
+		// Проверяем, есть ли у игрока эта карта на руке
+		hasCard, err := tx.CheckPlayerHasCard(userID, gameID, card.Name)
+		if err != nil {
+			return internalError("Could not check player hand", err)
+		}
+		if !hasCard {
+			return &gameError{status: http.StatusForbidden, message: "You don't have this card"}
+		}
+
+		// Удаляем карту из руки игрока
+		err = tx.RemoveCardFromPlayerHand(userID, gameID, cardRequest.CardID)
+		if err != nil {
+			return internalError("Could not remove card from hand", err)
+		}
+
+		// Добавляем карту в сброс
+		err = tx.DiscardCard(gameID, cardRequest.CardID)
+		if err != nil {
+			return internalError("Could not discard card", err)
+		}
+
+		// Применяем эффект карты
+		effects.Store = tx
+		err = h.ApplyCardEffect(effects, userID, cardRequest.CardID, cardRequest.TargetID)
+		if err != nil {
+			return internalError(fmt.Sprintf("Could not apply card effect: %v", err), err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
 
-	if gameState.CurrentTurn != claims.UserID {
-		http.Error(w, "It's not your turn", http.StatusForbidden)
+	// Отправляем уведомления игрокам через WebSocket только после коммита
+	pending.Flush(h.Events, committed.Version)
+	h.NotifyPlayers(gameID, committed.Version, events.CardPlayed{
+		PlayerID: userID,
+		CardID:   cardRequest.CardID,
+		TargetID: cardRequest.TargetID,
+	})
+	h.armTimer(gameID, committed)
+	return committed, nil
+}
+
+// RespondHandler lets the target of a pending Bang! answer it
+func (h *Handler) RespondHandler(w http.ResponseWriter, r *http.Request) {
+	cookie, err := r.Cookie("token")
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
 
-	if gameState.CurrentPhase != "play" {
-		http.Error(w, "You cannot play a card outside of the play phase", http.StatusForbidden)
+	claims, err := data.ValidateJWT(cookie.Value)
+	if err != nil {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
 		return
 	}
 
-    // Получаем название карты по ID
-    card, err := db.GetCardByID(cardRequest.CardID)
-    if err != nil {
-        http.Error(w, "Could not retrieve card", http.StatusInternalServerError)
-        return
-    }
-
-    // Проверяем, есть ли у игрока эта карта на руке
-    hasCard, err := db.CheckPlayerHasCard(claims.UserID, gameID, card.Name)
-    if err != nil {
-        http.Error(w, "Could not check player hand", http.StatusInternalServerError)
-        return
-    }
-    
-	if !hasCard {
-		http.Error(w, "You don't have this card", http.StatusForbidden)
+	gameID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid game ID", http.StatusBadRequest)
 		return
 	}
 
-	// Удаляем карту из руки игрока
-	err = db.RemoveCardFromPlayerHand(claims.UserID, gameID, cardRequest.CardID)
+	var respondRequest respondMove
+	if err := decodeOptionalBody(r, &respondRequest); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	expected, err := expectedVersion(r, respondRequest.ExpectedVersion)
 	if err != nil {
-		http.Error(w, "Could not remove card from hand", http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// Добавляем карту в сброс
-	err = db.DiscardCard(gameID, cardRequest.CardID)
+	committed, err := h.respond(gameID, claims.UserID, respondRequest, expected, false)
 	if err != nil {
-		http.Error(w, "Could not discard card", http.StatusInternalServerError)
+		writeGameError(w, err)
 		return
 	}
+	writeMoveResult(w, committed, "Response accepted")
+}
+
+// respond resolves the pending Bang! aimed at userID, with a Missed! from
+// their hand or by taking the hit. byTimer is set when the turn timer answers
+// for them.
+func (h *Handler) respond(gameID int, userID int, respondRequest respondMove, expected *int64, byTimer bool) (*data.GameState, error) {
+	pending := &events.Batch{}
+	effects := &utils.EffectContext{GameID: gameID, Events: pending}
+	var committed *data.GameState
+	err := h.Process.InGameTx(gameID, func(tx db.GameProcessStore, gameState *data.GameState) error {
+		committed = gameState
+		if err := checkVersion(gameState, expected); err != nil {
+			return err
+		}
+		if err := recordActivity(tx, gameID, byTimer); err != nil {
+			return err
+		}
+
+		if gameState.CurrentPhase != "respond" || gameState.PendingTarget != userID {
+			return &gameError{status: http.StatusConflict, message: "There is nothing for you to respond to"}
+		}
 
-	// Применяем эффект карты
-	err = ApplyCardEffect(gameID, claims.UserID, cardRequest.CardID, cardRequest.TargetID)
+		missed := respondRequest.CardID != 0
+		if missed {
+			card, err := tx.GetCardByID(respondRequest.CardID)
+			if err != nil {
+				return internalError("Could not retrieve card", err)
+			}
+			if card == nil || card.Name != "Missed!" {
+				return &gameError{status: http.StatusBadRequest, message: "Only a Missed! can answer a Bang!"}
+			}
+
+			hasCard, err := tx.CheckPlayerHasCard(userID, gameID, card.Name)
+			if err != nil {
+				return internalError("Could not check player hand", err)
+			}
+			if !hasCard {
+				return &gameError{status: http.StatusForbidden, message: "You don't have this card"}
+			}
+
+			err = tx.RemoveCardFromPlayerHand(userID, gameID, card.ID)
+			if err != nil {
+				return internalError("Could not remove card from hand", err)
+			}
+			err = tx.DiscardCard(gameID, card.ID)
+			if err != nil {
+				return internalError("Could not discard card", err)
+			}
+		}
+
+		effects.Store = tx
+		err := utils.HandleBangResponse(effects, gameState.PendingFrom, userID, missed)
+		if err != nil {
+			return internalError(fmt.Sprintf("Could not resolve Bang!: %v", err), err)
+		}
+		return nil
+	})
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Could not apply card effect: %v", err), http.StatusInternalServerError)
+		return nil, err
+	}
+
+	pending.Flush(h.Events, committed.Version)
+	h.armTimer(gameID, committed)
+	return committed, nil
+}
+
+// DiscardHandler discards a card from the hand of the player whose turn it is
+func (h *Handler) DiscardHandler(w http.ResponseWriter, r *http.Request) {
+	cookie, err := r.Cookie("token")
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
 
-	// Отправляем уведомление игрокам через WebSocket
-	NotifyPlayers(gameID, "card_played", map[string]any{
-		"player_id": claims.UserID,
-		"card_id":   cardRequest.CardID,
-		"target_id": cardRequest.TargetID,
+	claims, err := data.ValidateJWT(cookie.Value)
+	if err != nil {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	gameID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid game ID", http.StatusBadRequest)
+		return
+	}
+
+	var discardRequest discardMove
+	if err := json.NewDecoder(r.Body).Decode(&discardRequest); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	expected, err := expectedVersion(r, discardRequest.ExpectedVersion)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	committed, err := h.discard(gameID, claims.UserID, discardRequest, expected, false)
+	if err != nil {
+		writeGameError(w, err)
+		return
+	}
+	writeMoveResult(w, committed, "Card discarded")
+}
+
+// discard moves a card from the player's hand to the discard pile without
+// playing it, e.g. to get down to the hand limit before ending the turn.
+// byTimer is set when the turn timer discards for them.
+func (h *Handler) discard(gameID int, userID int, discardRequest discardMove, expected *int64, byTimer bool) (*data.GameState, error) {
+	var committed *data.GameState
+	err := h.Process.InGameTx(gameID, func(tx db.GameProcessStore, gameState *data.GameState) error {
+		committed = gameState
+		if err := checkVersion(gameState, expected); err != nil {
+			return err
+		}
+		if err := recordActivity(tx, gameID, byTimer); err != nil {
+			return err
+		}
+
+		if gameState.CurrentTurn != userID {
+			return &gameError{status: http.StatusForbidden, message: "It's not your turn"}
+		}
+		if gameState.CurrentPhase != "play" {
+			return &gameError{status: http.StatusForbidden, message: "You cannot discard outside of the play phase"}
+		}
+
+		card, err := tx.GetCardByID(discardRequest.CardID)
+		if err != nil {
+			return internalError("Could not retrieve card", err)
+		}
+		if card == nil {
+			return &gameError{status: http.StatusNotFound, message: "Card not found"}
+		}
+
+		hasCard, err := tx.CheckPlayerHasCard(userID, gameID, card.Name)
+		if err != nil {
+			return internalError("Could not check player hand", err)
+		}
+		if !hasCard {
+			return &gameError{status: http.StatusForbidden, message: "You don't have this card"}
+		}
+
+		err = tx.RemoveCardFromPlayerHand(userID, gameID, card.ID)
+		if err != nil {
+			return internalError("Could not remove card from hand", err)
+		}
+		err = tx.DiscardCard(gameID, card.ID)
+		if err != nil {
+			return internalError("Could not discard card", err)
+		}
+		return nil
 	})
+	if err != nil {
+		return nil, err
+	}
 
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"message": "Card played successfully"})
+	h.NotifyPlayers(gameID, committed.Version, events.CardDiscarded{PlayerID: userID, CardID: discardRequest.CardID})
+	h.armTimer(gameID, committed)
+	return committed, nil
 }
 
 // ApplyCardEffect applies the effect of a played card
-func ApplyCardEffect(gameID int, userID int, cardID int, targetID int) error {
-	card, err := db.GetCardByID(cardID)
+func (h *Handler) ApplyCardEffect(ctx *utils.EffectContext, userID int, cardID int, targetID int) error {
+	card, err := ctx.Store.GetCardByID(cardID)
 	if err != nil {
 		return fmt.Errorf("could not retrieve card: %v", err)
 	}
 
 	switch card.Name {
 	case "Bang!":
-		return utils.HandleBangEffect(gameID, userID, targetID)
+		return utils.HandleBangEffect(ctx, userID, targetID)
 	case "Missed!":
-		return utils.HandleMissedEffect(gameID, userID)
+		return utils.HandleMissedEffect(ctx, userID)
 	case "Beer":
-		return utils.HandleBeerEffect(gameID, userID)
+		return utils.HandleBeerEffect(ctx, userID)
 	case "Jail":
-		return utils.HandleJailEffect(gameID, targetID)
+		return utils.HandleJailEffect(ctx, userID, targetID)
 	case "Dynamite":
-		return utils.HandleDynamiteEffect(gameID, userID)
+		return utils.HandleDynamiteEffect(ctx, userID)
 	case "Barrel":
-		return utils.HandleBarrelEffect(gameID, userID)
+		return utils.HandleBarrelEffect(ctx, userID)
 	default:
 		return fmt.Errorf("unknown card effect")
 	}
 }
 
 // EndTurnHandler ends the player's turn
-func EndTurnHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) EndTurnHandler(w http.ResponseWriter, r *http.Request) {
 	cookie, err := r.Cookie("token")
 	if err != nil {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
@@ -222,84 +546,93 @@ func EndTurnHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	gameState, err := db.GetGameState(gameID)
-	if err != nil {
-		http.Error(w, "Could not retrieve game state", http.StatusInternalServerError)
+	var turnRequest turnMove
+	if err := decodeOptionalBody(r, &turnRequest); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
-
-	if gameState.CurrentTurn != claims.UserID {
-		http.Error(w, "It's not your turn", http.StatusForbidden)
+	expected, err := expectedVersion(r, turnRequest.ExpectedVersion)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	nextPlayerID, err := db.GetNextPlayerID(gameID, gameState.CurrentTurn)
+	committed, err := h.endTurn(gameID, claims.UserID, expected, false)
 	if err != nil {
-		http.Error(w, "Could not get next player", http.StatusInternalServerError)
+		writeGameError(w, err)
 		return
 	}
+	writeMoveResult(w, committed, "Turn ended. Next player's turn.")
+}
 
-	err = db.UpdateGameStateTurn(gameID, nextPlayerID)
+// endTurn passes the turn to the next player. byTimer is set when the turn
+// timer ends it for them.
+func (h *Handler) endTurn(gameID int, userID int, expected *int64, byTimer bool) (*data.GameState, error) {
+	rules, err := h.gameRules(gameID)
 	if err != nil {
-		http.Error(w, "Could not update game state", http.StatusInternalServerError)
-		return
+		return nil, err
 	}
 
-	NotifyPlayers(gameID, "turn_ended", map[string]interface{}{
-		"previous_player_id": gameState.CurrentTurn,
-		"next_player_id":     nextPlayerID,
-	})
+	var previousPlayerID, nextPlayerID int
+	var committed *data.GameState
+	err = h.Process.InGameTx(gameID, func(tx db.GameProcessStore, gameState *data.GameState) error {
+		committed = gameState
+		if err := checkVersion(gameState, expected); err != nil {
+			return err
+		}
+		if err := recordActivity(tx, gameID, byTimer); err != nil {
+			return err
+		}
 
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"message": "Turn ended. Next player's turn."})
-}
+		if gameState.CurrentTurn != userID {
+			return &gameError{status: http.StatusForbidden, message: "It's not your turn"}
+		}
 
+		// Нельзя уйти, пока цель Bang! не ответила
+		if gameState.CurrentPhase == "respond" {
+			return &gameError{status: http.StatusConflict, message: "Your Bang! is still waiting for a response"}
+		}
 
+		var err error
+		previousPlayerID = gameState.CurrentTurn
+		nextPlayerID, err = tx.GetNextPlayerID(gameID, gameState.CurrentTurn)
+		if err != nil {
+			return internalError("Could not get next player", err)
+		}
 
-var upgrader = websocket.Upgrader{
-    CheckOrigin: func(r *http.Request) bool {
-        return true
-    },
-}
-var clients = make(map[*websocket.Conn]bool) // Connected clients
-var broadcast = make(chan Message)           // Channel for sending messages
+		err = tx.UpdateGameStateTurn(gameID, nextPlayerID)
+		if err != nil {
+			return internalError("Could not update game state", err)
+		}
 
-type Message struct {
-	GameID int         `json:"game_id"`
-	Event  string      `json:"event"`
-	Data   interface{} `json:"data"`
-}
+		// Следующий игрок начинает ход с добора карт
+		err = tx.UpdateGameStatePhase(gameID, "draw")
+		if err != nil {
+			return internalError("Could not update game phase", err)
+		}
 
-// WebSocketHandler handles WebSocket connections
-func WebSocketHandler(w http.ResponseWriter, r *http.Request) {
-	conn, err := upgrader.Upgrade(w, r, nil)
+		// и со своим таймером
+		err = tx.UpdateGameStateTurnDeadline(gameID, turnDeadline(rules))
+		if err != nil {
+			return internalError("Could not set turn deadline", err)
+		}
+		return nil
+	})
 	if err != nil {
-		log.Printf("WebSocket upgrade error: %v", err)
-		return
+		return nil, err
 	}
-	defer conn.Close()
-
-	clients[conn] = true
 
-	for {
-		msg := <-broadcast
-		for client := range clients {
-			err := client.WriteJSON(msg)
-			if err != nil {
-				log.Printf("WebSocket write error: %v", err)
-				client.Close()
-				delete(clients, client)
-			}
-		}
-	}
+	h.NotifyPlayers(gameID, committed.Version, events.TurnEnded{PlayerID: previousPlayerID, NextPlayerID: nextPlayerID})
+	h.armTimer(gameID, committed)
+	return committed, nil
 }
 
-// NotifyPlayers sends a notification to all connected players
-func NotifyPlayers(gameID int, event string, data interface{}) {
-	msg := Message{
-		GameID: gameID,
-		Event:  event,
-		Data:   data,
-	}
-	broadcast <- msg
+// writeMoveResult answers a committed move with its message and new version
+func writeMoveResult(w http.ResponseWriter, committed *data.GameState, message string) {
+	setVersionHeader(w, committed.Version)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": message,
+		"version": committed.Version,
+	})
 }
@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"backend/data"
+	"backend/events"
+	"backend/hub"
+	"net/http"
+	"time"
+)
+
+// gameStreamAccess decides whether userID may follow the events of gameID,
+// over the WebSocket or the SSE stream. Players always may; anyone else only
+// when asking to spectate with ?spectate=true, and never in a private game.
+// Spectators of a game with a spectator delay get it as delay. On refusal the
+// error response is already written and ok is false.
+func (h *Handler) gameStreamAccess(w http.ResponseWriter, r *http.Request, gameID int, userID int) (isPlayer bool, delay time.Duration, ok bool) {
+	game, err := h.Games.GetGameByID(gameID)
+	if err != nil {
+		http.Error(w, "Could not retrieve game", http.StatusInternalServerError)
+		return false, 0, false
+	}
+	if game == nil {
+		http.Error(w, "Game not found", http.StatusNotFound)
+		return false, 0, false
+	}
+
+	isPlayer, err = h.Games.CheckPlayerExists(gameID, userID)
+	if err != nil {
+		http.Error(w, "Could not check player existence", http.StatusInternalServerError)
+		return false, 0, false
+	}
+	if !isPlayer && r.URL.Query().Get("spectate") != "true" {
+		http.Error(w, "You are not a player in this game", http.StatusForbidden)
+		return false, 0, false
+	}
+	if !isPlayer && game.Visibility == data.VisibilityPrivate {
+		http.Error(w, "This game is private", http.StatusForbidden)
+		return false, 0, false
+	}
+	if !isPlayer {
+		delay = time.Duration(game.Rules.SpectatorDelaySeconds) * time.Second
+	}
+	return isPlayer, delay, true
+}
+
+// subscribeGame joins the room of gameID. A client resuming after seq
+// resumeFrom (-1 for a fresh subscription) also gets the backlog to send
+// before anything from the room: the events it missed, or a single snapshot
+// when they are no longer buffered. The room's events are then read from feed.
+//
+// A spectator with a delay watches the game that far behind the table: the
+// backlog goes through feed with everything else, and a fresh subscription
+// starts with a snapshot so the spectator never needs the live state.
+func (h *Handler) subscribeGame(gameID int, userID int, isPlayer bool, delay time.Duration, resumeFrom int64) (client *hub.Client, backlog []events.Event, feed <-chan events.Event, err error) {
+	switch {
+	case delay > 0 && resumeFrom < 0:
+		client = h.Hub.Subscribe(gameID, userID, true)
+		// Событие между подпиской и снимком придёт ещё раз с seq не новее снимка
+		var snapshot events.Event
+		if snapshot, err = h.snapshotEvent(gameID, userID, false, h.Hub.LatestSeq(gameID)); err != nil {
+			h.Hub.Unsubscribe(client)
+			return nil, nil, nil, err
+		}
+		backlog = []events.Event{snapshot}
+	case resumeFrom < 0:
+		client = h.Hub.Subscribe(gameID, userID, !isPlayer)
+	default:
+		var latest int64
+		var ok bool
+		client, backlog, latest, ok = h.Hub.Resume(gameID, userID, !isPlayer, resumeFrom)
+		if !ok {
+			var snapshot events.Event
+			if snapshot, err = h.snapshotEvent(gameID, userID, isPlayer, latest); err != nil {
+				h.Hub.Unsubscribe(client)
+				return nil, nil, nil, err
+			}
+			backlog = []events.Event{snapshot}
+		}
+	}
+
+	if delay > 0 {
+		return client, nil, hub.Delay(backlog, client.Events(), delay), nil
+	}
+	return client, backlog, client.Events(), nil
+}
+
+// snapshotEvent builds the full state sent to a client whose missed events are
+// gone. Its seq is the latest seq at subscription time: every later event
+// reaches the client through the room as usual.
+func (h *Handler) snapshotEvent(gameID int, userID int, isPlayer bool, seq int64) (events.Event, error) {
+	game, err := h.Games.GetGameByID(gameID)
+	if err != nil {
+		return events.Event{}, err
+	}
+	players, err := h.Games.GetPlayersInGame(gameID)
+	if err != nil {
+		return events.Event{}, err
+	}
+	state, err := h.Process.GetGameState(gameID)
+	if err != nil {
+		return events.Event{}, err
+	}
+
+	h.withPresence(gameID, players)
+
+	snapshot := events.Snapshot{Game: game, Players: publicPlayers(game, players, userID), State: state}
+	if isPlayer {
+		snapshot.Hand, err = h.Process.GetPlayerHand(userID, gameID)
+		if err != nil {
+			return events.Event{}, err
+		}
+	}
+
+	event := events.New(gameID, snapshot)
+	event.Seq = seq
+	event.Recipient = userID
+	if state != nil {
+		event.Version = state.Version
+	}
+	return event, nil
+}
+
+// hiddenRole stands for a role the viewer may not see
+const hiddenRole = "Hidden"
+
+// publicPlayers masks the roles viewerID may not see, in place: the table
+// knows the Sheriff and the role of every eliminated player, and sees all of
+// them once the game is over. A player also knows their own role.
+func publicPlayers(game *data.Game, players []map[string]interface{}, viewerID int) []map[string]interface{} {
+	if game.Status != data.StatusInProgress {
+		// В лобби ролей ещё нет, после игры их видят все
+		return players
+	}
+	for _, player := range players {
+		role, _ := player["role"].(string)
+		health, _ := player["health"].(int)
+		userID, _ := player["user_id"].(int)
+		if role == data.RoleSheriff || health <= 0 || userID == viewerID {
+			continue
+		}
+		player["role"] = hiddenRole
+	}
+	return players
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"backend/chat"
+	"backend/db"
+	"backend/events"
+	"backend/hub"
+	"backend/matchmaking"
+	"backend/presence"
+	"backend/timers"
+	"time"
+)
+
+// DefaultIdempotencyRetention is how long responses to keyed requests are kept
+const DefaultIdempotencyRetention = 24 * time.Hour
+
+// DefaultAllowedOrigins are the browser origins allowed by CORS and the WebSocket handshake
+var DefaultAllowedOrigins = []string{"http://localhost:5173"}
+
+// Handler holds the stores every HTTP handler works against. main.go builds
+// it with PostgresStore; tests can build it with db.NewMemoryStore().
+type Handler struct {
+	Users       db.UserStore
+	Games       db.GameStore
+	Process     db.GameProcessStore
+	Chat        db.ChatStore
+	Friends     db.FriendStore
+	Idempotency db.IdempotencyStore
+
+	// Hub holds the WebSocket rooms; Events is where handlers publish.
+	// NewHandler points Events at Hub, tests may swap in an events.Recorder.
+	Hub    *hub.Hub
+	Events events.Publisher
+	// Presence tracks which players are connected to their game; Online
+	// tracks who has any stream open, WebSocket or SSE, under hub.UserRoom,
+	// for their friends
+	Presence *presence.Tracker
+	Online   *presence.Tracker
+	// Timers runs out the turn and response deadlines of running games
+	Timers *timers.Scheduler
+	// Matchmaking holds the players waiting to be seated; RunMatchmaking seats them
+	Matchmaking *matchmaking.Queue
+	// ChatFilter masks profanity in chat messages; ChatLimiter limits how
+	// often a user may post
+	ChatFilter  *chat.Filter
+	ChatLimiter *chat.Limiter
+
+	// IdempotencyRetention is how long a replayable response is kept
+	IdempotencyRetention time.Duration
+	// AllowedOrigins is shared by the CORS config and the WebSocket origin check
+	AllowedOrigins []string
+}
+
+// NewHandler builds a Handler whose stores are all backed by store
+func NewHandler(store db.Store) *Handler {
+	rooms := hub.New(hub.DefaultOptions)
+	h := &Handler{
+		Users:       store,
+		Games:       store,
+		Process:     store,
+		Chat:        store,
+		Friends:     store,
+		Idempotency: store,
+
+		Hub:      rooms,
+		Events:   rooms,
+		Presence: presence.New(rooms, presence.DefaultGrace),
+
+		Matchmaking: matchmaking.New(matchmaking.DefaultOptions),
+		ChatFilter:  chat.NewFilter(chat.DefaultStems, chat.DefaultRoots, chat.DefaultWords),
+		ChatLimiter: chat.NewLimiter(chat.DefaultLimit),
+
+		IdempotencyRetention: DefaultIdempotencyRetention,
+		AllowedOrigins:       DefaultAllowedOrigins,
+	}
+	h.Timers = timers.New(h.expireDeadline)
+	h.Online = presence.New(newFriendPresence(h), presence.DefaultGrace)
+	return h
+}
@@ -0,0 +1,501 @@
+package handlers
+
+import (
+	"backend/data"
+	"backend/db"
+	"backend/events"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// testTable is a Handler over a MemoryStore whose events go to a Recorder
+type testTable struct {
+	t      *testing.T
+	h      *Handler
+	store  *db.MemoryStore
+	events *events.Recorder
+	router http.Handler
+	tokens map[int]string
+}
+
+func newTestTable(t *testing.T) *testTable {
+	t.Helper()
+	store := db.NewMemoryStore()
+	recorder := &events.Recorder{}
+	h := NewHandler(store)
+	h.Events = recorder
+	return &testTable{
+		t:      t,
+		h:      h,
+		store:  store,
+		events: recorder,
+		router: NewRouter(h),
+		tokens: make(map[int]string),
+	}
+}
+
+// user registers a user and returns their ID
+func (tt *testTable) user(username string) int {
+	tt.t.Helper()
+	user := &data.User{Username: username, Password: "secret"}
+	if err := tt.store.CreateUser(user); err != nil {
+		tt.t.Fatalf("create user %s: %v", username, err)
+	}
+	token, err := data.GenerateJWT(user.ID, user.Username)
+	if err != nil {
+		tt.t.Fatalf("token for %s: %v", username, err)
+	}
+	tt.tokens[user.ID] = token
+	return user.ID
+}
+
+// do sends a request as userID and decodes a JSON response into out, if given
+func (tt *testTable) do(userID int, method, path string, body interface{}, header http.Header, out interface{}) *httptest.ResponseRecorder {
+	tt.t.Helper()
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			tt.t.Fatalf("encode body: %v", err)
+		}
+	}
+	r := httptest.NewRequest(method, path, &payload)
+	for key, values := range header {
+		r.Header[key] = values
+	}
+	r.AddCookie(&http.Cookie{Name: "token", Value: tt.tokens[userID]})
+	w := httptest.NewRecorder()
+	tt.router.ServeHTTP(w, r)
+	if out != nil && w.Code < 300 {
+		if err := json.NewDecoder(w.Body).Decode(out); err != nil {
+			tt.t.Fatalf("%s %s: decode response: %v", method, path, err)
+		}
+	}
+	return w
+}
+
+// expect fails the test unless w has status code
+func (tt *testTable) expect(w *httptest.ResponseRecorder, code int, what string) {
+	tt.t.Helper()
+	if w.Code != code {
+		tt.t.Fatalf("%s: got %d %q, want %d", what, w.Code, w.Body.String(), code)
+	}
+}
+
+// lobby creates a game hosted by the first of players and seats the others
+func (tt *testTable) lobby(players ...int) int {
+	tt.t.Helper()
+	var game data.Game
+	w := tt.do(players[0], "POST", "/api/games/new", map[string]string{"game_name": "test"}, nil, &game)
+	tt.expect(w, http.StatusCreated, "create game")
+	for _, userID := range players[1:] {
+		w := tt.do(userID, "POST", "/api/games/join", map[string]int{"game_id": game.ID}, nil, nil)
+		tt.expect(w, http.StatusOK, "join game")
+	}
+	return game.ID
+}
+
+// users registers n players
+func (tt *testTable) users(n int) []int {
+	tt.t.Helper()
+	var players []int
+	for i := 0; i < n; i++ {
+		players = append(players, tt.user(fmt.Sprintf("player%d", len(tt.tokens)+1)))
+	}
+	return players
+}
+
+// started seats four players, readies them and starts the game
+func (tt *testTable) started() (int, []int) {
+	tt.t.Helper()
+	players := tt.users(4)
+	gameID := tt.lobby(players...)
+	tt.ready(gameID, players...)
+	w := tt.do(players[0], "POST", fmt.Sprintf("/api/games/%d/start", gameID), nil, nil, nil)
+	tt.expect(w, http.StatusOK, "start game")
+	return gameID, players
+}
+
+// ready marks players ready in the lobby
+func (tt *testTable) ready(gameID int, players ...int) {
+	tt.t.Helper()
+	for _, userID := range players {
+		w := tt.do(userID, "POST", fmt.Sprintf("/api/games/%d/ready", gameID), map[string]bool{"ready": true}, nil, nil)
+		tt.expect(w, http.StatusOK, "ready")
+	}
+}
+
+// state returns the committed game state
+func (tt *testTable) state(gameID int) *data.GameState {
+	tt.t.Helper()
+	state, err := tt.store.GetGameState(gameID)
+	if err != nil || state == nil {
+		tt.t.Fatalf("game state of %d: %v, %v", gameID, state, err)
+	}
+	return state
+}
+
+// recorded returns the payloads of the recorded events of type T
+func recorded[T events.Payload](tt *testTable) []T {
+	var payloads []T
+	for _, event := range tt.events.Events() {
+		if payload, ok := event.Data.(T); ok {
+			payloads = append(payloads, payload)
+		}
+	}
+	return payloads
+}
+
+// recordedTypes returns the types of the recorded events, in publish order
+func (tt *testTable) recordedTypes() []string {
+	var types []string
+	for _, event := range tt.events.Events() {
+		types = append(types, event.Type)
+	}
+	return types
+}
+
+// health returns the life points of userID in the game
+func (tt *testTable) health(gameID int, userID int) int {
+	tt.t.Helper()
+	players, err := tt.store.GetPlayersInGame(gameID)
+	if err != nil {
+		tt.t.Fatalf("players: %v", err)
+	}
+	for _, player := range players {
+		if player["user_id"] == userID {
+			return player["health"].(int)
+		}
+	}
+	tt.t.Fatalf("user %d is not in game %d", userID, gameID)
+	return 0
+}
+
+func TestJoinGame(t *testing.T) {
+	tt := newTestTable(t)
+	host, guest := tt.user("host"), tt.user("guest")
+	gameID := tt.lobby(host, guest)
+
+	players, err := tt.store.GetPlayersInGame(gameID)
+	if err != nil || len(players) != 2 {
+		t.Fatalf("players after join: %v, %v", players, err)
+	}
+
+	w := tt.do(guest, "POST", "/api/games/join", map[string]int{"game_id": gameID}, nil, nil)
+	tt.expect(w, http.StatusConflict, "join twice")
+	w = tt.do(guest, "POST", "/api/games/join", map[string]int{"game_id": gameID + 1}, nil, nil)
+	tt.expect(w, http.StatusNotFound, "join a missing game")
+}
+
+func TestStartGame(t *testing.T) {
+	tt := newTestTable(t)
+	players := tt.users(4)
+	gameID := tt.lobby(players[:3]...)
+	tt.ready(gameID, players[:3]...)
+	path := fmt.Sprintf("/api/games/%d/start", gameID)
+
+	tt.expect(tt.do(players[0], "POST", path, nil, nil, nil), http.StatusBadRequest, "start with three players")
+
+	w := tt.do(players[3], "POST", "/api/games/join", map[string]int{"game_id": gameID}, nil, nil)
+	tt.expect(w, http.StatusOK, "join game")
+	tt.ready(gameID, players[3])
+	tt.expect(tt.do(players[0], "POST", path, nil, nil, nil), http.StatusOK, "start")
+
+	seated, err := tt.store.GetPlayersInGame(gameID)
+	if err != nil {
+		t.Fatalf("players: %v", err)
+	}
+	var sheriffs int
+	for _, player := range seated {
+		if player["role"] == "No Role" || player["character"] == "No Character" {
+			t.Fatalf("player without a role or character: %v", player)
+		}
+		if player["role"] == "Sheriff" {
+			sheriffs++
+		}
+	}
+	if sheriffs != 1 {
+		t.Fatalf("%d Sheriffs among %v", sheriffs, seated)
+	}
+}
+
+func TestReadyToggles(t *testing.T) {
+	tt := newTestTable(t)
+	host, guest := tt.user("host"), tt.user("guest")
+	gameID := tt.lobby(host, guest)
+	path := fmt.Sprintf("/api/games/%d/ready", gameID)
+
+	var result map[string]bool
+	tt.expect(tt.do(guest, "POST", path, nil, nil, &result), http.StatusOK, "ready")
+	if !result["ready"] {
+		t.Fatalf("first toggle left the player unready")
+	}
+	tt.expect(tt.do(guest, "POST", path, nil, nil, &result), http.StatusOK, "unready")
+	if result["ready"] {
+		t.Fatalf("second toggle left the player ready")
+	}
+
+	changes := recorded[events.ReadyChanged](tt)
+	if len(changes) != 2 || !changes[0].Ready || changes[1].Ready || changes[1].Players != 2 {
+		t.Fatalf("ReadyChanged events: %+v", changes)
+	}
+
+	outsider := tt.user("outsider")
+	tt.expect(tt.do(outsider, "POST", path, nil, nil, nil), http.StatusForbidden, "ready outside the game")
+}
+
+func TestStartRequiresReadyPlayers(t *testing.T) {
+	tt := newTestTable(t)
+	players := tt.users(4)
+	gameID := tt.lobby(players...)
+	tt.ready(gameID, players[:3]...)
+	path := fmt.Sprintf("/api/games/%d/start", gameID)
+
+	tt.expect(tt.do(players[1], "POST", path, nil, nil, nil), http.StatusForbidden, "start by a guest")
+	tt.expect(tt.do(players[0], "POST", path, nil, nil, nil), http.StatusBadRequest, "start with a player unready")
+
+	if state, _ := tt.store.GetGameState(gameID); state != nil {
+		t.Fatalf("a failed start left a game state: %+v", state)
+	}
+}
+
+func TestStartDealsOpeningHands(t *testing.T) {
+	tt := newTestTable(t)
+	gameID, _ := tt.started()
+
+	players, err := tt.store.GetPlayersInGame(gameID)
+	if err != nil {
+		t.Fatalf("players: %v", err)
+	}
+	var sheriff int
+	for _, player := range players {
+		userID, health := player["user_id"].(int), player["health"].(int)
+		if player["role"] == "Sheriff" {
+			sheriff = userID
+		}
+		hand, err := tt.store.GetPlayerHand(userID, gameID)
+		if err != nil {
+			t.Fatalf("hand of %d: %v", userID, err)
+		}
+		if len(hand) != health {
+			t.Fatalf("player %d holds %d cards with %d health", userID, len(hand), health)
+		}
+	}
+
+	state := tt.state(gameID)
+	if state.CurrentTurn != sheriff || state.CurrentPhase != "draw" || state.TurnDeadline == nil {
+		t.Fatalf("first turn: %+v, Sheriff is %d", state, sheriff)
+	}
+
+	started := recorded[events.GameStarted](tt)
+	if len(started) != 1 || started[0].SheriffID != sheriff {
+		t.Fatalf("GameStarted events: %+v", started)
+	}
+}
+
+func TestDrawAndPlay(t *testing.T) {
+	tt := newTestTable(t)
+	gameID, players := tt.started()
+	sheriff := tt.state(gameID).CurrentTurn
+	var other int
+	for _, userID := range players {
+		if userID != sheriff {
+			other = userID
+		}
+	}
+
+	draw := fmt.Sprintf("/api/games/%d/draw", gameID)
+	tt.expect(tt.do(other, "POST", draw, nil, nil, nil), http.StatusForbidden, "draw out of turn")
+
+	var result struct {
+		Version int64 `json:"version"`
+	}
+	tt.expect(tt.do(sheriff, "POST", draw, nil, nil, &result), http.StatusOK, "draw")
+	if state := tt.state(gameID); state.CurrentPhase != "play" || state.Version != result.Version || result.Version != 1 {
+		t.Fatalf("state after draw: %+v, response version %d", state, result.Version)
+	}
+
+	// Бэнг по соседу справа: до него всегда достаёт
+	target, err := tt.store.GetNextPlayerID(gameID, sheriff)
+	if err != nil {
+		t.Fatalf("next player: %v", err)
+	}
+	bang, err := tt.store.GetCardIDByName("Bang!")
+	if err != nil {
+		t.Fatalf("Bang! card: %v", err)
+	}
+	if err := tt.store.AddCardToPlayerHand(sheriff, gameID, bang); err != nil {
+		t.Fatalf("give Bang!: %v", err)
+	}
+	health := tt.health(gameID, target)
+	tt.events.Reset()
+
+	play := fmt.Sprintf("/api/games/%d/play", gameID)
+	move := map[string]int{"card_id": bang, "target_id": target}
+	tt.expect(tt.do(sheriff, "POST", play, move, nil, nil), http.StatusOK, "play Bang!")
+
+	// Бэнг ждёт ответа цели, здоровье пока не тронуто
+	state := tt.state(gameID)
+	if state.CurrentPhase != "respond" || state.PendingFrom != sheriff || state.PendingTarget != target || state.ResponseDeadline == nil {
+		t.Fatalf("state after Bang!: %+v", state)
+	}
+	if types := tt.recordedTypes(); len(types) != 3 || types[0] != "card_effect" || types[1] != "card_played" || types[2] != "timer_started" {
+		t.Fatalf("events of the move: %v", types)
+	}
+	for _, event := range tt.events.Events() {
+		if event.Version != 2 {
+			t.Fatalf("event %s stamped with version %d, want 2", event.Type, event.Version)
+		}
+	}
+
+	respond := fmt.Sprintf("/api/games/%d/respond", gameID)
+	tt.expect(tt.do(sheriff, "POST", respond, map[string]int{}, nil, nil), http.StatusConflict, "respond as the shooter")
+	tt.expect(tt.do(target, "POST", respond, map[string]int{}, nil, nil), http.StatusOK, "take the hit")
+	if got := tt.health(gameID, target); got != health-1 {
+		t.Fatalf("target health %d after the hit, want %d", got, health-1)
+	}
+	if state := tt.state(gameID); state.CurrentPhase != "play" || state.PendingTarget != 0 {
+		t.Fatalf("state after the hit: %+v", state)
+	}
+}
+
+func TestStaleVersionConflicts(t *testing.T) {
+	tt := newTestTable(t)
+	gameID, _ := tt.started()
+	sheriff := tt.state(gameID).CurrentTurn
+	tt.events.Reset()
+	// Подделываем историю ходов: версия 3 без самих ходов
+	tt.store.SetGameState(gameID, data.GameState{CurrentTurn: sheriff, CurrentPhase: "draw", Version: 3})
+	draw := fmt.Sprintf("/api/games/%d/draw", gameID)
+
+	w := tt.do(sheriff, "POST", draw, map[string]int64{"expected_version": 2}, nil, nil)
+	tt.expect(w, http.StatusConflict, "draw with a stale body version")
+	w = tt.do(sheriff, "POST", draw, nil, http.Header{"If-Match": {`"2"`}}, nil)
+	tt.expect(w, http.StatusConflict, "draw with a stale If-Match")
+	if etag := w.Header().Get("ETag"); etag != `"3"` {
+		t.Fatalf("ETag of the conflict: %q", etag)
+	}
+	var conflict struct {
+		State data.GameState `json:"state"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&conflict); err != nil || conflict.State.Version != 3 {
+		t.Fatalf("conflict body: %+v, %v", conflict, err)
+	}
+
+	if state, _ := tt.store.GetGameState(gameID); state.Version != 3 || state.CurrentPhase != "draw" {
+		t.Fatalf("a rejected move changed the state: %+v", state)
+	}
+	if types := tt.recordedTypes(); len(types) != 0 {
+		t.Fatalf("a rejected move published %v", types)
+	}
+	w = tt.do(sheriff, "POST", draw, nil, http.Header{"If-Match": {"three"}}, nil)
+	tt.expect(w, http.StatusBadRequest, "draw with a malformed If-Match")
+}
+
+// expireTurn runs the turn timer of the game as if its deadline had passed
+func (tt *testTable) expireTurn(gameID int) {
+	tt.t.Helper()
+	state := *tt.state(gameID)
+	past := time.Now().Add(-time.Second)
+	state.TurnDeadline = &past
+	tt.store.SetGameState(gameID, state)
+	tt.h.expireDeadline(gameID)
+	if after := tt.state(gameID); after.CurrentTurn == state.CurrentTurn {
+		tt.t.Fatalf("the timer did not end the turn of %d: %+v", state.CurrentTurn, after)
+	}
+}
+
+func TestSweepAbortsGamesOnlyTheTimerPlays(t *testing.T) {
+	tt := newTestTable(t)
+	abandoned, _ := tt.started()
+	played, _ := tt.started()
+	idleSince := time.Now()
+
+	// В брошенной партии ходит только таймер, в другой игрок сам берёт карты
+	tt.expireTurn(abandoned)
+	tt.expireTurn(abandoned)
+	draw := fmt.Sprintf("/api/games/%d/draw", played)
+	tt.expect(tt.do(tt.state(played).CurrentTurn, "POST", draw, nil, nil, nil), http.StatusOK, "draw")
+
+	version := tt.state(played).Version
+	options := JanitorOptions{LobbyTTL: time.Hour, AbandonAfter: time.Minute}
+	tt.h.SweepGames(options, idleSince.Add(options.AbandonAfter))
+
+	for gameID, status := range map[int]string{abandoned: data.StatusAborted, played: data.StatusInProgress} {
+		game, err := tt.store.GetGameByID(gameID)
+		if err != nil || game == nil {
+			t.Fatalf("game %d: %v, %v", gameID, game, err)
+		}
+		if game.Status != status {
+			t.Fatalf("game %d is %s after the sweep, want %s", gameID, game.Status, status)
+		}
+	}
+
+	// Игра, где сходили после выборки janitor'а, остаётся как есть и без новой версии
+	if err := tt.h.abortGame(played, idleSince); err != nil {
+		t.Fatalf("abort a played game: %v", err)
+	}
+	if after := tt.state(played).Version; after != version {
+		t.Fatalf("leaving a played game alone moved its version from %d to %d", version, after)
+	}
+}
+
+func TestRematchStartsWhenEnoughAccept(t *testing.T) {
+	tt := newTestTable(t)
+	players := tt.users(5)
+	gameID := tt.lobby(players...)
+	tt.ready(gameID, players...)
+	tt.expect(tt.do(players[0], "POST", fmt.Sprintf("/api/games/%d/start", gameID), nil, nil, nil), http.StatusOK, "start game")
+	if err := tt.store.UpdateGameStatus(gameID, data.StatusFinished); err != nil {
+		t.Fatalf("finish game: %v", err)
+	}
+
+	var rematch data.Game
+	tt.expect(tt.do(players[0], "POST", fmt.Sprintf("/api/games/%d/rematch", gameID), nil, nil, &rematch), http.StatusCreated, "rematch")
+	accept := fmt.Sprintf("/api/games/%d/invite/accept", rematch.ID)
+
+	// Хозяин и двое принявших — ещё мало, четвёртый запускает игру
+	for _, userID := range players[1:3] {
+		tt.expect(tt.do(userID, "POST", accept, nil, nil, nil), http.StatusOK, "accept")
+	}
+	if state, _ := tt.store.GetGameState(rematch.ID); state != nil {
+		t.Fatalf("rematch started with three players: %+v", state)
+	}
+	tt.expect(tt.do(players[3], "POST", accept, nil, nil, nil), http.StatusOK, "accept")
+
+	game, err := tt.store.GetGameByID(rematch.ID)
+	if err != nil || game.Status != data.StatusInProgress {
+		t.Fatalf("rematch after four accepted: %+v, %v", game, err)
+	}
+	if state := tt.state(rematch.ID); state.CurrentPhase != "draw" || state.TurnDeadline == nil {
+		t.Fatalf("first turn of the rematch: %+v", state)
+	}
+	tt.expect(tt.do(players[4], "POST", accept, nil, nil, nil), http.StatusConflict, "accept a started rematch")
+}
+
+func TestSpectatorChatOfPrivateGames(t *testing.T) {
+	tt := newTestTable(t)
+	host, outsider := tt.user("host"), tt.user("outsider")
+	claims := &data.Claims{UserID: outsider, Username: "outsider"}
+	message := chatMessage{Channel: data.ChatSpectators, Text: "hello"}
+
+	for visibility, status := range map[string]int{data.VisibilityPublic: 0, data.VisibilityPrivate: http.StatusForbidden} {
+		var game data.Game
+		body := map[string]string{"game_name": visibility, "visibility": visibility}
+		tt.expect(tt.do(host, "POST", "/api/games/new", body, nil, &game), http.StatusCreated, "create game")
+
+		err := tt.h.chat(game.ID, claims, message)
+		var ge *gameError
+		switch {
+		case status == 0 && err != nil:
+			t.Fatalf("spectator chat of a %s game: %v", visibility, err)
+		case status != 0 && (!errors.As(err, &ge) || ge.status != status):
+			t.Fatalf("spectator chat of a %s game: %v, want status %d", visibility, err, status)
+		}
+	}
+}
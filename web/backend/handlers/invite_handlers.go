@@ -0,0 +1,240 @@
+package handlers
+
+import (
+	"backend/data"
+	"backend/db"
+	"backend/events"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// InviteFriendHandler invites a friend to the lobby the user sits in. The
+// body names them: {"user_id": 7}. The invite reaches every open user stream
+// of the friend, who answers like any invite; it may be renewed after a
+// decline.
+func (h *Handler) InviteFriendHandler(w http.ResponseWriter, r *http.Request) {
+	cookie, err := r.Cookie("token")
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	claims, err := data.ValidateJWT(cookie.Value)
+	if err != nil {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	gameID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid game ID", http.StatusBadRequest)
+		return
+	}
+
+	var request friendRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	relation, err := h.Friends.GetRelation(claims.UserID, request.UserID)
+	if err != nil {
+		http.Error(w, "Could not retrieve relation", http.StatusInternalServerError)
+		return
+	}
+	if relation != data.RelationFriend {
+		http.Error(w, "You can only invite your friends", http.StatusForbidden)
+		return
+	}
+
+	invite := &data.GameInvite{GameID: gameID, UserID: request.UserID, InviterID: claims.UserID, InviterName: claims.Username}
+	err = h.Games.InLobbyTx(gameID, func(tx db.GameStore, game *data.Game) error {
+		if game.Status != data.StatusWaiting {
+			return &gameError{status: http.StatusConflict, message: "Game has already started"}
+		}
+		players, err := tx.GetPlayersInGame(gameID)
+		if err != nil {
+			return internalError("Could not retrieve players", err)
+		}
+		if !hasPlayer(players, claims.UserID) {
+			return &gameError{status: http.StatusForbidden, message: "You are not a player in this game"}
+		}
+		if hasPlayer(players, request.UserID) {
+			return &gameError{status: http.StatusConflict, message: "User is already in this game"}
+		}
+		if len(players) >= game.MaxSeats {
+			return &gameError{status: http.StatusConflict, message: "Game is full"}
+		}
+		invite.GameName = game.GameName
+		if err := tx.CreateInvite(invite); err != nil {
+			return internalError("Could not invite user", err)
+		}
+		return nil
+	})
+	if err != nil {
+		writeLobbyError(w, err)
+		return
+	}
+	log.Printf("User %s invited user %d to game %d", claims.Username, request.UserID, gameID)
+
+	h.NotifyUser(request.UserID, events.InviteReceived{
+		GameID:      gameID,
+		GameName:    invite.GameName,
+		InviterID:   claims.UserID,
+		InviterName: claims.Username,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(invite)
+}
+
+// InvitesHandler lists the user's pending invites
+func (h *Handler) InvitesHandler(w http.ResponseWriter, r *http.Request) {
+	cookie, err := r.Cookie("token")
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	claims, err := data.ValidateJWT(cookie.Value)
+	if err != nil {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	invites, err := h.Games.GetUserInvites(claims.UserID, data.InvitePending)
+	if err != nil {
+		http.Error(w, "Could not retrieve invites", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(invites)
+}
+
+// AcceptInviteHandler seats the user in the game they were invited to
+func (h *Handler) AcceptInviteHandler(w http.ResponseWriter, r *http.Request) {
+	h.inviteAnswerHandler(w, r, true)
+}
+
+// DeclineInviteHandler turns an invite down
+func (h *Handler) DeclineInviteHandler(w http.ResponseWriter, r *http.Request) {
+	h.inviteAnswerHandler(w, r, false)
+}
+
+func (h *Handler) inviteAnswerHandler(w http.ResponseWriter, r *http.Request, accept bool) {
+	cookie, err := r.Cookie("token")
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	claims, err := data.ValidateJWT(cookie.Value)
+	if err != nil {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	gameID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid game ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.answerInvite(gameID, claims, accept); err != nil {
+		writeLobbyError(w, err)
+		return
+	}
+
+	message := "Invite declined"
+	if accept {
+		message = "Invite accepted"
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": message})
+}
+
+// answerInvite records the user's answer to their pending invite to gameID.
+// Accepting takes a seat like joining does; in a rematch the seat is taken
+// ready, and the game starts as soon as enough players are seated.
+func (h *Handler) answerInvite(gameID int, claims *data.Claims, accept bool) error {
+	var seats, maxSeats, pending int
+	var started *data.GameState
+	err := h.Games.InLobbyTx(gameID, func(tx db.GameStore, game *data.Game) error {
+		invite, err := tx.GetInvite(gameID, claims.UserID)
+		if err != nil {
+			return internalError("Could not retrieve invite", err)
+		}
+		if invite == nil || invite.Status != data.InvitePending {
+			return &gameError{status: http.StatusNotFound, message: "You have no pending invite to this game"}
+		}
+
+		status := data.InviteDeclined
+		if accept {
+			status = data.InviteAccepted
+			if game.Status != data.StatusWaiting {
+				return &gameError{status: http.StatusConflict, message: "Game has already started"}
+			}
+			players, err := tx.GetPlayersInGame(gameID)
+			if err != nil {
+				return internalError("Could not retrieve players", err)
+			}
+			if len(players) >= game.MaxSeats {
+				return &gameError{status: http.StatusConflict, message: "Game is full"}
+			}
+			if err := tx.AddPlayerToGame(gameID, claims.UserID); err != nil {
+				return internalError("Could not join game", err)
+			}
+			if game.RematchOf != 0 {
+				if err := tx.SetPlayerReady(gameID, claims.UserID, true); err != nil {
+					return internalError("Could not update ready", err)
+				}
+			}
+			seats, maxSeats = len(players)+1, game.MaxSeats
+		}
+		if err := tx.SetInviteStatus(gameID, claims.UserID, status); err != nil {
+			return internalError("Could not answer invite", err)
+		}
+
+		invites, err := tx.GetGameInvites(gameID)
+		if err != nil {
+			return internalError("Could not retrieve invites", err)
+		}
+		for _, invite := range invites {
+			if invite.Status == data.InvitePending {
+				pending++
+			}
+		}
+
+		// Реванш не ждёт остальных приглашённых: хватило принявших — стартуем
+		if !accept || game.RematchOf == 0 {
+			return nil
+		}
+		started, err = autoStart(tx, game)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if accept {
+		h.NotifyPlayers(gameID, 0, events.PlayerJoined{
+			PlayerID: claims.UserID,
+			Username: claims.Username,
+			Seats:    seats,
+			MaxSeats: maxSeats,
+		})
+	} else {
+		h.NotifyPlayers(gameID, 0, events.InviteDeclined{PlayerID: claims.UserID, Pending: pending})
+	}
+	if started != nil {
+		h.notifyRoles(gameID)
+		h.armTimer(gameID, started)
+	}
+	return nil
+}
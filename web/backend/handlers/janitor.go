@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"backend/data"
+	"backend/db"
+	"backend/events"
+	"errors"
+	"log"
+	"time"
+)
+
+// JanitorOptions configure the cleanup of idle games
+type JanitorOptions struct {
+	// Interval is how often the janitor looks for idle games
+	Interval time.Duration
+	// LobbyTTL is how long a lobby may go without activity before it is deleted
+	LobbyTTL time.Duration
+	// AbandonAfter is how long a running game may go without a move by a
+	// player before it is aborted; moves the turn timer makes do not count
+	AbandonAfter time.Duration
+	// DryRun only logs what the janitor would do
+	DryRun bool
+}
+
+// errLeftAlone rolls back the janitor's transaction on a game that turned out
+// not to be idle; InGameTx would otherwise commit a move and bump its version
+var errLeftAlone = errors.New("game is not idle")
+
+// DefaultJanitorOptions sweep every minute, expire lobbies idle for 30
+// minutes and abort games abandoned for 15
+var DefaultJanitorOptions = JanitorOptions{Interval: time.Minute, LobbyTTL: 30 * time.Minute, AbandonAfter: 15 * time.Minute}
+
+// RunJanitor sweeps idle games every options.Interval until the process
+// exits. Idleness is read from games.last_activity_at only, so every instance
+// sharing the database agrees on it whoever the players are connected to.
+func (h *Handler) RunJanitor(options JanitorOptions) {
+	ticker := time.NewTicker(options.Interval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		h.SweepGames(options, now)
+	}
+}
+
+// SweepGames runs one pass of the janitor at now: lobbies idle for longer
+// than LobbyTTL are deleted, running games without a player's move for longer
+// than AbandonAfter are aborted. The cards of both are archived first.
+func (h *Handler) SweepGames(options JanitorOptions, now time.Time) {
+	lobbiesIdleSince := now.Add(-options.LobbyTTL)
+	lobbies, err := h.Games.ListIdleGames(data.StatusWaiting, lobbiesIdleSince)
+	if err != nil {
+		log.Printf("Janitor: %v", err)
+	}
+	for _, game := range lobbies {
+		if options.DryRun {
+			log.Printf("Janitor (dry run): would expire lobby %d %q, idle since %s", game.ID, game.GameName, game.LastActivityAt.Format(time.RFC3339))
+			continue
+		}
+		if err := h.expireLobby(game.ID, lobbiesIdleSince); err != nil {
+			log.Printf("Janitor: could not expire lobby %d: %v", game.ID, err)
+		}
+	}
+
+	gamesIdleSince := now.Add(-options.AbandonAfter)
+	running, err := h.Games.ListIdleGames(data.StatusInProgress, gamesIdleSince)
+	if err != nil {
+		log.Printf("Janitor: %v", err)
+	}
+	for _, game := range running {
+		if options.DryRun {
+			log.Printf("Janitor (dry run): would abort game %d %q, idle since %s", game.ID, game.GameName, game.LastActivityAt.Format(time.RFC3339))
+			continue
+		}
+		if err := h.abortGame(game.ID, gamesIdleSince); err != nil {
+			log.Printf("Janitor: could not abort game %d: %v", game.ID, err)
+		}
+	}
+}
+
+// expireLobby archives and deletes a lobby, unless someone was active in it
+// since it was listed
+func (h *Handler) expireLobby(gameID int, idleSince time.Time) error {
+	var archived int64
+	err := h.Games.InLobbyTx(gameID, func(tx db.GameStore, game *data.Game) error {
+		if game.Status != data.StatusWaiting || !game.LastActivityAt.Before(idleSince) {
+			return errLeftAlone
+		}
+		var err error
+		if archived, err = tx.ArchiveGameCards(gameID); err != nil {
+			return err
+		}
+		return tx.DeleteGame(gameID)
+	})
+	if errors.Is(err, db.ErrNoGame) || errors.Is(err, errLeftAlone) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Janitor: expired lobby %d, archived %d cards", gameID, archived)
+	h.NotifyPlayers(gameID, 0, events.GameAborted{Reason: "lobby_expired"})
+	h.forgetGame(gameID)
+	return nil
+}
+
+// abortGame ends an abandoned running game without a winner and archives its
+// cards. A game that finished or saw a move since it was listed is left alone.
+func (h *Handler) abortGame(gameID int, idleSince time.Time) error {
+	var archived int64
+	var committed *data.GameState
+	err := h.Process.InGameTx(gameID, func(tx db.GameProcessStore, state *data.GameState) error {
+		committed = state
+		if state.CurrentPhase == "finished" {
+			return errLeftAlone
+		}
+		// Ход коммитится вместе с last_activity_at, а его блокировку мы уже держим
+		game, err := h.Games.GetGameByID(gameID)
+		if err != nil {
+			return err
+		}
+		if game == nil || !game.LastActivityAt.Before(idleSince) {
+			return errLeftAlone
+		}
+		if err := tx.UpdateGameStatePending(gameID, 0, 0); err != nil {
+			return err
+		}
+		if err := tx.UpdateGameStateTurnDeadline(gameID, nil); err != nil {
+			return err
+		}
+		if err := tx.UpdateGameStateResponseDeadline(gameID, nil); err != nil {
+			return err
+		}
+		if err := tx.UpdateGameStatePhase(gameID, "finished"); err != nil {
+			return err
+		}
+		if err := tx.UpdateGameStatus(gameID, data.StatusAborted); err != nil {
+			return err
+		}
+		archived, err = tx.ArchiveGameCards(gameID)
+		return err
+	})
+	if errors.Is(err, db.ErrNoGameState) {
+		// Игра без состояния: меняем только статус и убираем карты
+		err = h.Games.InLobbyTx(gameID, func(tx db.GameStore, game *data.Game) error {
+			if game.Status != data.StatusInProgress || !game.LastActivityAt.Before(idleSince) {
+				return errLeftAlone
+			}
+			if err := tx.UpdateGameStatus(gameID, data.StatusAborted); err != nil {
+				return err
+			}
+			var err error
+			archived, err = tx.ArchiveGameCards(gameID)
+			return err
+		})
+	}
+	if errors.Is(err, db.ErrNoGame) || errors.Is(err, errLeftAlone) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Janitor: aborted game %d, archived %d cards", gameID, archived)
+	var version int64
+	if committed != nil {
+		version = committed.Version
+	}
+	h.Timers.Cancel(gameID)
+	h.NotifyPlayers(gameID, version, events.GameAborted{Reason: "abandoned"})
+	return nil
+}
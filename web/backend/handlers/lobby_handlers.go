@@ -0,0 +1,275 @@
+package handlers
+
+import (
+	"backend/data"
+	"backend/db"
+	"backend/events"
+	"backend/utils"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// LeaveGameHandler takes the player out of a game. In the lobby their seat is
+// freed; in a running game leaving is a surrender and they are eliminated
+// like a player who lost their last life point. A host who leaves hands the
+// game over to the player who has been waiting longest.
+func (h *Handler) LeaveGameHandler(w http.ResponseWriter, r *http.Request) {
+	cookie, err := r.Cookie("token")
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	claims, err := data.ValidateJWT(cookie.Value)
+	if err != nil {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	gameID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid game ID", http.StatusBadRequest)
+		return
+	}
+
+	game, err := h.Games.GetGameByID(gameID)
+	if err != nil {
+		http.Error(w, "Could not retrieve game", http.StatusInternalServerError)
+		return
+	}
+	if game == nil {
+		http.Error(w, "Game not found", http.StatusNotFound)
+		return
+	}
+
+	switch game.Status {
+	case data.StatusWaiting:
+		err = h.removeFromLobby(gameID, claims.UserID, "left")
+	case data.StatusInProgress:
+		err = h.surrender(gameID, claims.UserID)
+	default:
+		err = &gameError{status: http.StatusConflict, message: "Game is over"}
+	}
+	if err != nil {
+		writeLobbyError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Left game successfully"})
+}
+
+// KickPlayerHandler lets the host remove a player from the lobby
+func (h *Handler) KickPlayerHandler(w http.ResponseWriter, r *http.Request) {
+	cookie, err := r.Cookie("token")
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	claims, err := data.ValidateJWT(cookie.Value)
+	if err != nil {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	gameID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid game ID", http.StatusBadRequest)
+		return
+	}
+
+	var kickRequest struct {
+		UserID int `json:"user_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&kickRequest); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	game, err := h.Games.GetGameByID(gameID)
+	if err != nil {
+		http.Error(w, "Could not retrieve game", http.StatusInternalServerError)
+		return
+	}
+	if game == nil {
+		http.Error(w, "Game not found", http.StatusNotFound)
+		return
+	}
+	if game.CreatorID != claims.UserID {
+		http.Error(w, "Only the host can kick players", http.StatusForbidden)
+		return
+	}
+	if kickRequest.UserID == claims.UserID {
+		http.Error(w, "You cannot kick yourself, leave the game instead", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.removeFromLobby(gameID, kickRequest.UserID, "kicked"); err != nil {
+		writeLobbyError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Player kicked"})
+}
+
+// removeFromLobby frees the seat of userID in a game that has not started.
+// The host's leaving passes the game to the player who joined first after
+// them; a lobby left empty is deleted.
+func (h *Handler) removeFromLobby(gameID int, userID int, reason string) error {
+	var newHostID int
+	var deleted bool
+	err := h.Games.InLobbyTx(gameID, func(tx db.GameStore, game *data.Game) error {
+		if game.Status != data.StatusWaiting {
+			return &gameError{status: http.StatusConflict, message: "Game has already started"}
+		}
+
+		players, err := tx.GetPlayersInGame(gameID)
+		if err != nil {
+			return internalError("Could not retrieve players", err)
+		}
+		var remaining []int
+		found := false
+		for _, p := range players {
+			if p["user_id"] == userID {
+				found = true
+			} else {
+				remaining = append(remaining, p["user_id"].(int))
+			}
+		}
+		if !found {
+			return &gameError{status: http.StatusNotFound, message: "Player is not in this game"}
+		}
+
+		if len(remaining) == 0 {
+			deleted = true
+			if err := tx.DeleteGame(gameID); err != nil {
+				return internalError("Could not delete game", err)
+			}
+			return nil
+		}
+
+		if err := tx.RemovePlayerFromGame(gameID, userID); err != nil {
+			return internalError("Could not remove player", err)
+		}
+		if game.CreatorID == userID {
+			// Игроки упорядочены по времени входа
+			newHostID = remaining[0]
+			if err := tx.UpdateGameCreator(gameID, newHostID); err != nil {
+				return internalError("Could not transfer host", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if deleted {
+		h.forgetGame(gameID)
+		return nil
+	}
+	h.NotifyPlayers(gameID, 0, events.PlayerLeft{PlayerID: userID, Reason: reason})
+	if newHostID != 0 {
+		h.NotifyPlayers(gameID, 0, events.HostChanged{HostID: newHostID})
+	}
+	return nil
+}
+
+// surrender eliminates userID from a running game under the usual death
+// rules, then hands the game over if they were the host
+func (h *Handler) surrender(gameID int, userID int) error {
+	rules, err := h.gameRules(gameID)
+	if err != nil {
+		return err
+	}
+
+	pending := &events.Batch{}
+	effects := &utils.EffectContext{
+		GameID:      gameID,
+		Events:      pending,
+		TurnTimeout: time.Duration(rules.TurnSeconds) * time.Second,
+	}
+	var committed *data.GameState
+	err = h.Process.InGameTx(gameID, func(tx db.GameProcessStore, gameState *data.GameState) error {
+		committed = gameState
+		if err := recordActivity(tx, gameID, false); err != nil {
+			return err
+		}
+		players, err := tx.GetGamePlayers(gameID)
+		if err != nil {
+			return internalError("Could not retrieve players", err)
+		}
+		alive := false
+		for _, p := range players {
+			if p.UserID == userID {
+				alive = p.Health > 0
+			}
+		}
+		if !alive {
+			return &gameError{status: http.StatusConflict, message: "You have already been eliminated"}
+		}
+
+		effects.Store = tx
+		if err := utils.HandleElimination(effects, userID, 0); err != nil {
+			return internalError("Could not eliminate player", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	h.NotifyPlayers(gameID, committed.Version, events.PlayerLeft{PlayerID: userID, Reason: "surrendered"})
+	pending.Flush(h.Events, committed.Version)
+	h.armTimer(gameID, committed)
+	return h.transferHost(gameID, userID)
+}
+
+// transferHost passes the game from a host who left to the player who has
+// been waiting longest, preferring those still alive
+func (h *Handler) transferHost(gameID int, userID int) error {
+	var newHostID int
+	err := h.Games.InLobbyTx(gameID, func(tx db.GameStore, game *data.Game) error {
+		if game.CreatorID != userID {
+			return nil
+		}
+		players, err := tx.GetPlayersInGame(gameID)
+		if err != nil {
+			return internalError("Could not retrieve players", err)
+		}
+		for _, p := range players {
+			id := p["user_id"].(int)
+			if id == userID {
+				continue
+			}
+			if health, _ := p["health"].(int); health > 0 {
+				newHostID = id
+				break
+			}
+			if newHostID == 0 {
+				newHostID = id
+			}
+		}
+		if newHostID == 0 {
+			return nil
+		}
+		if err := tx.UpdateGameCreator(gameID, newHostID); err != nil {
+			return internalError("Could not transfer host", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if newHostID != 0 {
+		h.NotifyPlayers(gameID, 0, events.HostChanged{HostID: newHostID})
+	}
+	return nil
+}
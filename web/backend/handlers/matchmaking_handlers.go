@@ -0,0 +1,218 @@
+package handlers
+
+import (
+	"backend/data"
+	"backend/events"
+	"backend/hub"
+	"backend/matchmaking"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// DefaultRatingBand is how far from a player's rating the others at their
+// table may be when they do not say
+const DefaultRatingBand = 200
+
+// queueStatus is what the matchmaking endpoints answer for a waiting player
+type queueStatus struct {
+	matchmaking.Ticket
+	CurrentBand int `json:"current_band"` // the rating band after widening
+	Waiting     int `json:"waiting"`      // players in the queue, this one included
+}
+
+// JoinQueueHandler puts the user into the matchmaking queue. The body holds
+// their preferences, every field optional:
+//
+//	{"expansions": ["dodge_city"], "min_players": 4, "max_players": 7, "rating_band": 200}
+//
+// Once seated the player receives a "match_found" event on the user stream
+// (/api/ws/user) naming the new game, where they ready up as in any lobby.
+func (h *Handler) JoinQueueHandler(w http.ResponseWriter, r *http.Request) {
+	cookie, err := r.Cookie("token")
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	claims, err := data.ValidateJWT(cookie.Value)
+	if err != nil {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	var preferences matchmaking.Preferences
+	if err := decodeOptionalBody(r, &preferences); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := normalizePreferences(&preferences); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.Users.GetUserByID(claims.UserID)
+	if err != nil {
+		http.Error(w, "Could not retrieve user", http.StatusInternalServerError)
+		return
+	}
+	if user == nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	ticket, err := h.Matchmaking.Join(matchmaking.Ticket{
+		UserID:      claims.UserID,
+		Rating:      user.Rating,
+		Preferences: preferences,
+	})
+	if err != nil {
+		http.Error(w, "You are already in the matchmaking queue", http.StatusConflict)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(h.queueStatus(ticket))
+}
+
+// QueueStatusHandler returns the user's ticket while they wait
+func (h *Handler) QueueStatusHandler(w http.ResponseWriter, r *http.Request) {
+	cookie, err := r.Cookie("token")
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	claims, err := data.ValidateJWT(cookie.Value)
+	if err != nil {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	ticket, ok := h.Matchmaking.Get(claims.UserID)
+	if !ok {
+		http.Error(w, "You are not in the matchmaking queue", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.queueStatus(ticket))
+}
+
+// LeaveQueueHandler takes the user out of the matchmaking queue
+func (h *Handler) LeaveQueueHandler(w http.ResponseWriter, r *http.Request) {
+	cookie, err := r.Cookie("token")
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	claims, err := data.ValidateJWT(cookie.Value)
+	if err != nil {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	if !h.Matchmaking.Leave(claims.UserID) {
+		http.Error(w, "You are not in the matchmaking queue", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Left the matchmaking queue"})
+}
+
+// RunMatchmaking forms tables out of the queue until the process exits
+func (h *Handler) RunMatchmaking() {
+	h.Matchmaking.Run(h.formTable)
+}
+
+// formTable creates the game of a matched table the way a host would: the
+// player who waited longest creates it and the others join. The game is
+// unlisted and has exactly as many seats as players.
+func (h *Handler) formTable(table []matchmaking.Ticket) error {
+	game := &data.Game{
+		GameName:   "Matchmaking game",
+		CreatorID:  table[0].UserID,
+		Status:     data.StatusWaiting,
+		CreatedAt:  time.Now(),
+		MaxSeats:   len(table),
+		Rules:      data.DefaultGameRules,
+		Visibility: data.VisibilityUnlisted,
+		Expansions: table[0].Expansions,
+	}
+	if err := h.Games.CreateGame(game); err != nil {
+		return err
+	}
+
+	players := make([]int, len(table))
+	for i, ticket := range table {
+		if err := h.Games.AddPlayerToGame(game.ID, ticket.UserID); err != nil {
+			// Недосозданная игра никому не нужна
+			if err := h.Games.DeleteGame(game.ID); err != nil {
+				log.Printf("Matchmaking: could not delete game %d: %v", game.ID, err)
+			}
+			return fmt.Errorf("could not seat user %d: %v", ticket.UserID, err)
+		}
+		players[i] = ticket.UserID
+	}
+	log.Printf("Matchmaking: game %d formed for users %v", game.ID, players)
+
+	for _, userID := range players {
+		h.NotifyUser(userID, events.MatchFound{GameID: game.ID, Players: players, Expansions: game.Expansions})
+	}
+	return nil
+}
+
+// NotifyUser sends a private notification to the user stream of userID
+func (h *Handler) NotifyUser(userID int, payload events.Payload) {
+	event := events.New(hub.UserRoom, payload)
+	event.Recipient = userID
+	h.Events.Publish(event)
+}
+
+func (h *Handler) queueStatus(ticket matchmaking.Ticket) queueStatus {
+	return queueStatus{
+		Ticket:      ticket,
+		CurrentBand: ticket.Band(time.Now(), h.Matchmaking.Options()),
+		Waiting:     h.Matchmaking.Len(),
+	}
+}
+
+// normalizePreferences fills in the defaults and validates the rest. The
+// expansions are sorted and deduplicated so equal sets compare equal.
+func normalizePreferences(p *matchmaking.Preferences) error {
+	if p.MinPlayers == 0 {
+		p.MinPlayers = data.MinPlayers
+	}
+	if p.MaxPlayers == 0 {
+		p.MaxPlayers = data.MaxPlayers
+	}
+	if p.MinPlayers < data.MinPlayers || p.MaxPlayers > data.MaxPlayers || p.MinPlayers > p.MaxPlayers {
+		return fmt.Errorf("min_players and max_players must be between %d and %d", data.MinPlayers, data.MaxPlayers)
+	}
+
+	if p.RatingBand == 0 {
+		p.RatingBand = DefaultRatingBand
+	}
+	if p.RatingBand < 0 {
+		return errors.New("rating_band must be positive")
+	}
+
+	for _, expansion := range p.Expansions {
+		if !data.IsExpansion(expansion) {
+			return errors.New("Unknown expansion: " + expansion)
+		}
+	}
+	slices.Sort(p.Expansions)
+	p.Expansions = slices.Compact(p.Expansions)
+	if p.Expansions == nil {
+		p.Expansions = []string{}
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"backend/data"
+	"backend/db"
+	"backend/events"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// RematchHandler creates a new game with the settings of a finished one. The
+// player asking hosts it and is seated ready; everyone else from the table is
+// invited and answers on the user stream (accept_invite / decline_invite) or
+// through /games/{id}/invite/accept|decline, and takes a seat ready. The
+// rematch starts by itself as soon as enough players accepted; invites still
+// pending then can no longer be accepted.
+func (h *Handler) RematchHandler(w http.ResponseWriter, r *http.Request) {
+	cookie, err := r.Cookie("token")
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	claims, err := data.ValidateJWT(cookie.Value)
+	if err != nil {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	gameID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid game ID", http.StatusBadRequest)
+		return
+	}
+
+	var rematch *data.Game
+	var invited []int
+	// Под блокировкой старой игры: два игрока не создадут два реванша
+	err = h.Games.InLobbyTx(gameID, func(tx db.GameStore, game *data.Game) error {
+		if game.Status != data.StatusFinished {
+			return &gameError{status: http.StatusConflict, message: "Game is not finished"}
+		}
+		players, err := tx.GetPlayersInGame(gameID)
+		if err != nil {
+			return internalError("Could not retrieve players", err)
+		}
+		if !hasPlayer(players, claims.UserID) {
+			return &gameError{status: http.StatusForbidden, message: "You are not a player in this game"}
+		}
+		existing, err := tx.GetRematchOf(gameID)
+		if err != nil {
+			return internalError("Could not check for a rematch", err)
+		}
+		if existing != nil {
+			return &gameError{status: http.StatusConflict, message: "A rematch has already been created"}
+		}
+
+		rematch = &data.Game{
+			GameName:     game.GameName,
+			CreatorID:    claims.UserID,
+			Status:       data.StatusWaiting,
+			CreatedAt:    time.Now(),
+			MaxSeats:     game.MaxSeats,
+			Rules:        game.Rules,
+			Visibility:   game.Visibility,
+			PasswordHash: game.PasswordHash,
+			HasPassword:  game.HasPassword,
+			Expansions:   game.Expansions,
+			RematchOf:    gameID,
+		}
+		if rematch.Visibility == data.VisibilityPrivate {
+			if rematch.InviteCode, err = data.GenerateInviteCode(); err != nil {
+				return internalError("Could not generate invite code", err)
+			}
+		}
+		if err := tx.CreateGame(rematch); err != nil {
+			return internalError("Could not create game", err)
+		}
+		if err := tx.AddPlayerToGame(rematch.ID, claims.UserID); err != nil {
+			return internalError("Could not add creator to game", err)
+		}
+		if err := tx.SetPlayerReady(rematch.ID, claims.UserID, true); err != nil {
+			return internalError("Could not update ready", err)
+		}
+
+		for _, player := range players {
+			userID := player["user_id"].(int)
+			if userID == claims.UserID {
+				continue
+			}
+			invite := &data.GameInvite{GameID: rematch.ID, UserID: userID, InviterID: claims.UserID}
+			if err := tx.CreateInvite(invite); err != nil {
+				return internalError("Could not invite players", err)
+			}
+			invited = append(invited, userID)
+		}
+		return nil
+	})
+	if err != nil {
+		writeLobbyError(w, err)
+		return
+	}
+	log.Printf("Rematch %d of game %d created by %s", rematch.ID, gameID, claims.Username)
+
+	for _, userID := range invited {
+		h.NotifyUser(userID, events.InviteReceived{
+			GameID:      rematch.ID,
+			GameName:    rematch.GameName,
+			InviterID:   claims.UserID,
+			InviterName: claims.Username,
+			RematchOf:   gameID,
+		})
+	}
+	h.NotifyPlayers(gameID, 0, events.RematchCreated{GameID: rematch.ID, HostID: claims.UserID})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(rematch)
+}
+
+// autoStart starts a rematch whose players are enough and all ready, and
+// leaves it waiting otherwise; the state is nil when it waits. Pending
+// invites do not hold it back.
+func autoStart(tx db.GameStore, game *data.Game) (*data.GameState, error) {
+	players, err := tx.GetPlayersInGame(game.ID)
+	if err != nil {
+		return nil, internalError("Could not retrieve players", err)
+	}
+	if len(players) < data.MinPlayers {
+		return nil, nil
+	}
+	for _, player := range players {
+		if ready, _ := player["ready"].(bool); !ready {
+			return nil, nil
+		}
+	}
+	return startGame(tx, game, players)
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"backend/middlewares"
+
+	"github.com/gorilla/mux"
+)
+
+// NewRouter registers every API route on a new router
+func NewRouter(h *Handler) *mux.Router {
+	router := mux.NewRouter()
+
+	// Public routes (доступны без аутентификации)
+	router.HandleFunc("/api/register", h.RegisterUserHandler).Methods("POST")
+	router.HandleFunc("/api/register_users", h.RegisterMultipleUsersHandler).Methods("POST")
+	router.HandleFunc("/api/login", h.LoginHandler).Methods("POST")
+	router.HandleFunc("/api/events/schema", h.EventSchemaHandler).Methods("GET")
+
+	// Protected routes (требуют аутентификации)
+	protected := router.PathPrefix("/api").Subrouter()
+	protected.Use(middlewares.JWTAuthMiddleware)
+	// Повторный запрос с тем же Idempotency-Key получает сохранённый ответ
+	protected.Use(middlewares.Idempotency(h.Idempotency, h.IdempotencyRetention))
+
+	protected.HandleFunc("/user", h.GetCurrentUser).Methods("GET")
+	protected.HandleFunc("/users", h.SearchUsersHandler).Methods("GET") // Поиск пользователей по имени
+
+	// Друзья и блокировки
+	protected.HandleFunc("/friends", h.FriendsHandler).Methods("GET")
+	protected.HandleFunc("/friends/requests", h.SendFriendRequestHandler).Methods("POST")
+	protected.HandleFunc("/friends/requests/{id}", h.CancelFriendRequestHandler).Methods("DELETE")
+	protected.HandleFunc("/friends/requests/{id}/accept", h.AcceptFriendRequestHandler).Methods("POST")
+	protected.HandleFunc("/friends/requests/{id}/decline", h.DeclineFriendRequestHandler).Methods("POST")
+	protected.HandleFunc("/friends/{id}", h.RemoveFriendHandler).Methods("DELETE")
+	protected.HandleFunc("/users/{id}/block", h.BlockUserHandler).Methods("POST")
+	protected.HandleFunc("/users/{id}/block", h.UnblockUserHandler).Methods("DELETE")
+
+	// Обработчики для игр
+	protected.HandleFunc("/games", h.GetAllGamesHandler).Methods("GET")               // Получение списка всех игр
+	protected.HandleFunc("/games/new", h.CreateGameHandler).Methods("POST")           // Создание новой игры
+	protected.HandleFunc("/games/{id}", h.GetGameDetailsHandler).Methods("GET")       // Получение деталей игры
+	protected.HandleFunc("/games/join", h.JoinGameHandler).Methods("POST")            // Присоединение к игре
+	protected.HandleFunc("/games/{id}/ready", h.ReadyHandler).Methods("POST")         // Готовность в лобби
+	protected.HandleFunc("/games/{id}/leave", h.LeaveGameHandler).Methods("POST")     // Выход из игры
+	protected.HandleFunc("/games/{id}/kick", h.KickPlayerHandler).Methods("POST")     // Удаление игрока хостом
+	protected.HandleFunc("/games/{id}/start", h.StartGameHandler).Methods("POST")     // Запуск игры
+	protected.HandleFunc("/games/{id}/delete", h.DeleteGameHandler).Methods("DELETE") // Удаление игры
+	protected.HandleFunc("/games/{id}/rematch", h.RematchHandler).Methods("POST")     // Реванш тем же составом
+	// Приглашения в игру
+	protected.HandleFunc("/invites", h.InvitesHandler).Methods("GET")
+	protected.HandleFunc("/games/{id}/invite", h.InviteFriendHandler).Methods("POST")
+	protected.HandleFunc("/games/{id}/invite/accept", h.AcceptInviteHandler).Methods("POST")
+	protected.HandleFunc("/games/{id}/invite/decline", h.DeclineInviteHandler).Methods("POST")
+	// История чата; сообщения отправляются через WebSocket
+	protected.HandleFunc("/games/{id}/chat", h.ChatHistoryHandler).Methods("GET")
+	// Обработчики игрового процесса
+	protected.HandleFunc("/games/{id}/draw", h.StartTurnHandler).Methods("POST")  // Начало хода и добор карт
+	protected.HandleFunc("/games/{id}/play", h.PlayCardHandler).Methods("POST")   // Разыгрывание карты
+	protected.HandleFunc("/games/{id}/respond", h.RespondHandler).Methods("POST") // Ответ на Bang!
+	protected.HandleFunc("/games/{id}/discard", h.DiscardHandler).Methods("POST") // Сброс карты
+	protected.HandleFunc("/games/{id}/end", h.EndTurnHandler).Methods("POST")     // Завершение хода
+
+	// Подбор игроков
+	protected.HandleFunc("/matchmaking/queue", h.JoinQueueHandler).Methods("POST")
+	protected.HandleFunc("/matchmaking/queue", h.QueueStatusHandler).Methods("GET")
+	protected.HandleFunc("/matchmaking/queue", h.LeaveQueueHandler).Methods("DELETE")
+
+	// WebSocket route
+	protected.HandleFunc("/ws", h.WebSocketHandler).Methods("GET")
+	// Notifications of the user outside any game, such as a found match
+	protected.HandleFunc("/ws/user", h.UserSocketHandler).Methods("GET")
+	// SSE fallback for clients that cannot open a WebSocket
+	protected.HandleFunc("/games/{id}/events", h.GameEventsHandler).Methods("GET")
+
+	return router
+}
@@ -0,0 +1,15 @@
+package handlers
+
+import (
+	"backend/events"
+	"encoding/json"
+	"net/http"
+)
+
+// EventSchemaHandler serves the JSON Schema of every event sent over the
+// WebSocket and SSE streams, for clients to validate and generate types from
+func (h *Handler) EventSchemaHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/schema+json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(events.Schema())
+}
@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"backend/events"
+	"backend/hub"
+	"backend/middlewares"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// sseKeepAlive is how often an idle stream gets a comment line, so proxies
+// do not close it and dead clients are noticed
+const sseKeepAlive = 25 * time.Second
+
+// GameEventsHandler streams the events of a game as text/event-stream for
+// clients whose network blocks WebSockets. It carries exactly what the socket
+// does, filtered the same way: access rules are those of WebSocketHandler.
+//
+// Every message is unnamed, so EventSource.onmessage receives all of them,
+// and its data is the same JSON the socket sends. The SSE id is the event's
+// seq, so the browser's automatic reconnect resumes through Last-Event-ID. A
+// client switching over from the socket passes ?last_event_id= instead.
+func (h *Handler) GameEventsHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := middlewares.ClaimsFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	gameID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid game ID", http.StatusBadRequest)
+		return
+	}
+
+	isPlayer, delay, ok := h.gameStreamAccess(w, r, gameID, claims.UserID)
+	if !ok {
+		return
+	}
+
+	resumeFrom := int64(-1)
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("last_event_id")
+	}
+	if lastEventID != "" {
+		resumeFrom, err = strconv.ParseInt(lastEventID, 10, 64)
+		if err != nil || resumeFrom < 0 {
+			http.Error(w, "Invalid Last-Event-ID", http.StatusBadRequest)
+			return
+		}
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	client, backlog, feed, err := h.subscribeGame(gameID, claims.UserID, isPlayer, delay, resumeFrom)
+	if err != nil {
+		log.Printf("SSE snapshot error: %v", err)
+		http.Error(w, "Could not retrieve game state", http.StatusInternalServerError)
+		return
+	}
+	defer h.Hub.Unsubscribe(client)
+
+	if isPlayer {
+		h.Presence.Connect(gameID, claims.UserID)
+		defer h.Presence.Disconnect(gameID, claims.UserID)
+	}
+	h.Online.Connect(hub.UserRoom, claims.UserID)
+	defer h.Online.Disconnect(hub.UserRoom, claims.UserID)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	// Не даём nginx буферизовать поток
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	for _, event := range backlog {
+		if err := writeSSE(w, event); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case event, ok := <-feed:
+			if !ok {
+				// Хаб отключил медленного клиента; браузер переподключится сам
+				return
+			}
+			if err := writeSSE(w, event); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-keepAlive.C:
+			if _, err := io.WriteString(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// writeSSE writes one event as an SSE message whose id is the event's seq
+func writeSSE(w io.Writer, event events.Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\ndata: %s\n\n", event.Seq, payload)
+	return err
+}
@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"backend/data"
+	"backend/events"
+	"errors"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"time"
+)
+
+// timerRetry is how soon an expiry that failed on a server error is retried
+const timerRetry = 5 * time.Second
+
+// gameRules returns the rules of a game as a move error
+func (h *Handler) gameRules(gameID int) (data.GameRules, error) {
+	game, err := h.Games.GetGameByID(gameID)
+	if err != nil {
+		return data.GameRules{}, internalError("Could not retrieve game", err)
+	}
+	if game == nil {
+		return data.GameRules{}, &gameError{status: http.StatusNotFound, message: "Game not found"}
+	}
+	return game.Rules, nil
+}
+
+// validateRules checks the limits a game may be created with; 0 turns a
+// timer or the spectator delay off
+func validateRules(rules data.GameRules) error {
+	if rules.TurnSeconds != 0 && (rules.TurnSeconds < 15 || rules.TurnSeconds > 600) {
+		return errors.New("turn_seconds must be 0 or between 15 and 600")
+	}
+	if rules.ResponseSeconds != 0 && (rules.ResponseSeconds < 5 || rules.ResponseSeconds > 120) {
+		return errors.New("response_seconds must be 0 or between 5 and 120")
+	}
+	if rules.SpectatorDelaySeconds < 0 || rules.SpectatorDelaySeconds > 300 {
+		return errors.New("spectator_delay_seconds must be between 0 and 300")
+	}
+	return nil
+}
+
+// turnDeadline is when a turn starting now runs out under rules, nil for never
+func turnDeadline(rules data.GameRules) *time.Time {
+	if rules.TurnSeconds <= 0 {
+		return nil
+	}
+	deadline := time.Now().Add(time.Duration(rules.TurnSeconds) * time.Second)
+	return &deadline
+}
+
+// armTimer schedules the deadline of a just committed state and, when it is
+// a new one, tells the table who has to act by when
+func (h *Handler) armTimer(gameID int, state *data.GameState) {
+	deadline, playerID := state.Deadline()
+	if deadline == nil {
+		h.Timers.Cancel(gameID)
+		return
+	}
+	if !deadline.After(time.Now()) {
+		// Дедлайн уже истёк, и expireDeadline как раз ходит за игрока
+		return
+	}
+	if !h.Timers.Schedule(gameID, *deadline) {
+		return
+	}
+	h.NotifyPlayers(gameID, state.Version, events.TimerStarted{
+		PlayerID: playerID,
+		Phase:    state.CurrentPhase,
+		Deadline: *deadline,
+		Seconds:  int(time.Until(*deadline).Round(time.Second) / time.Second),
+	})
+}
+
+// RestoreTimers reschedules the deadlines persisted in game_state, so a
+// restart does not leave running games without a clock. Deadlines that passed
+// while the server was down expire right away.
+func (h *Handler) RestoreTimers() error {
+	states, err := h.Process.GetGameStatesWithDeadlines()
+	if err != nil {
+		return err
+	}
+	for _, state := range states {
+		if deadline, _ := state.Deadline(); deadline != nil {
+			h.Timers.Schedule(state.ID, *deadline)
+		}
+	}
+	log.Printf("Restored %d turn timers", len(states))
+	return nil
+}
+
+// expireDeadline takes the default action for a player who ran out of time:
+// the target of a Bang! takes the hit; a player in the middle of their turn
+// discards at random down to their hand limit and ends it. Moves go through
+// the same code as the players' own, pinned to the version the deadline
+// belongs to, so a move that wins the race simply cancels the expiry. They do
+// not count as activity of the game: the janitor aborts a game that only the
+// timer keeps going.
+func (h *Handler) expireDeadline(gameID int) {
+	state, err := h.Process.GetGameState(gameID)
+	if err != nil {
+		log.Printf("Turn timer of game %d: %v", gameID, err)
+		h.Timers.Schedule(gameID, time.Now().Add(timerRetry))
+		return
+	}
+	if state == nil {
+		return
+	}
+	deadline, playerID := state.Deadline()
+	if deadline == nil {
+		return
+	}
+	if time.Now().Before(*deadline) {
+		// Сработал старый таймер, а дедлайн уже сдвинулся
+		h.Timers.Schedule(gameID, *deadline)
+		return
+	}
+
+	version := state.Version
+	action := "end_turn"
+	var committed *data.GameState
+	switch state.CurrentPhase {
+	case "respond":
+		action = "take_hit"
+		committed, err = h.respond(gameID, playerID, respondMove{}, &version, true)
+	case "play":
+		committed, err = h.discardToHandLimit(gameID, playerID, state)
+		if err == nil {
+			committed, err = h.endTurn(gameID, playerID, &committed.Version, true)
+		}
+	default:
+		committed, err = h.endTurn(gameID, playerID, &version, true)
+	}
+
+	var ge *gameError
+	switch {
+	case errors.As(err, &ge) && ge.status == http.StatusConflict:
+		// Игрок успел сходить сам, его ход уже перезапустил таймер
+		return
+	case errors.As(err, &ge) && ge.status < http.StatusInternalServerError:
+		log.Printf("Turn timer of game %d: %s", gameID, ge.message)
+		return
+	case err != nil:
+		log.Printf("Turn timer of game %d: %v", gameID, err)
+		h.Timers.Schedule(gameID, time.Now().Add(timerRetry))
+		return
+	}
+
+	h.NotifyPlayers(gameID, committed.Version, events.TurnTimedOut{
+		PlayerID: playerID,
+		Phase:    state.CurrentPhase,
+		Action:   action,
+	})
+}
+
+// discardToHandLimit discards random cards from the player's hand until it
+// holds no more cards than they have life points. It returns the state after
+// the last discard, or state itself when nothing had to go.
+func (h *Handler) discardToHandLimit(gameID int, userID int, state *data.GameState) (*data.GameState, error) {
+	hand, err := h.Process.GetPlayerHand(userID, gameID)
+	if err != nil {
+		return nil, err
+	}
+	players, err := h.Games.GetPlayersInGame(gameID)
+	if err != nil {
+		return nil, err
+	}
+	health := len(hand)
+	for _, player := range players {
+		if player["user_id"] == userID {
+			health, _ = player["health"].(int)
+		}
+	}
+
+	committed := state
+	for len(hand) > health {
+		i := rand.IntN(len(hand))
+		committed, err = h.discard(gameID, userID, discardMove{CardID: hand[i].ID}, &committed.Version, true)
+		if err != nil {
+			return nil, err
+		}
+		hand = append(hand[:i], hand[i+1:]...)
+	}
+	return committed, nil
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"backend/data"
+	"backend/hub"
+	"backend/middlewares"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// UserSocketHandler streams the authenticated user's own notifications, the
+// ones about no particular game such as "match_found" or "invite_received".
+// Clients keep it open alongside any game socket. It takes the commands of
+// handleUserCommand, with the same protocol as the game socket.
+func (h *Handler) UserSocketHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := middlewares.ClaimsFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	upgrader := websocket.Upgrader{CheckOrigin: h.checkOrigin}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("WebSocket upgrade error: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	client := h.Hub.Subscribe(hub.UserRoom, claims.UserID, false)
+	defer h.Hub.Unsubscribe(client)
+
+	h.Online.Connect(hub.UserRoom, claims.UserID)
+	defer h.Online.Disconnect(hub.UserRoom, claims.UserID)
+
+	stop := make(chan struct{})
+	defer close(stop)
+	messages, closed := h.readPump(conn, stop)
+	ping := time.NewTicker(pingPeriod)
+	defer ping.Stop()
+
+	for {
+		select {
+		case message := <-messages:
+			reply := h.handleUserCommand(claims, message)
+			conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := conn.WriteJSON(reply); err != nil {
+				log.Printf("WebSocket write error: %v", err)
+				return
+			}
+		case event, ok := <-client.Events():
+			if !ok {
+				conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "too slow"), time.Now().Add(writeWait))
+				return
+			}
+			if err := writeEvent(conn, event); err != nil {
+				log.Printf("WebSocket write error: %v", err)
+				return
+			}
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait)); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
+
+// inviteAnswer is the payload of accept_invite and decline_invite
+type inviteAnswer struct {
+	GameID int `json:"game_id"`
+}
+
+// handleUserCommand runs one command sent on the user stream. Supported
+// types are accept_invite and decline_invite:
+//
+//	{"id": "7", "type": "accept_invite", "payload": {"game_id": 12}}
+func (h *Handler) handleUserCommand(claims *data.Claims, message []byte) wsReply {
+	var command wsCommand
+	if err := json.Unmarshal(message, &command); err != nil {
+		return errorReply("", http.StatusBadRequest, "Invalid command")
+	}
+
+	var err error
+	switch command.Type {
+	case "accept_invite", "decline_invite":
+		var answer inviteAnswer
+		if err = decodePayload(command.Payload, &answer); err == nil {
+			err = h.answerInvite(answer.GameID, claims, command.Type == "accept_invite")
+		}
+	default:
+		return errorReply(command.ID, http.StatusBadRequest, "Unknown command type")
+	}
+
+	if err != nil {
+		return commandError(command.ID, err)
+	}
+	return wsReply{Type: "ack", RequestID: command.ID}
+}
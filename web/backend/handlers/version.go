@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"backend/data"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// expectedVersion returns the state version a move was based on. The If-Match
+// header wins over the expected_version body field; nil means the client did
+// not ask for a check.
+func expectedVersion(r *http.Request, fromBody *int64) (*int64, error) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" {
+		return fromBody, nil
+	}
+	value := strings.Trim(strings.TrimPrefix(header, "W/"), `"`)
+	version, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid If-Match header %q", header)
+	}
+	return &version, nil
+}
+
+// checkVersion rejects a move made against a stale view of the game
+func checkVersion(state *data.GameState, expected *int64) error {
+	if expected == nil || *expected == state.Version {
+		return nil
+	}
+	current := *state
+	return &gameError{
+		status:  http.StatusConflict,
+		message: fmt.Sprintf("Game state has changed: expected version %d, current is %d", *expected, state.Version),
+		state:   &current,
+	}
+}
+
+// setVersionHeader exposes the state version as an ETag usable in If-Match
+func setVersionHeader(w http.ResponseWriter, version int64) {
+	w.Header().Set("ETag", fmt.Sprintf(`"%d"`, version))
+}
+
+// decodeOptionalBody decodes a JSON body if the request has one
+func decodeOptionalBody(r *http.Request, v interface{}) error {
+	err := json.NewDecoder(r.Body).Decode(v)
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+	return err
+}
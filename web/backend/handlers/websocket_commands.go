@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"backend/data"
+	"backend/db"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+)
+
+// wsCommand is a message a client sends over /api/ws. Payload holds the same
+// body the matching REST endpoint takes:
+//
+//	{"id": "42", "type": "play_card", "payload": {"card_id": 3, "target_id": 7, "expected_version": 12}}
+//
+// Supported types are draw, play_card, respond, discard, end_turn and chat;
+// spectators may only chat.
+type wsCommand struct {
+	ID      string          `json:"id"` // chosen by the client, echoed in the reply
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// wsReply answers exactly one wsCommand: "ack" once the move is committed
+// (its events are already on their way), "error" when it was rejected. A
+// version conflict carries the current state like the REST 409 does.
+type wsReply struct {
+	Type      string          `json:"event"`
+	RequestID string          `json:"request_id"`
+	Version   int64           `json:"version,omitempty"`
+	Status    int             `json:"status,omitempty"`
+	Error     string          `json:"error,omitempty"`
+	State     *data.GameState `json:"state,omitempty"`
+}
+
+// handleCommand runs one command for the socket's user and builds its reply
+func (h *Handler) handleCommand(gameID int, claims *data.Claims, isPlayer bool, message []byte) wsReply {
+	var command wsCommand
+	if err := json.Unmarshal(message, &command); err != nil {
+		return errorReply("", http.StatusBadRequest, "Invalid command")
+	}
+	if !isPlayer && command.Type != "chat" {
+		return errorReply(command.ID, http.StatusForbidden, "Spectators can only chat")
+	}
+
+	var committed *data.GameState
+	var err error
+	switch command.Type {
+	case "draw":
+		var move turnMove
+		if err = decodePayload(command.Payload, &move); err == nil {
+			committed, err = h.startTurn(gameID, claims.UserID, move.ExpectedVersion)
+		}
+	case "play_card":
+		var move playCardMove
+		if err = decodePayload(command.Payload, &move); err == nil {
+			committed, err = h.playCard(gameID, claims.UserID, move, move.ExpectedVersion)
+		}
+	case "respond":
+		var move respondMove
+		if err = decodePayload(command.Payload, &move); err == nil {
+			committed, err = h.respond(gameID, claims.UserID, move, move.ExpectedVersion, false)
+		}
+	case "discard":
+		var move discardMove
+		if err = decodePayload(command.Payload, &move); err == nil {
+			committed, err = h.discard(gameID, claims.UserID, move, move.ExpectedVersion, false)
+		}
+	case "end_turn":
+		var move turnMove
+		if err = decodePayload(command.Payload, &move); err == nil {
+			committed, err = h.endTurn(gameID, claims.UserID, move.ExpectedVersion, false)
+		}
+	case "chat":
+		var chat chatMessage
+		if err = decodePayload(command.Payload, &chat); err == nil {
+			err = h.chat(gameID, claims, chat)
+		}
+	default:
+		return errorReply(command.ID, http.StatusBadRequest, "Unknown command type")
+	}
+
+	if err != nil {
+		return commandError(command.ID, err)
+	}
+	reply := wsReply{Type: "ack", RequestID: command.ID}
+	if committed != nil {
+		reply.Version = committed.Version
+	}
+	return reply
+}
+
+// decodePayload decodes a command payload; a missing payload is an empty body
+func decodePayload(payload json.RawMessage, v interface{}) error {
+	if len(payload) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(payload, v); err != nil {
+		return &gameError{status: http.StatusBadRequest, message: "Invalid command payload"}
+	}
+	return nil
+}
+
+// commandError turns a rejected move into an error reply, like writeGameError
+// does for REST
+func commandError(requestID string, err error) wsReply {
+	var ge *gameError
+	switch {
+	case errors.As(err, &ge):
+		reply := errorReply(requestID, ge.status, ge.message)
+		reply.State = ge.state
+		return reply
+	case errors.Is(err, db.ErrNoGameState):
+		return errorReply(requestID, http.StatusNotFound, "Game state not found")
+	case errors.Is(err, db.ErrNoGame):
+		return errorReply(requestID, http.StatusNotFound, "Game not found")
+	default:
+		log.Printf("Game transaction failed: %v", err)
+		return errorReply(requestID, http.StatusInternalServerError, "Could not complete the move")
+	}
+}
+
+func errorReply(requestID string, status int, message string) wsReply {
+	return wsReply{Type: "error", RequestID: requestID, Status: status, Error: message}
+}
@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"backend/events"
+	"backend/hub"
+	"backend/middlewares"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// writeWait is how long a single write may take
+	writeWait = 10 * time.Second
+	// pongWait is how long the peer may stay silent before it is considered gone
+	pongWait = 60 * time.Second
+	// pingPeriod must be shorter than pongWait so a live peer always answers in time
+	pingPeriod = pongWait * 9 / 10
+	// maxMessageSize limits what clients may send
+	maxMessageSize = 4096
+)
+
+// WebSocketHandler subscribes the authenticated user to the room of
+// ?game_id=. Players of the game also receive their private events; anyone
+// else must ask for ?spectate=true and only sees public events, as late as
+// the game's spectator_delay_seconds rule says.
+//
+// A reconnecting client passes ?resume_from=<seq> with the last seq it saw.
+// It first receives the events it missed, or a "snapshot" event with the
+// full game state when they are no longer buffered.
+//
+// Players can also play over the socket: see wsCommand for the protocol.
+func (h *Handler) WebSocketHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := middlewares.ClaimsFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	gameID, err := strconv.Atoi(r.URL.Query().Get("game_id"))
+	if err != nil {
+		http.Error(w, "Invalid game ID", http.StatusBadRequest)
+		return
+	}
+
+	isPlayer, delay, ok := h.gameStreamAccess(w, r, gameID, claims.UserID)
+	if !ok {
+		return
+	}
+
+	resumeFrom := int64(-1)
+	if value := r.URL.Query().Get("resume_from"); value != "" {
+		resumeFrom, err = strconv.ParseInt(value, 10, 64)
+		if err != nil || resumeFrom < 0 {
+			http.Error(w, "Invalid resume_from", http.StatusBadRequest)
+			return
+		}
+	}
+
+	upgrader := websocket.Upgrader{CheckOrigin: h.checkOrigin}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("WebSocket upgrade error: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	client, backlog, feed, err := h.subscribeGame(gameID, claims.UserID, isPlayer, delay, resumeFrom)
+	if err != nil {
+		log.Printf("WebSocket snapshot error: %v", err)
+		return
+	}
+	for _, event := range backlog {
+		if err := writeEvent(conn, event); err != nil {
+			log.Printf("WebSocket write error: %v", err)
+			h.Hub.Unsubscribe(client)
+			return
+		}
+	}
+	defer h.Hub.Unsubscribe(client)
+
+	if isPlayer {
+		h.Presence.Connect(gameID, claims.UserID)
+		defer h.Presence.Disconnect(gameID, claims.UserID)
+	}
+	h.Online.Connect(hub.UserRoom, claims.UserID)
+	defer h.Online.Disconnect(hub.UserRoom, claims.UserID)
+
+	stop := make(chan struct{})
+	defer close(stop)
+	commands, closed := h.readPump(conn, stop)
+	ping := time.NewTicker(pingPeriod)
+	defer ping.Stop()
+
+	for {
+		select {
+		case message := <-commands:
+			// Команда выполняется здесь, чтобы ответ не писался в сокет параллельно с событиями
+			reply := h.handleCommand(gameID, claims, isPlayer, message)
+			conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := conn.WriteJSON(reply); err != nil {
+				log.Printf("WebSocket write error: %v", err)
+				return
+			}
+		case event, ok := <-feed:
+			if !ok {
+				// Хаб отключил медленного клиента
+				conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "too slow"), time.Now().Add(writeWait))
+				return
+			}
+			if err := writeEvent(conn, event); err != nil {
+				log.Printf("WebSocket write error: %v", err)
+				return
+			}
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait)); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
+
+// readPump reads from conn until it fails, which is how a closed socket or a
+// peer that stopped answering pings is noticed. Incoming messages are handed
+// to the write loop on commands; closed is closed when reading stops. The
+// write loop closes stop when it exits so the pump never blocks on it.
+func (h *Handler) readPump(conn *websocket.Conn, stop <-chan struct{}) (commands <-chan []byte, closed <-chan struct{}) {
+	messages := make(chan []byte)
+	done := make(chan struct{})
+	conn.SetReadLimit(maxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	go func() {
+		defer close(done)
+		for {
+			_, message, err := conn.ReadMessage()
+			if err != nil {
+				if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+					log.Printf("WebSocket read error: %v", err)
+				}
+				return
+			}
+			conn.SetReadDeadline(time.Now().Add(pongWait))
+
+			select {
+			case messages <- message:
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return messages, done
+}
+
+// writeEvent sends one event, giving up after writeWait
+func writeEvent(conn *websocket.Conn, event events.Event) error {
+	conn.SetWriteDeadline(time.Now().Add(writeWait))
+	return conn.WriteJSON(event)
+}
+
+// withPresence adds every player's connection status to a players listing
+func (h *Handler) withPresence(gameID int, players []map[string]interface{}) {
+	for _, player := range players {
+		userID, ok := player["user_id"].(int)
+		if !ok {
+			continue
+		}
+		entry := h.Presence.Get(gameID, userID)
+		player["presence"] = entry.Status
+		player["presence_since"] = entry.Since
+	}
+}
+
+// checkOrigin applies the CORS origin allowlist to the WebSocket handshake.
+// Requests without an Origin header come from non-browser clients.
+func (h *Handler) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	for _, allowed := range h.AllowedOrigins {
+		if origin == allowed {
+			return true
+		}
+	}
+	log.Printf("WebSocket origin rejected: %s", origin)
+	return false
+}
+
+// NotifyPlayers sends a notification to everyone connected to the game
+func (h *Handler) NotifyPlayers(gameID int, version int64, payload events.Payload) {
+	event := events.New(gameID, payload)
+	event.Version = version
+	h.Events.Publish(event)
+}
+
+// NotifyPlayer sends a private notification to one player's connections
+func (h *Handler) NotifyPlayer(gameID int, userID int, version int64, payload events.Payload) {
+	event := events.New(gameID, payload)
+	event.Version = version
+	event.Recipient = userID
+	h.Events.Publish(event)
+}
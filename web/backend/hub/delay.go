@@ -0,0 +1,55 @@
+package hub
+
+import (
+	"backend/events"
+	"time"
+)
+
+// Delay returns a channel carrying backlog and then the events of in, each
+// held back until delay after it reached Delay. in is read as fast as it
+// fills, so a delayed client never looks slow to the hub however long the
+// delay. The returned channel is closed, and whatever is still held dropped,
+// as soon as in is closed.
+func Delay(backlog []events.Event, in <-chan events.Event, delay time.Duration) <-chan events.Event {
+	type held struct {
+		event events.Event
+		due   time.Time
+	}
+
+	out := make(chan events.Event)
+	go func() {
+		defer close(out)
+
+		queue := make([]held, 0, len(backlog))
+		due := time.Now().Add(delay)
+		for _, event := range backlog {
+			queue = append(queue, held{event, due})
+		}
+
+		for {
+			// Пустые каналы в select никогда не срабатывают
+			var send chan<- events.Event
+			var next events.Event
+			var wait <-chan time.Time
+			if len(queue) > 0 {
+				if left := time.Until(queue[0].due); left > 0 {
+					wait = time.After(left)
+				} else {
+					send, next = out, queue[0].event
+				}
+			}
+
+			select {
+			case event, ok := <-in:
+				if !ok {
+					return
+				}
+				queue = append(queue, held{event, time.Now().Add(delay)})
+			case send <- next:
+				queue = queue[1:]
+			case <-wait:
+			}
+		}
+	}()
+	return out
+}
@@ -0,0 +1,293 @@
+package hub
+
+import (
+	"backend/events"
+	"log"
+	"sync"
+)
+
+// SlowConsumerPolicy decides what happens to a client whose buffer is full
+type SlowConsumerPolicy int
+
+const (
+	// Disconnect drops the client from its room; its connection closes and
+	// the client is expected to reconnect and resync
+	Disconnect SlowConsumerPolicy = iota
+	// DropEvent skips the event for that client and keeps it connected
+	DropEvent
+)
+
+// Options configure a Hub
+type Options struct {
+	// Buffer is how many events a client may fall behind by
+	Buffer int
+	// SlowConsumer is applied when a client's buffer is full
+	SlowConsumer SlowConsumerPolicy
+	// History is how many recent events per game are kept for resuming clients
+	History int
+}
+
+// UserRoom is the room of events about no particular game, such as a
+// matchmaking result. Every event published there has a Recipient.
+const UserRoom = 0
+
+// DefaultOptions buffer 64 events per client, disconnect slow clients and
+// keep the last 256 events of every game
+var DefaultOptions = Options{Buffer: 64, SlowConsumer: Disconnect, History: 256}
+
+// Client is one authenticated connection subscribed to a game room. The
+// connection's write loop drains Events; the channel is closed when the
+// client leaves the room.
+type Client struct {
+	GameID    int
+	UserID    int
+	Spectator bool // spectators only ever receive public events and their own audience's
+	send      chan events.Event
+	dropped   int
+}
+
+// Events returns the channel the client's events arrive on
+func (c *Client) Events() <-chan events.Event {
+	return c.send
+}
+
+// accepts reports whether event may be delivered to the client
+func (c *Client) accepts(event events.Event) bool {
+	if event.Audience == events.AudienceSpectators {
+		return c.Spectator
+	}
+	if event.Recipient == 0 {
+		return true
+	}
+	return !c.Spectator && event.Recipient == c.UserID
+}
+
+// Hub fans events out to per-game rooms of connected clients. It implements
+// events.Publisher and never blocks the publisher: every client has its own
+// buffer, and clients that fall behind are handled by Options.SlowConsumer.
+// Every game's events are numbered and the most recent ones are kept so a
+// reconnecting client can resume where it left off.
+type Hub struct {
+	options Options
+
+	mu      sync.RWMutex
+	rooms   map[int]map[*Client]struct{}
+	history map[int]*gameHistory
+}
+
+// gameHistory is a game's last seq and a bounded buffer of its recent events
+type gameHistory struct {
+	seq    int64
+	events []events.Event // oldest first, at most Options.History long
+}
+
+// New returns a hub with no rooms
+func New(options Options) *Hub {
+	if options.Buffer <= 0 {
+		options.Buffer = DefaultOptions.Buffer
+	}
+	if options.History <= 0 {
+		options.History = DefaultOptions.History
+	}
+	return &Hub{
+		options: options,
+		rooms:   make(map[int]map[*Client]struct{}),
+		history: make(map[int]*gameHistory),
+	}
+}
+
+// Subscribe adds a new client for userID to the room of gameID
+func (h *Hub) Subscribe(gameID int, userID int, spectator bool) *Client {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.add(gameID, userID, spectator)
+}
+
+// Resume subscribes a reconnecting client that last saw event afterSeq and
+// returns the events it missed, in order, plus the game's latest seq at the
+// moment of subscribing. ok is false when the gap is no longer in the history
+// buffer (or afterSeq is unknown, e.g. after a server restart); the client is
+// still subscribed and should be sent a snapshot instead. Subscribing and
+// reading the history happen atomically, so nothing is lost or sent twice.
+func (h *Hub) Resume(gameID int, userID int, spectator bool, afterSeq int64) (client *Client, missed []events.Event, latest int64, ok bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	client = h.add(gameID, userID, spectator)
+
+	var buffered []events.Event
+	if history := h.history[gameID]; history != nil {
+		latest, buffered = history.seq, history.events
+	}
+	if afterSeq > latest {
+		return client, nil, latest, false
+	}
+	if afterSeq == latest {
+		return client, nil, latest, true
+	}
+	if len(buffered) == 0 || buffered[0].Seq > afterSeq+1 {
+		return client, nil, latest, false
+	}
+	for _, event := range buffered {
+		if event.Seq > afterSeq && client.accepts(event) {
+			missed = append(missed, event)
+		}
+	}
+	return client, missed, latest, true
+}
+
+// LatestSeq returns the seq of the last event published for a game
+func (h *Hub) LatestSeq(gameID int) int64 {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if history := h.history[gameID]; history != nil {
+		return history.seq
+	}
+	return 0
+}
+
+// Forget drops the history of a game that no longer exists
+func (h *Hub) Forget(gameID int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.history, gameID)
+}
+
+// add must be called with h.mu held for writing
+func (h *Hub) add(gameID int, userID int, spectator bool) *Client {
+	client := &Client{
+		GameID:    gameID,
+		UserID:    userID,
+		Spectator: spectator,
+		send:      make(chan events.Event, h.options.Buffer),
+	}
+	room, ok := h.rooms[gameID]
+	if !ok {
+		room = make(map[*Client]struct{})
+		h.rooms[gameID] = room
+	}
+	room[client] = struct{}{}
+	return client
+}
+
+// Unsubscribe removes the client from its room and closes its channel.
+// Calling it more than once is safe.
+func (h *Hub) Unsubscribe(client *Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.remove(client)
+}
+
+// Publish numbers the event, keeps it in the game's history and delivers it
+// to every client in the room of event.GameID that may see it
+func (h *Hub) Publish(event events.Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	history := h.gameHistory(event.GameID)
+	history.seq++
+	event.Seq = history.seq
+	h.deliver(history, event)
+}
+
+// Deliver is Publish for an event already numbered elsewhere, such as one
+// fanned out from another instance. Events must arrive in seq order per
+// game; one at or below the latest seq is a duplicate and is dropped.
+func (h *Hub) Deliver(event events.Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	history := h.gameHistory(event.GameID)
+	if event.Seq <= history.seq {
+		return
+	}
+	history.seq = event.Seq
+	h.deliver(history, event)
+}
+
+// Reset forgets the history of every game, for when events may have been
+// missed: resuming clients then get a snapshot instead of a silent gap
+func (h *Hub) Reset() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.history = make(map[int]*gameHistory)
+}
+
+// gameHistory must be called with h.mu held for writing
+func (h *Hub) gameHistory(gameID int) *gameHistory {
+	history, ok := h.history[gameID]
+	if !ok {
+		history = &gameHistory{}
+		h.history[gameID] = history
+	}
+	return history
+}
+
+// deliver must be called with h.mu held for writing
+func (h *Hub) deliver(history *gameHistory, event events.Event) {
+	history.events = append(history.events, event)
+	if over := len(history.events) - h.options.History; over > 0 {
+		history.events = append(history.events[:0:0], history.events[over:]...)
+	}
+
+	var slow []*Client
+	for client := range h.rooms[event.GameID] {
+		if !client.accepts(event) {
+			continue
+		}
+		select {
+		case client.send <- event:
+		default:
+			slow = append(slow, client)
+		}
+	}
+
+	for _, client := range slow {
+		switch h.options.SlowConsumer {
+		case DropEvent:
+			client.dropped++
+			log.Printf("Hub: dropped %s for slow client of user %d in game %d (%d dropped)", event.Type, client.UserID, client.GameID, client.dropped)
+		default:
+			log.Printf("Hub: disconnecting slow client of user %d in game %d", client.UserID, client.GameID)
+			h.remove(client)
+		}
+	}
+}
+
+// RoomSize returns the number of clients connected to a game
+func (h *Hub) RoomSize(gameID int) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.rooms[gameID])
+}
+
+// Spectators returns the number of users watching a game, however many
+// connections each of them has open
+func (h *Hub) Spectators(gameID int) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	users := make(map[int]struct{})
+	for client := range h.rooms[gameID] {
+		if client.Spectator {
+			users[client.UserID] = struct{}{}
+		}
+	}
+	return len(users)
+}
+
+// remove must be called with h.mu held for writing
+func (h *Hub) remove(client *Client) {
+	room, ok := h.rooms[client.GameID]
+	if !ok {
+		return
+	}
+	if _, ok := room[client]; !ok {
+		return
+	}
+	delete(room, client)
+	close(client.send)
+	if len(room) == 0 {
+		delete(h.rooms, client.GameID)
+	}
+}
+
+var _ events.Publisher = (*Hub)(nil)
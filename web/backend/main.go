@@ -1,64 +1,144 @@
 package main
 
 import (
+	"encoding/json"
 	"log"
 	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
 
+	"backend/chat"
 	"backend/db"
+	"backend/events"
+	"backend/fanout"
 	"backend/handlers"
+	"backend/hub"
+	"backend/matchmaking"
 	"backend/middlewares"
+	"backend/presence"
 
-	"github.com/gorilla/mux"
-	"github.com/gorilla/websocket"
 	hand "github.com/gorilla/handlers"
 )
 
-// Инициализация WebSocket upgrader
-var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool {
-		return true
-	},
-}
-
 func main() {
-	// Подключение к базе данных
-	db.ConnectDB()
+	// `backend schema` prints the JSON Schema of game events, e.g. for client codegen
+	if len(os.Args) > 1 && os.Args[1] == "schema" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(events.Schema()); err != nil {
+			log.Fatalf("Failed to write schema: %v", err)
+		}
+		return
+	}
 
-	// Создание маршрутизатора
-	router := mux.NewRouter()
+	// STORE=memory runs the API without PostgreSQL; data is lost on restart
+	var store db.Store
+	var pg *db.PostgresStore
+	if os.Getenv("STORE") == "memory" {
+		log.Println("Using in-memory store")
+		store = db.NewMemoryStore()
+	} else {
+		// Подключение к базе данных
+		pg = db.NewPostgresStore(db.ConnectDB())
 
-	// Public routes (доступны без аутентификации)
-	router.HandleFunc("/api/register", handlers.RegisterUserHandler).Methods("POST")
-	router.HandleFunc("/api/register_users", handlers.RegisterMultipleUsersHandler).Methods("POST")
-	router.HandleFunc("/api/login", handlers.LoginHandler).Methods("POST")
-	router.HandleFunc("/api/users", handlers.GetUsersHandler).Methods("GET")
+		if err := pg.Migrate(); err != nil {
+			log.Fatalf("Failed to migrate database: %v", err)
+		}
 
-	// Protected routes (требуют аутентификации)
-	protected := router.PathPrefix("/api").Subrouter()
-	protected.Use(middlewares.JWTAuthMiddleware)
+		// `backend seed` loads the catalog and exits; SEED_CATALOG=true seeds on startup
+		if len(os.Args) > 1 && os.Args[1] == "seed" {
+			if err := pg.SeedCatalog(); err != nil {
+				log.Fatalf("Failed to seed catalog: %v", err)
+			}
+			return
+		}
+		if os.Getenv("SEED_CATALOG") == "true" {
+			if err := pg.SeedCatalog(); err != nil {
+				log.Fatalf("Failed to seed catalog: %v", err)
+			}
+		}
+		store = pg
+	}
 
+	h := handlers.NewHandler(store)
+	if retention, err := time.ParseDuration(os.Getenv("IDEMPOTENCY_RETENTION")); err == nil {
+		h.IdempotencyRetention = retention
+	}
+	// HUB_SLOW_CONSUMER=drop skips events for lagging sockets instead of disconnecting them
+	if os.Getenv("HUB_SLOW_CONSUMER") == "drop" {
+		rooms := hub.New(hub.Options{Buffer: hub.DefaultOptions.Buffer, SlowConsumer: hub.DropEvent})
+		h.Hub, h.Events = rooms, rooms
+		h.Presence = presence.New(rooms, presence.DefaultGrace)
+	}
+	// EVENT_FANOUT=postgres shares events between replicas through LISTEN/NOTIFY
+	if os.Getenv("EVENT_FANOUT") == "postgres" {
+		if pg == nil {
+			log.Fatal("EVENT_FANOUT=postgres requires the PostgreSQL store")
+		}
+		if err := fanout.Listen(db.DatabaseURL(), h.Hub); err != nil {
+			log.Fatalf("Failed to listen for events: %v", err)
+		}
+		publisher := fanout.NewPostgres(pg, fanout.DefaultBuffer)
+		h.Events = publisher
+		h.Presence = presence.New(publisher, presence.DefaultGrace)
+	}
+	if origins := os.Getenv("ALLOWED_ORIGINS"); origins != "" {
+		h.AllowedOrigins = strings.Split(origins, ",")
+	}
+	// MATCHMAKING_WIDEN_EVERY and MATCHMAKING_WIDEN_BY set how fast the rating band of a waiting player grows
+	matchOptions := matchmaking.DefaultOptions
+	if every, err := time.ParseDuration(os.Getenv("MATCHMAKING_WIDEN_EVERY")); err == nil {
+		matchOptions.WidenEvery = every
+	}
+	if by, err := strconv.Atoi(os.Getenv("MATCHMAKING_WIDEN_BY")); err == nil {
+		matchOptions.WidenBy = by
+	}
+	if band, err := strconv.Atoi(os.Getenv("MATCHMAKING_MAX_BAND")); err == nil {
+		matchOptions.MaxBand = band
+	}
+	h.Matchmaking = matchmaking.New(matchOptions)
+	// CHAT_RATE_MESSAGES messages per CHAT_RATE_WINDOW is how fast a user may chat
+	chatLimit := chat.DefaultLimit
+	if messages, err := strconv.Atoi(os.Getenv("CHAT_RATE_MESSAGES")); err == nil {
+		chatLimit.Messages = messages
+	}
+	if window, err := time.ParseDuration(os.Getenv("CHAT_RATE_WINDOW")); err == nil {
+		chatLimit.Per = window
+	}
+	h.ChatLimiter = chat.NewLimiter(chatLimit)
+	// Таймеры ходов переживают перезапуск: дедлайны хранятся в game_state
+	if err := h.RestoreTimers(); err != nil {
+		log.Fatalf("Failed to restore turn timers: %v", err)
+	}
+	go middlewares.PurgeIdempotencyKeys(h.Idempotency, h.IdempotencyRetention, time.Hour)
+	go h.RunMatchmaking()
 
-	protected.HandleFunc("/user", handlers.GetCurrentUser).Methods("GET") 
+	// JANITOR_LOBBY_TTL and JANITOR_ABANDON_AFTER set when idle games are cleaned up;
+	// JANITOR_DRY_RUN=true only logs what would be cleaned up
+	janitorOptions := handlers.DefaultJanitorOptions
+	if interval, err := time.ParseDuration(os.Getenv("JANITOR_INTERVAL")); err == nil && interval > 0 {
+		janitorOptions.Interval = interval
+	}
+	if ttl, err := time.ParseDuration(os.Getenv("JANITOR_LOBBY_TTL")); err == nil {
+		janitorOptions.LobbyTTL = ttl
+	}
+	if after, err := time.ParseDuration(os.Getenv("JANITOR_ABANDON_AFTER")); err == nil {
+		janitorOptions.AbandonAfter = after
+	}
+	janitorOptions.DryRun = os.Getenv("JANITOR_DRY_RUN") == "true"
+	go h.RunJanitor(janitorOptions)
 
-	// Обработчики для игр
-	protected.HandleFunc("/games", handlers.GetAllGamesHandler).Methods("GET")             // Получение списка всех игр
-	protected.HandleFunc("/games/new", handlers.CreateGameHandler).Methods("POST")         // Создание новой игры
-	protected.HandleFunc("/games/{id}", handlers.GetGameDetailsHandler).Methods("GET")     // Получение деталей игры
-	protected.HandleFunc("/games/join", handlers.JoinGameHandler).Methods("POST")          // Присоединение к игре
-	protected.HandleFunc("/games/{id}/start", handlers.StartGameHandler).Methods("POST")   // Запуск игры
-	protected.HandleFunc("/games/{id}/delete", handlers.DeleteGameHandler).Methods("DELETE") // Удаление игры
-	// Обработчики игрового процесса
-	protected.HandleFunc("/games/{id}/play", handlers.PlayCardHandler).Methods("POST")     // Разыгрывание карты
-	protected.HandleFunc("/games/{id}/end", handlers.EndTurnHandler).Methods("POST")       // Завершение хода
-
-	// WebSocket route
-	protected.HandleFunc("/ws", handlers.WebSocketHandler).Methods("GET")
+	// Создание маршрутизатора
+	router := handlers.NewRouter(h)
 
 	// Enable CORS
 	corsOptions := hand.CORS(
-		hand.AllowedHeaders([]string{"Content-Type", "Authorization"}),
+		hand.AllowedHeaders([]string{"Content-Type", "Authorization", "If-Match", "Idempotency-Key", "Last-Event-ID"}),
+		hand.ExposedHeaders([]string{"ETag", "Idempotent-Replayed"}),
 		hand.AllowedMethods([]string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}),
-		hand.AllowedOrigins([]string{"http://localhost:5173"}),
+		hand.AllowedOrigins(h.AllowedOrigins),
 		hand.AllowCredentials(), // Разрешаем учетные данные (cookie)
 	)
 
@@ -0,0 +1,219 @@
+package matchmaking
+
+import (
+	"errors"
+	"log"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrQueued is returned when a user who is already waiting joins again
+var ErrQueued = errors.New("already in the matchmaking queue")
+
+// Options configure a Queue
+type Options struct {
+	// Interval is how often the matcher looks for tables
+	Interval time.Duration
+	// Every WidenEvery a player waits, their rating band grows by WidenBy,
+	// up to MaxBand, so a long wait ends with a looser match instead of none
+	WidenEvery time.Duration
+	WidenBy    int
+	MaxBand    int
+}
+
+// DefaultOptions match every 2 seconds and widen the rating band by 100
+// every 30 seconds, up to 1000
+var DefaultOptions = Options{Interval: 2 * time.Second, WidenEvery: 30 * time.Second, WidenBy: 100, MaxBand: 1000}
+
+// Preferences are what a player asks of the table they are matched to
+type Preferences struct {
+	Expansions []string `json:"expansions"`  // the exact set the game is played with, sorted
+	MinPlayers int      `json:"min_players"` // table size range, both inclusive
+	MaxPlayers int      `json:"max_players"`
+	RatingBand int      `json:"rating_band"` // how far from their rating the others may be
+}
+
+// Ticket is one player waiting in the queue
+type Ticket struct {
+	UserID int `json:"user_id"`
+	Rating int `json:"rating"`
+	Preferences
+	JoinedAt time.Time `json:"joined_at"`
+}
+
+// Band returns the rating band of the ticket once it has waited until now
+func (t *Ticket) Band(now time.Time, options Options) int {
+	band := t.RatingBand
+	if options.WidenEvery > 0 {
+		band += int(now.Sub(t.JoinedAt)/options.WidenEvery) * options.WidenBy
+	}
+	if options.MaxBand > 0 && band > options.MaxBand {
+		band = max(t.RatingBand, options.MaxBand)
+	}
+	return band
+}
+
+// Queue holds the players waiting for a table and forms tables out of them.
+// It lives in memory only: every instance matches the players queued on it.
+type Queue struct {
+	options Options
+
+	mu      sync.Mutex
+	tickets map[int]*Ticket
+}
+
+// New returns an empty queue
+func New(options Options) *Queue {
+	if options.Interval <= 0 {
+		options.Interval = DefaultOptions.Interval
+	}
+	return &Queue{options: options, tickets: make(map[int]*Ticket)}
+}
+
+// Options returns the options the queue was built with
+func (q *Queue) Options() Options {
+	return q.options
+}
+
+// Join queues a player. The ticket's JoinedAt is set when left zero.
+func (q *Queue) Join(ticket Ticket) (Ticket, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if _, ok := q.tickets[ticket.UserID]; ok {
+		return Ticket{}, ErrQueued
+	}
+	if ticket.JoinedAt.IsZero() {
+		ticket.JoinedAt = time.Now()
+	}
+	q.tickets[ticket.UserID] = &ticket
+	return ticket, nil
+}
+
+// Leave takes a player out of the queue and reports whether they were in it
+func (q *Queue) Leave(userID int) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if _, ok := q.tickets[userID]; !ok {
+		return false
+	}
+	delete(q.tickets, userID)
+	return true
+}
+
+// Get returns the ticket of a waiting player
+func (q *Queue) Get(userID int) (Ticket, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if t, ok := q.tickets[userID]; ok {
+		return *t, true
+	}
+	return Ticket{}, false
+}
+
+// Len returns how many players are waiting
+func (q *Queue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.tickets)
+}
+
+// Run matches the queue every Options.Interval until the process exits,
+// handing every table to form. When form fails, the table's players go back
+// to the queue.
+func (q *Queue) Run(form func(table []Ticket) error) {
+	ticker := time.NewTicker(q.options.Interval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		for _, table := range q.Match(now) {
+			if err := form(table); err != nil {
+				log.Printf("Matchmaking: could not form a table: %v", err)
+				q.requeue(table)
+			}
+		}
+	}
+}
+
+// Match takes every table that can be formed at now out of the queue. Players
+// are seated longest waiting first; each table is as large as its players
+// allow, and formed as soon as it reaches everyone's minimum.
+func (q *Queue) Match(now time.Time) [][]Ticket {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	waiting := make([]*Ticket, 0, len(q.tickets))
+	for _, t := range q.tickets {
+		waiting = append(waiting, t)
+	}
+	sort.Slice(waiting, func(i, j int) bool {
+		if !waiting[i].JoinedAt.Equal(waiting[j].JoinedAt) {
+			return waiting[i].JoinedAt.Before(waiting[j].JoinedAt)
+		}
+		return waiting[i].UserID < waiting[j].UserID
+	})
+
+	var tables [][]Ticket
+	seated := make(map[int]bool)
+	for i, anchor := range waiting {
+		if seated[anchor.UserID] {
+			continue
+		}
+		table := []*Ticket{anchor}
+		low, high := anchor.MinPlayers, anchor.MaxPlayers
+		for _, t := range waiting[i+1:] {
+			if len(table) == high {
+				break
+			}
+			if seated[t.UserID] || !slices.Equal(t.Expansions, anchor.Expansions) {
+				continue
+			}
+			newLow, newHigh := max(low, t.MinPlayers), min(high, t.MaxPlayers)
+			if newLow > newHigh || len(table)+1 > newHigh || !q.fits(table, t, now) {
+				continue
+			}
+			table = append(table, t)
+			low, high = newLow, newHigh
+		}
+		if len(table) < low {
+			continue
+		}
+
+		formed := make([]Ticket, len(table))
+		for j, t := range table {
+			seated[t.UserID] = true
+			delete(q.tickets, t.UserID)
+			formed[j] = *t
+		}
+		tables = append(tables, formed)
+	}
+	return tables
+}
+
+// fits reports whether t and every player already at the table are within
+// each other's rating band
+func (q *Queue) fits(table []*Ticket, t *Ticket, now time.Time) bool {
+	band := t.Band(now, q.options)
+	for _, other := range table {
+		diff := t.Rating - other.Rating
+		if diff < 0 {
+			diff = -diff
+		}
+		if diff > band || diff > other.Band(now, q.options) {
+			return false
+		}
+	}
+	return true
+}
+
+// requeue puts back the players of a table that could not be formed, keeping
+// their place in line. Players who queued again meanwhile keep the new ticket.
+func (q *Queue) requeue(table []Ticket) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i := range table {
+		if _, ok := q.tickets[table[i].UserID]; !ok {
+			q.tickets[table[i].UserID] = &table[i]
+		}
+	}
+}
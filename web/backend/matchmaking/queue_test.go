@@ -0,0 +1,176 @@
+package matchmaking
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+var start = time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+// ticket is a player who queued wait after start
+func ticket(userID int, rating int, wait time.Duration, minPlayers int, maxPlayers int, expansions ...string) Ticket {
+	return Ticket{
+		UserID:      userID,
+		Rating:      rating,
+		Preferences: Preferences{Expansions: expansions, MinPlayers: minPlayers, MaxPlayers: maxPlayers, RatingBand: 100},
+		JoinedAt:    start.Add(wait),
+	}
+}
+
+// seats returns the user IDs at every table, in seating order
+func seats(tables [][]Ticket) [][]int {
+	var ids [][]int
+	for _, table := range tables {
+		var userIDs []int
+		for _, t := range table {
+			userIDs = append(userIDs, t.UserID)
+		}
+		ids = append(ids, userIDs)
+	}
+	return ids
+}
+
+func TestMatch(t *testing.T) {
+	options := Options{WidenEvery: 30 * time.Second, WidenBy: 100, MaxBand: 1000}
+	tests := []struct {
+		name    string
+		options Options
+		tickets []Ticket
+		after   time.Duration // how long after start the queue is matched
+		want    [][]int
+	}{
+		{
+			name:    "four alike",
+			tickets: []Ticket{ticket(1, 1000, 0, 4, 7), ticket(2, 1000, 0, 4, 7), ticket(3, 1000, 0, 4, 7), ticket(4, 1000, 0, 4, 7)},
+			want:    [][]int{{1, 2, 3, 4}},
+		},
+		{
+			name:    "not enough players",
+			tickets: []Ticket{ticket(1, 1000, 0, 4, 7), ticket(2, 1000, 0, 4, 7), ticket(3, 1000, 0, 4, 7)},
+		},
+		{
+			name:    "longest waiting first",
+			tickets: []Ticket{ticket(1, 1000, 4*time.Second, 4, 4), ticket(2, 1000, 3*time.Second, 4, 4), ticket(3, 1000, 2*time.Second, 4, 4), ticket(4, 1000, time.Second, 4, 4), ticket(5, 1000, 0, 4, 4)},
+			after:   5 * time.Second,
+			want:    [][]int{{5, 4, 3, 2}},
+		},
+		{
+			name:    "rating too far before widening",
+			tickets: []Ticket{ticket(1, 1000, 0, 4, 7), ticket(2, 1000, 0, 4, 7), ticket(3, 1000, 0, 4, 7), ticket(4, 1300, 0, 4, 7)},
+			after:   59 * time.Second,
+		},
+		{
+			name:    "rating band widens with the wait",
+			tickets: []Ticket{ticket(1, 1000, 0, 4, 7), ticket(2, 1000, 0, 4, 7), ticket(3, 1000, 0, 4, 7), ticket(4, 1300, 0, 4, 7)},
+			after:   60 * time.Second,
+			want:    [][]int{{1, 2, 3, 4}},
+		},
+		{
+			name:    "a newcomer's band is still narrow",
+			tickets: []Ticket{ticket(1, 1000, 0, 4, 7), ticket(2, 1000, 0, 4, 7), ticket(3, 1000, 0, 4, 7), ticket(4, 1300, 50*time.Second, 4, 7)},
+			after:   60 * time.Second,
+		},
+		{
+			name:    "widening stops at MaxBand",
+			options: Options{WidenEvery: 30 * time.Second, WidenBy: 100, MaxBand: 200},
+			tickets: []Ticket{ticket(1, 1000, 0, 4, 7), ticket(2, 1000, 0, 4, 7), ticket(3, 1000, 0, 4, 7), ticket(4, 1300, 0, 4, 7)},
+			after:   time.Hour,
+		},
+		{
+			name:    "expansion sets must match",
+			tickets: []Ticket{ticket(1, 1000, 0, 4, 7), ticket(2, 1000, 0, 4, 7, "dodge_city"), ticket(3, 1000, 0, 4, 7), ticket(4, 1000, 0, 4, 7)},
+		},
+		{
+			name: "a table per expansion set",
+			tickets: []Ticket{
+				ticket(1, 1000, 0, 4, 4, "dodge_city"), ticket(2, 1000, 0, 4, 4), ticket(3, 1000, time.Second, 4, 4, "dodge_city"), ticket(4, 1000, time.Second, 4, 4),
+				ticket(5, 1000, 2*time.Second, 4, 4, "dodge_city"), ticket(6, 1000, 2*time.Second, 4, 4), ticket(7, 1000, 3*time.Second, 4, 4, "dodge_city"), ticket(8, 1000, 3*time.Second, 4, 4),
+			},
+			after: 5 * time.Second,
+			want:  [][]int{{1, 3, 5, 7}, {2, 4, 6, 8}},
+		},
+		{
+			name: "table size is the intersection of the ranges",
+			tickets: []Ticket{
+				ticket(1, 1000, 0, 4, 5), ticket(2, 1000, 0, 4, 7), ticket(3, 1000, 0, 4, 7),
+				ticket(4, 1000, 0, 4, 7), ticket(5, 1000, 0, 4, 7), ticket(6, 1000, 0, 4, 7),
+			},
+			want: [][]int{{1, 2, 3, 4, 5}},
+		},
+		{
+			name: "a minimum above the table's maximum skips the player",
+			tickets: []Ticket{
+				ticket(1, 1000, 0, 4, 5), ticket(2, 1000, time.Second, 6, 7), ticket(3, 1000, time.Second, 4, 7),
+				ticket(4, 1000, time.Second, 4, 7), ticket(5, 1000, time.Second, 4, 7),
+			},
+			after: 5 * time.Second,
+			want:  [][]int{{1, 3, 4, 5}},
+		},
+		{
+			name: "ranges that do not meet never share a table",
+			tickets: []Ticket{
+				ticket(1, 1000, 0, 4, 4), ticket(2, 1000, time.Second, 5, 7), ticket(3, 1000, time.Second, 5, 7),
+				ticket(4, 1000, time.Second, 5, 7), ticket(5, 1000, time.Second, 5, 7), ticket(6, 1000, time.Second, 5, 7),
+			},
+			after: 5 * time.Second,
+			want:  [][]int{{2, 3, 4, 5, 6}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.options == (Options{}) {
+				tt.options = options
+			}
+			q := New(tt.options)
+			for _, ticket := range tt.tickets {
+				if _, err := q.Join(ticket); err != nil {
+					t.Fatalf("join %d: %v", ticket.UserID, err)
+				}
+			}
+
+			got := seats(q.Match(start.Add(tt.after)))
+			if !slices.EqualFunc(got, tt.want, slices.Equal) {
+				t.Fatalf("tables %v, want %v", got, tt.want)
+			}
+			var matched int
+			for _, table := range got {
+				matched += len(table)
+			}
+			if q.Len() != len(tt.tickets)-matched {
+				t.Fatalf("%d players left in the queue, want %d", q.Len(), len(tt.tickets)-matched)
+			}
+		})
+	}
+}
+
+func TestRequeueKeepsPlaceInLine(t *testing.T) {
+	q := New(Options{})
+	for userID := 1; userID <= 5; userID++ {
+		if _, err := q.Join(ticket(userID, 1000, time.Duration(userID)*time.Second, 4, 4)); err != nil {
+			t.Fatalf("join %d: %v", userID, err)
+		}
+	}
+	tables := q.Match(start.Add(time.Minute))
+	if got := seats(tables); !slices.EqualFunc(got, [][]int{{1, 2, 3, 4}}, slices.Equal) {
+		t.Fatalf("first match: %v", got)
+	}
+
+	// Игрок 4 успел встать в очередь заново, пока стол не создался
+	if _, err := q.Join(ticket(4, 1500, time.Minute, 4, 4)); err != nil {
+		t.Fatalf("join again: %v", err)
+	}
+	q.requeue(tables[0])
+	if again, _ := q.Get(4); again.Rating != 1500 {
+		t.Fatalf("requeue replaced the new ticket of player 4: %+v", again)
+	}
+
+	// Вернувшиеся 1–3 сохраняют место в очереди, а 5 обходит новый билет игрока 4
+	if _, err := q.Join(ticket(6, 1000, 2*time.Minute, 4, 4)); err != nil {
+		t.Fatalf("join 6: %v", err)
+	}
+	got := seats(q.Match(start.Add(3 * time.Minute)))
+	if !slices.EqualFunc(got, [][]int{{1, 2, 3, 5}}, slices.Equal) {
+		t.Fatalf("match after requeue: %v", got)
+	}
+}
@@ -0,0 +1,150 @@
+package middlewares
+
+import (
+	"backend/data"
+	"backend/db"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+)
+
+// IdempotencyKeyHeader is the request header clients use to make retries safe
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// replayedHeaders are the response headers kept with a stored response
+var replayedHeaders = []string{"Content-Type", "ETag"}
+
+// Idempotency answers a retried mutating request with the response stored for
+// its Idempotency-Key instead of running the handler again. Keys are scoped
+// per user and kept for retention. Requests without the header, and safe
+// methods, pass straight through. Must run after JWTAuthMiddleware.
+func Idempotency(store db.IdempotencyStore, retention time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(IdempotencyKeyHeader)
+			if key == "" || r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(key) > 255 {
+				http.Error(w, "Idempotency-Key is too long", http.StatusBadRequest)
+				return
+			}
+
+			claims, ok := ClaimsFromContext(r.Context())
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				http.Error(w, "Invalid request body", http.StatusBadRequest)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			stored, err := store.ReserveIdempotencyKey(claims.UserID, key, fingerprint(r, body), time.Now().Add(-retention))
+			switch {
+			case errors.Is(err, db.ErrIdempotencyInProgress):
+				http.Error(w, "A request with this Idempotency-Key is still in progress", http.StatusConflict)
+				return
+			case errors.Is(err, db.ErrIdempotencyKeyReused):
+				http.Error(w, "Idempotency-Key was already used for a different request", http.StatusUnprocessableEntity)
+				return
+			case err != nil:
+				log.Printf("Idempotency reserve failed: %v", err)
+				http.Error(w, "Server error", http.StatusInternalServerError)
+				return
+			case stored != nil:
+				for name, value := range stored.Headers {
+					w.Header().Set(name, value)
+				}
+				w.Header().Set("Idempotent-Replayed", "true")
+				w.WriteHeader(stored.Status)
+				w.Write(stored.Body)
+				return
+			}
+
+			// Server errors and panics roll the move back, so the client may
+			// retry with the same key instead of waiting for it to expire
+			completed := false
+			defer func() {
+				if completed {
+					return
+				}
+				if err := store.ReleaseIdempotencyKey(claims.UserID, key); err != nil {
+					log.Printf("Idempotency release failed: %v", err)
+				}
+			}()
+
+			recorder := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(recorder, r)
+			if recorder.status >= http.StatusInternalServerError {
+				return
+			}
+
+			response := &data.IdempotentResponse{
+				Status:  recorder.status,
+				Headers: make(map[string]string),
+				Body:    recorder.body.Bytes(),
+			}
+			for _, name := range replayedHeaders {
+				if value := w.Header().Get(name); value != "" {
+					response.Headers[name] = value
+				}
+			}
+			// Ход уже применён: даже если ответ не сохранился, повтор не должен выполнить его снова
+			completed = true
+			if err := store.CompleteIdempotencyKey(claims.UserID, key, response); err != nil {
+				log.Printf("Idempotency complete failed: %v", err)
+			}
+		})
+	}
+}
+
+// PurgeIdempotencyKeys deletes expired keys every interval until the process exits
+func PurgeIdempotencyKeys(store db.IdempotencyStore, retention time.Duration, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		deleted, err := store.DeleteExpiredIdempotencyKeys(time.Now().Add(-retention))
+		if err != nil {
+			log.Printf("Idempotency purge failed: %v", err)
+			continue
+		}
+		if deleted > 0 {
+			log.Printf("Purged %d expired idempotency keys", deleted)
+		}
+	}
+}
+
+// fingerprint identifies the request a key was first used for
+func fingerprint(r *http.Request, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(r.Method + " " + r.URL.Path + "\n"))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// responseRecorder passes the response through while keeping a copy of it
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
@@ -0,0 +1,50 @@
+package middlewares
+
+import (
+	"backend/data"
+	"backend/db"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIdempotencyReleasesKeyAfterPanic(t *testing.T) {
+	store := db.NewMemoryStore()
+	var calls int
+	handler := Idempotency(store, time.Hour)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			panic("handler failed")
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	send := func() *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", "/api/games/1/draw", strings.NewReader("{}"))
+		r.Header.Set(IdempotencyKeyHeader, "retry-me")
+		r = r.WithContext(context.WithValue(r.Context(), claimsKey, &data.Claims{UserID: 1}))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatalf("the panic did not reach the server")
+			}
+		}()
+		send()
+	}()
+
+	// Ключ освободился, повтор выполняется, а не получает 409
+	if w := send(); w.Code != http.StatusCreated || calls != 2 {
+		t.Fatalf("retry after a panic: got %d after %d calls", w.Code, calls)
+	}
+	if w := send(); w.Code != http.StatusCreated || w.Header().Get("Idempotent-Replayed") != "true" || calls != 2 {
+		t.Fatalf("second retry: got %d, replayed %q, %d calls", w.Code, w.Header().Get("Idempotent-Replayed"), calls)
+	}
+}
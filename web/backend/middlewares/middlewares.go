@@ -2,11 +2,16 @@ package middlewares
 
 import (
 	"backend/data"
+	"context"
     
 	"log"
 	"net/http"
 )
 
+type contextKey string
+
+const claimsKey contextKey = "claims"
+
 // JWTAuthMiddleware checks for a valid JWT token
 func JWTAuthMiddleware(next http.Handler) http.Handler {
     return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -24,8 +29,14 @@ func JWTAuthMiddleware(next http.Handler) http.Handler {
 
         log.Printf("Authenticated user: %s", claims.Username)
 
-        // Pass the request to the next handler
-        next.ServeHTTP(w, r)
+        // Pass the request to the next handler with the claims attached
+        ctx := context.WithValue(r.Context(), claimsKey, claims)
+        next.ServeHTTP(w, r.WithContext(ctx))
     })
 }
 
+// ClaimsFromContext returns the claims JWTAuthMiddleware attached to the request
+func ClaimsFromContext(ctx context.Context) (*data.Claims, bool) {
+    claims, ok := ctx.Value(claimsKey).(*data.Claims)
+    return claims, ok
+}
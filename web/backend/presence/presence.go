@@ -0,0 +1,174 @@
+package presence
+
+import (
+	"backend/events"
+	"sync"
+	"time"
+)
+
+// Status is a player's connection state in one game
+type Status string
+
+const (
+	// Online players have at least one live connection to the game
+	Online Status = "online"
+	// Away players lost their last connection less than the grace period ago
+	// and are expected to reconnect
+	Away Status = "away"
+	// Offline players have not been connected for longer than the grace period
+	Offline Status = "offline"
+)
+
+// DefaultGrace is how long a player stays away before being reported offline
+const DefaultGrace = 30 * time.Second
+
+// Entry is a player's presence as exposed to clients
+type Entry struct {
+	UserID int       `json:"user_id"`
+	Status Status    `json:"status"`
+	Since  time.Time `json:"since"`
+}
+
+// Tracker follows which players of every game are connected and publishes a
+// "presence_changed" event whenever a player's status changes. A player may
+// hold several connections (tabs, devices); they are online while any of
+// them is.
+type Tracker struct {
+	events events.Publisher
+	grace  time.Duration
+
+	mu    sync.Mutex
+	games map[int]map[int]*player
+}
+
+// player is the tracked state of one user in one game
+type player struct {
+	status Status
+	since  time.Time
+	conns  int
+	timer  *time.Timer
+	gen    int // bumped on every disconnect so stale timers can tell
+}
+
+// New returns a tracker publishing to publisher that marks disconnected
+// players offline after grace
+func New(publisher events.Publisher, grace time.Duration) *Tracker {
+	if grace <= 0 {
+		grace = DefaultGrace
+	}
+	return &Tracker{
+		events: publisher,
+		grace:  grace,
+		games:  make(map[int]map[int]*player),
+	}
+}
+
+// Connect records a new connection of userID to gameID
+func (t *Tracker) Connect(gameID int, userID int) {
+	t.mu.Lock()
+	p := t.player(gameID, userID)
+	p.conns++
+	if p.timer != nil {
+		p.timer.Stop()
+		p.timer = nil
+	}
+	changed := t.set(p, Online)
+	t.mu.Unlock()
+
+	if changed {
+		t.publish(gameID, userID, Online)
+	}
+}
+
+// Disconnect records that one of userID's connections to gameID closed. When
+// it was the last one the player is away, and offline once grace passes
+// without a reconnect.
+func (t *Tracker) Disconnect(gameID int, userID int) {
+	t.mu.Lock()
+	p := t.player(gameID, userID)
+	if p.conns > 0 {
+		p.conns--
+	}
+	if p.conns > 0 {
+		t.mu.Unlock()
+		return
+	}
+	changed := t.set(p, Away)
+	p.gen++
+	gen := p.gen
+	p.timer = time.AfterFunc(t.grace, func() { t.expire(gameID, userID, p, gen) })
+	t.mu.Unlock()
+
+	if changed {
+		t.publish(gameID, userID, Away)
+	}
+}
+
+// Get returns the presence of userID in gameID; players that never
+// connected are offline
+func (t *Tracker) Get(gameID int, userID int) Entry {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if p, ok := t.games[gameID][userID]; ok {
+		return Entry{UserID: userID, Status: p.status, Since: p.since}
+	}
+	return Entry{UserID: userID, Status: Offline}
+}
+
+// Forget drops everything tracked for a game that no longer exists
+func (t *Tracker) Forget(gameID int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, p := range t.games[gameID] {
+		if p.timer != nil {
+			p.timer.Stop()
+		}
+	}
+	delete(t.games, gameID)
+}
+
+// expire marks p offline unless it reconnected, disconnected again or was
+// forgotten since the timer of generation gen started
+func (t *Tracker) expire(gameID int, userID int, p *player, gen int) {
+	t.mu.Lock()
+	if t.games[gameID][userID] != p || p.conns > 0 || p.gen != gen {
+		t.mu.Unlock()
+		return
+	}
+	p.timer = nil
+	changed := t.set(p, Offline)
+	t.mu.Unlock()
+
+	if changed {
+		t.publish(gameID, userID, Offline)
+	}
+}
+
+// player must be called with t.mu held
+func (t *Tracker) player(gameID int, userID int) *player {
+	game, ok := t.games[gameID]
+	if !ok {
+		game = make(map[int]*player)
+		t.games[gameID] = game
+	}
+	p, ok := game[userID]
+	if !ok {
+		p = &player{status: Offline}
+		game[userID] = p
+	}
+	return p
+}
+
+// set must be called with t.mu held; it reports whether the status changed
+func (t *Tracker) set(p *player, status Status) bool {
+	if p.status == status {
+		return false
+	}
+	p.status = status
+	p.since = time.Now()
+	return true
+}
+
+func (t *Tracker) publish(gameID int, userID int, status Status) {
+	t.events.Publish(events.New(gameID, events.PresenceChanged{PlayerID: userID, Status: string(status)}))
+}
@@ -0,0 +1,66 @@
+package timers
+
+import (
+	"sync"
+	"time"
+)
+
+// Scheduler calls expire for a game once its deadline passes. A game has at
+// most one deadline at a time: scheduling it again replaces the previous one.
+// Deadlines live in memory only; whoever persists them reschedules them after
+// a restart.
+type Scheduler struct {
+	expire func(gameID int)
+
+	mu     sync.Mutex
+	timers map[int]*timer
+}
+
+type timer struct {
+	at    time.Time
+	timer *time.Timer
+}
+
+// New returns a scheduler calling expire in its own goroutine
+func New(expire func(gameID int)) *Scheduler {
+	return &Scheduler{expire: expire, timers: make(map[int]*timer)}
+}
+
+// Schedule sets the deadline of gameID. A deadline in the past expires right
+// away. It reports false when that exact deadline was already scheduled.
+func (s *Scheduler) Schedule(gameID int, at time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if current, ok := s.timers[gameID]; ok {
+		if current.at.Equal(at) {
+			return false
+		}
+		current.timer.Stop()
+	}
+
+	t := &timer{at: at}
+	t.timer = time.AfterFunc(time.Until(at), func() {
+		s.mu.Lock()
+		if s.timers[gameID] != t {
+			// Replaced or cancelled after it fired
+			s.mu.Unlock()
+			return
+		}
+		delete(s.timers, gameID)
+		s.mu.Unlock()
+		s.expire(gameID)
+	})
+	s.timers[gameID] = t
+	return true
+}
+
+// Cancel drops the deadline of gameID, if any
+func (s *Scheduler) Cancel(gameID int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if current, ok := s.timers[gameID]; ok {
+		current.timer.Stop()
+		delete(s.timers, gameID)
+	}
+}
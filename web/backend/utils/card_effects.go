@@ -2,133 +2,203 @@ package utils
 
 import (
 	"backend/db"
+	"backend/events"
 	"fmt"
 	"math/rand"
 	"time"
 )
 
-// Объявляем канал для отправки сообщений через WebSocket
-var broadcast = make(chan map[string]interface{})
+// EffectContext is what every card effect runs against: the store of the
+// surrounding game transaction and the publisher its events go to. Handlers
+// pass an *events.Batch and flush it only after the transaction commits, so
+// a rolled back move never reaches the players.
+type EffectContext struct {
+	Store  db.GameProcessStore
+	GameID int
+	Events events.Publisher
+	// ResponseTimeout is how long a target has to answer, 0 for no limit
+	ResponseTimeout time.Duration
+	// TurnTimeout is how long a turn passed on by an elimination lasts
+	TurnTimeout time.Duration
+}
+
+// NotifyPlayers publishes an event to every player in the game
+func (c *EffectContext) NotifyPlayers(payload events.Payload) {
+	c.Events.Publish(events.New(c.GameID, payload))
+}
 
-// HandleBangEffect handles the effect of the Bang! card
-func HandleBangEffect(gameID int, userID int, targetID int) error {
-	// Проверяем, есть ли у цели карта Missed!
-	hasMissed, missedCardID, err := db.CheckPlayerHasCardByName(targetID, gameID, "Missed!")
+// NotifyPlayer publishes an event only userID receives
+func (c *EffectContext) NotifyPlayer(userID int, payload events.Payload) {
+	event := events.New(c.GameID, payload)
+	event.Recipient = userID
+	c.Events.Publish(event)
+}
+
+// checkElimination applies the death rules once userID is out of life points
+func checkElimination(ctx *EffectContext, userID int, killerID int) error {
+	players, err := ctx.Store.GetGamePlayers(ctx.GameID)
 	if err != nil {
-		return fmt.Errorf("could not check target's hand: %v", err)
+		return fmt.Errorf("could not get players: %v", err)
+	}
+	if p := findPlayer(players, userID); p != nil && p.Health <= 0 {
+		return HandleElimination(ctx, userID, killerID)
 	}
+	return nil
+}
+
+// HandleBangEffect handles the effect of the Bang! card. The shot is not
+// resolved yet: the game waits in the "respond" phase until the target answers
+// with a Missed! or takes the hit (see HandleBangResponse).
+func HandleBangEffect(ctx *EffectContext, userID int, targetID int) error {
+	if targetID == 0 || targetID == userID {
+		return fmt.Errorf("Bang! needs another player as target")
+	}
+
+	err := ctx.Store.UpdateGameStatePending(ctx.GameID, userID, targetID)
+	if err != nil {
+		return fmt.Errorf("could not record pending Bang!: %v", err)
+	}
+	err = ctx.Store.UpdateGameStatePhase(ctx.GameID, "respond")
+	if err != nil {
+		return fmt.Errorf("could not update game phase: %v", err)
+	}
+	if ctx.ResponseTimeout > 0 {
+		deadline := time.Now().Add(ctx.ResponseTimeout)
+		err = ctx.Store.UpdateGameStateResponseDeadline(ctx.GameID, &deadline)
+		if err != nil {
+			return fmt.Errorf("could not set response deadline: %v", err)
+		}
+	}
+
+	ctx.NotifyPlayers(events.CardEffect{
+		Effect:           "Bang!",
+		PlayerID:         userID,
+		TargetID:         targetID,
+		AwaitingResponse: true,
+	})
+
+	return nil
+}
 
-	if hasMissed {
+// HandleBangResponse resolves the pending Bang! once the target has answered.
+// missed is true when the target played a Missed!, which the caller has
+// already taken from their hand.
+func HandleBangResponse(ctx *EffectContext, shooterID int, targetID int, missed bool) error {
+	if missed {
 		// Цель использует карту Missed!
-		err = db.RemoveCardFromPlayerHand(targetID, gameID, missedCardID)
+		ctx.NotifyPlayers(events.CardEffect{
+			Effect:   "Missed!",
+			PlayerID: shooterID,
+			TargetID: targetID,
+			Success:  &missed,
+		})
+	} else {
+		// Цель не увернулась и теряет 1 здоровье
+		err := ctx.Store.DecreasePlayerHealth(ctx.GameID, targetID)
 		if err != nil {
-			return fmt.Errorf("could not remove Missed! card: %v", err)
+			return fmt.Errorf("could not decrease target's health: %v", err)
 		}
-		NotifyPlayers(gameID, "card_effect", map[string]interface{}{
-			"player_id":  userID,
-			"target_id":  targetID,
-			"effect":     "Missed!",
-			"successful": true,
+		ctx.NotifyPlayers(events.CardEffect{
+			Effect:   "Bang!",
+			PlayerID: shooterID,
+			TargetID: targetID,
+			Damage:   1,
 		})
-		return nil // Атака нейтрализована
 	}
 
-	// Если у цели нет карты Missed!, она теряет 1 здоровье
-	err = db.DecreasePlayerHealth(targetID)
+	// Ход возвращается к стрелявшему
+	err := ctx.Store.UpdateGameStatePending(ctx.GameID, 0, 0)
 	if err != nil {
-		return fmt.Errorf("could not decrease target's health: %v", err)
+		return fmt.Errorf("could not clear pending Bang!: %v", err)
+	}
+	err = ctx.Store.UpdateGameStateResponseDeadline(ctx.GameID, nil)
+	if err != nil {
+		return fmt.Errorf("could not clear response deadline: %v", err)
+	}
+	err = ctx.Store.UpdateGameStatePhase(ctx.GameID, "play")
+	if err != nil {
+		return fmt.Errorf("could not update game phase: %v", err)
 	}
 
-	NotifyPlayers(gameID, "card_effect", map[string]interface{}{
-		"player_id": userID,
-		"target_id": targetID,
-		"effect":    "Bang!",
-		"damage":    1,
-	})
-
+	if !missed {
+		return checkElimination(ctx, targetID, shooterID)
+	}
 	return nil
 }
 
 // HandleMissedEffect handles the effect of the Missed! card
-func HandleMissedEffect(gameID int, userID int) error {
-	// В текущей реализации эффект Missed! уже обрабатывается в HandleBangEffect
+func HandleMissedEffect(ctx *EffectContext, userID int) error {
+	// Missed! действует только как ответ на Bang! (см. HandleBangResponse)
 	return nil
 }
 
 // HandleBeerEffect handles the effect of the Beer card
-func HandleBeerEffect(gameID int, userID int) error {
-	err := db.IncreasePlayerHealth(userID)
+func HandleBeerEffect(ctx *EffectContext, userID int) error {
+	err := ctx.Store.IncreasePlayerHealth(ctx.GameID, userID)
 	if err != nil {
 		return fmt.Errorf("could not increase player's health: %v", err)
 	}
 
-	NotifyPlayers(gameID, "card_effect", map[string]interface{}{
-		"player_id": userID,
-		"effect":    "Beer",
-		"heal":      1,
-	})
+	ctx.NotifyPlayers(events.CardEffect{Effect: "Beer", PlayerID: userID, Heal: 1})
 
 	return nil
 }
 
 // HandleJailEffect handles the effect of the Jail card
-func HandleJailEffect(gameID int, targetID int) error {
-	jailCardID, err := db.GetCardIDByName("Jail")
+func HandleJailEffect(ctx *EffectContext, userID int, targetID int) error {
+	jailCardID, err := ctx.Store.GetCardIDByName("Jail")
 	if err != nil {
 		return fmt.Errorf("could not get Jail card ID: %v", err)
 	}
 
-	err = db.AddCardToPlayerBoard(targetID, gameID, jailCardID)
+	err = ctx.Store.AddCardToPlayerBoard(targetID, ctx.GameID, jailCardID)
 	if err != nil {
 		return fmt.Errorf("could not place Jail on player's board: %v", err)
 	}
 
-	NotifyPlayers(gameID, "card_effect", map[string]interface{}{
-		"target_id": targetID,
-		"effect":    "Jail",
-	})
+	ctx.NotifyPlayers(events.CardEffect{Effect: "Jail", PlayerID: userID, TargetID: targetID})
 
 	return nil
 }
 
 // HandleDynamiteEffect handles the effect of the Dynamite card
-func HandleDynamiteEffect(gameID int, userID int) error {
+func HandleDynamiteEffect(ctx *EffectContext, userID int) error {
 	rand.Seed(time.Now().UnixNano())
 	chance := rand.Intn(100)
 
 	if chance < 16 { // 1 из 6 шансов, что динамит взорвется
-		err := db.DecreasePlayerHealth(userID)
+		err := ctx.Store.DecreasePlayerHealth(ctx.GameID, userID)
 		if err != nil {
 			return fmt.Errorf("could not decrease player's health: %v", err)
 		}
 
-		NotifyPlayers(gameID, "card_effect", map[string]interface{}{
-			"player_id": userID,
-			"effect":    "Dynamite",
-			"damage":    3,
-		})
+		ctx.NotifyPlayers(events.CardEffect{Effect: "Dynamite", PlayerID: userID, Damage: 1})
+
+		if err := checkElimination(ctx, userID, 0); err != nil {
+			return err
+		}
 	} else {
 		// Если динамит не взорвался, передаем его следующему игроку
-		nextPlayerID, err := db.GetNextPlayerID(gameID, userID)
+		nextPlayerID, err := ctx.Store.GetNextPlayerID(ctx.GameID, userID)
 		if err != nil {
 			return fmt.Errorf("could not get next player: %v", err)
 		}
 
-		dynamiteCardID, err := db.GetCardIDByName("Dynamite")
+		dynamiteCardID, err := ctx.Store.GetCardIDByName("Dynamite")
 		if err != nil {
 			return fmt.Errorf("could not get Dynamite card ID: %v", err)
 		}
 
-		err = db.AddCardToPlayerBoard(nextPlayerID, gameID, dynamiteCardID)
+		err = ctx.Store.AddCardToPlayerBoard(nextPlayerID, ctx.GameID, dynamiteCardID)
 		if err != nil {
 			return fmt.Errorf("could not pass Dynamite to next player: %v", err)
 		}
 
-		NotifyPlayers(gameID, "card_effect", map[string]interface{}{
-			"player_id":    userID,
-			"next_player":  nextPlayerID,
-			"effect":       "Dynamite",
-			"passed_along": true,
+		ctx.NotifyPlayers(events.CardEffect{
+			Effect:   "Dynamite",
+			PlayerID: userID,
+			TargetID: nextPlayerID,
+			Passed:   true,
 		})
 	}
 
@@ -136,38 +206,12 @@ func HandleDynamiteEffect(gameID int, userID int) error {
 }
 
 // HandleBarrelEffect handles the effect of the Barrel card
-func HandleBarrelEffect(gameID int, userID int) error {
+func HandleBarrelEffect(ctx *EffectContext, userID int) error {
 	rand.Seed(time.Now().UnixNano())
 	chance := rand.Intn(100)
 
-	if chance < 50 { // 50% шанс, что игрок избежит выстрела
-		NotifyPlayers(gameID, "card_effect", map[string]interface{}{
-			"player_id":  userID,
-			"effect":     "Barrel",
-			"successful": true,
-		})
-		return nil
-	}
-
-	NotifyPlayers(gameID, "card_effect", map[string]interface{}{
-		"player_id":  userID,
-		"effect":     "Barrel",
-		"successful": false,
-	})
+	success := chance < 50 // 50% шанс, что игрок избежит выстрела
+	ctx.NotifyPlayers(events.CardEffect{Effect: "Barrel", PlayerID: userID, Success: &success})
 
 	return nil
 }
-
-// NotifyPlayers отправляет уведомление всем подключенным игрокам через WebSocket
-func NotifyPlayers(gameID int, event string, data map[string]interface{}) {
-	message := map[string]interface{}{
-		"game_id": gameID,
-		"event":   event,
-		"data":    data,
-	}
-
-	// Проверяем, есть ли канал для трансляции
-	if broadcast != nil {
-		broadcast <- message
-	}
-}
@@ -0,0 +1,197 @@
+package utils
+
+import (
+	"backend/data"
+	"backend/events"
+	"fmt"
+	"time"
+)
+
+// Sides that can win a game
+const (
+	WinnerSheriff  = "Sheriff" // the Sheriff together with the Deputies
+	WinnerOutlaws  = "Outlaws"
+	WinnerRenegade = "Renegade"
+)
+
+// outlawReward is how many cards whoever kills an Outlaw draws
+const outlawReward = 3
+
+// HandleElimination applies the death rules to a player who lost their last
+// life point or surrendered: the role is revealed and every card they hold goes
+// to the discard pile. Whoever kills an Outlaw draws 3 cards; a Sheriff who
+// kills a Deputy discards everything. killerID is 0 when nobody killed them.
+// If one side has won, the game ends; otherwise a dead player's turn or
+// pending response passes on.
+func HandleElimination(ctx *EffectContext, userID int, killerID int) error {
+	players, err := ctx.Store.GetGamePlayers(ctx.GameID)
+	if err != nil {
+		return fmt.Errorf("could not get players: %v", err)
+	}
+	victim := findPlayer(players, userID)
+	if victim == nil {
+		return fmt.Errorf("player %d is not in game %d", userID, ctx.GameID)
+	}
+
+	if err := ctx.Store.SetPlayerHealth(ctx.GameID, userID, 0); err != nil {
+		return err
+	}
+	if err := ctx.Store.DiscardPlayerCards(userID, ctx.GameID); err != nil {
+		return err
+	}
+	victim.Health = 0
+
+	eliminated := events.PlayerEliminated{PlayerID: userID, Role: victim.Role, KillerID: killerID}
+	if killer := findPlayer(players, killerID); killer != nil && killer.Health > 0 {
+		switch {
+		case victim.Role == data.RoleOutlaw:
+			if err := drawReward(ctx, killerID); err != nil {
+				return err
+			}
+			eliminated.RewardCards = outlawReward
+		case victim.Role == data.RoleDeputy && killer.Role == data.RoleSheriff:
+			// Шериф, убивший помощника, сбрасывает все карты
+			if err := ctx.Store.DiscardPlayerCards(killerID, ctx.GameID); err != nil {
+				return err
+			}
+			eliminated.KillerDiscarded = true
+		}
+	}
+	ctx.NotifyPlayers(eliminated)
+
+	state, err := ctx.Store.GetGameState(ctx.GameID)
+	if err != nil {
+		return fmt.Errorf("could not get game state: %v", err)
+	}
+	if state == nil {
+		return fmt.Errorf("game %d has no state", ctx.GameID)
+	}
+
+	if winner := gameWinner(players); winner != "" {
+		return endGame(ctx, players, winner)
+	}
+
+	switch {
+	case state.CurrentTurn == userID:
+		// Ход выбывшего переходит к следующему живому игроку
+		nextPlayerID, err := ctx.Store.GetNextPlayerID(ctx.GameID, userID)
+		if err != nil {
+			return err
+		}
+		if err := clearPending(ctx); err != nil {
+			return err
+		}
+		if err := ctx.Store.UpdateGameStateTurn(ctx.GameID, nextPlayerID); err != nil {
+			return err
+		}
+		if err := ctx.Store.UpdateGameStatePhase(ctx.GameID, "draw"); err != nil {
+			return err
+		}
+		var deadline *time.Time
+		if ctx.TurnTimeout > 0 {
+			at := time.Now().Add(ctx.TurnTimeout)
+			deadline = &at
+		}
+		if err := ctx.Store.UpdateGameStateTurnDeadline(ctx.GameID, deadline); err != nil {
+			return err
+		}
+		ctx.NotifyPlayers(events.TurnEnded{PlayerID: userID, NextPlayerID: nextPlayerID})
+	case state.CurrentPhase == "respond" && state.PendingTarget == userID:
+		// Выстрел в выбывшего больше не ждёт ответа
+		if err := clearPending(ctx); err != nil {
+			return err
+		}
+		if err := ctx.Store.UpdateGameStatePhase(ctx.GameID, "play"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// drawReward privately deals the killer of an Outlaw their cards
+func drawReward(ctx *EffectContext, killerID int) error {
+	var drawn []*data.Card
+	for i := 0; i < outlawReward; i++ {
+		card, err := ctx.Store.DrawCard(ctx.GameID)
+		if err != nil {
+			return err
+		}
+		if err := ctx.Store.AddCardToPlayerHand(killerID, ctx.GameID, card.ID); err != nil {
+			return err
+		}
+		drawn = append(drawn, card)
+	}
+	ctx.NotifyPlayer(killerID, events.CardsDrawn{Cards: drawn})
+	return nil
+}
+
+// endGame finishes the game and reveals every role
+func endGame(ctx *EffectContext, players []data.Player, winner string) error {
+	if err := clearPending(ctx); err != nil {
+		return err
+	}
+	if err := ctx.Store.UpdateGameStateTurnDeadline(ctx.GameID, nil); err != nil {
+		return err
+	}
+	if err := ctx.Store.UpdateGameStatePhase(ctx.GameID, "finished"); err != nil {
+		return err
+	}
+	if err := ctx.Store.UpdateGameStatus(ctx.GameID, data.StatusFinished); err != nil {
+		return err
+	}
+
+	ended := events.GameEnded{Winner: winner, Roles: make(map[int]string)}
+	for _, p := range players {
+		ended.Roles[p.UserID] = p.Role
+	}
+	ctx.NotifyPlayers(ended)
+	return nil
+}
+
+// clearPending drops a pending Bang! and its deadline
+func clearPending(ctx *EffectContext) error {
+	if err := ctx.Store.UpdateGameStatePending(ctx.GameID, 0, 0); err != nil {
+		return err
+	}
+	return ctx.Store.UpdateGameStateResponseDeadline(ctx.GameID, nil)
+}
+
+// gameWinner returns the side that has won, or "" while the game goes on. The
+// Outlaws win when the Sheriff dies, unless the Renegade is the last one
+// standing; the Sheriff wins once every Outlaw and the Renegade are dead.
+func gameWinner(players []data.Player) string {
+	var alive []data.Player
+	sheriffAlive, enemiesAlive := false, false
+	for _, p := range players {
+		if p.Health <= 0 {
+			continue
+		}
+		alive = append(alive, p)
+		switch p.Role {
+		case data.RoleSheriff:
+			sheriffAlive = true
+		case data.RoleOutlaw, data.RoleRenegade:
+			enemiesAlive = true
+		}
+	}
+
+	switch {
+	case !sheriffAlive && len(alive) == 1 && alive[0].Role == data.RoleRenegade:
+		return WinnerRenegade
+	case !sheriffAlive:
+		return WinnerOutlaws
+	case !enemiesAlive:
+		return WinnerSheriff
+	default:
+		return ""
+	}
+}
+
+func findPlayer(players []data.Player, userID int) *data.Player {
+	for i := range players {
+		if players[i].UserID == userID {
+			return &players[i]
+		}
+	}
+	return nil
+}
@@ -21,7 +21,7 @@ const GamesPage = () => {
       setError(null);
       try {
         const response = await api.get('/api/games');
-        setGames(response.data);
+        setGames(response.data.games);
       } catch (error: unknown) {
         console.error('Error fetching games:', error);
         setError('Failed to load games. Please try again later.');